@@ -0,0 +1,24 @@
+#!/usr/bin/env sh
+# Precompresses the built UI for the server: writes a .gz and, if the brotli
+# tool is installed, a .br next to every text asset of at least 1 KiB. The
+# server embeds them and serves them to clients that accept the encoding;
+# without them it only serves gzip, compressed at startup.
+#
+# Usage: scripts/compress-static.sh <dir>
+set -eu
+
+dir=${1:?usage: $0 <dir>}
+
+if ! command -v brotli >/dev/null 2>&1; then
+  echo "brotli not found, creating gzip files only" >&2
+fi
+
+find "$dir" -type f -size +1k \
+  \( -name '*.js' -o -name '*.mjs' -o -name '*.css' -o -name '*.html' -o -name '*.svg' \
+     -o -name '*.json' -o -name '*.map' -o -name '*.txt' -o -name '*.wasm' \) |
+while read -r file; do
+  gzip -9 -k -f -n "$file"
+  if command -v brotli >/dev/null 2>&1; then
+    brotli -q 11 -k -f "$file"
+  fi
+done
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIdP is an OpenID Connect provider with discovery, a key set and a
+// token endpoint that checks the PKCE verifier of its only code
+type testIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string                       // code_challenge of the last authorization request
+	nonce     string                       // nonce of the last authorization request
+	claims    func(map[string]interface{}) // Changes the ID token claims, if set
+}
+
+const testClientID = "baufi"
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t)})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user logging in: it records the challenge and nonce
+// of an authorization URL
+func (idp *testIdP) authorize(t *testing.T, authURL string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+// idToken returns a signed ID token for the last authorization request
+func (idp *testIdP) idToken(t *testing.T) string {
+	claims := map[string]interface{}{
+		"iss":            idp.server.URL,
+		"sub":            "alice",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          idp.nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Error(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string // Sent with the code, defaults to the one of the login
+		nonce    string // Expected nonce, defaults to the one of the login
+		claims   func(map[string]interface{})
+		wantErr  string
+	}{
+		{name: "valid"},
+		{name: "audience list", claims: func(c map[string]interface{}) { c["aud"] = []string{"other", testClientID} }},
+		{name: "wrong PKCE verifier", verifier: "guessed", wantErr: "invalid_grant"},
+		{name: "nonce mismatch", nonce: "replayed", wantErr: "nonce mismatch"},
+		{name: "wrong audience", claims: func(c map[string]interface{}) { c["aud"] = "other" }, wantErr: "audience"},
+		{name: "expired", claims: func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: "expired"},
+		{name: "wrong issuer", claims: func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, wantErr: "issuer"},
+		{name: "no subject", claims: func(c map[string]interface{}) { delete(c, "sub") }, wantErr: "subject"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			idp := newTestIdP(t)
+			idp.claims = tt.claims
+			p := NewOIDCProvider(OIDCConfig{IssuerURL: idp.server.URL, ClientID: testClientID}, idp.server.Client())
+
+			verifier, nonce := GenerateToken(), GenerateToken()
+			authURL, err := p.AuthCodeURL(ctx, "state", nonce, verifier, "https://baufi.example.com/api/auth/oidc/callback")
+			if err != nil {
+				t.Fatal(err)
+			}
+			idp.authorize(t, authURL)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			claims, err := p.Exchange(ctx, "code", verifier, nonce, "https://baufi.example.com/api/auth/oidc/callback")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
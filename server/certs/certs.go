@@ -0,0 +1,187 @@
+// Package certs serves the TLS certificate of the server from PEM files and
+// reloads it when the files change, such as after a renewal by cert-manager
+// or an ACME client, without restarting the server.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Info describes the certificate currently served
+type Info struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dnsNames,omitempty"`
+	Serial    string    `json:"serial"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	LoadedAt  time.Time `json:"loadedAt"`
+	ReloadErr string    `json:"reloadError,omitempty"` // Last failed reload; the previous certificate is still served
+}
+
+// fileID changes when a file is replaced or rewritten. Kubernetes updates
+// mounted secrets by swapping a symlink, which changes the target's ID too.
+type fileID struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader holds the certificate loaded from a certificate and key file
+type Reloader struct {
+	certFile, keyFile string
+
+	mu            sync.RWMutex
+	cert          *tls.Certificate
+	info          Info
+	certID, keyID fileID // Of the files last loaded
+}
+
+// NewReloader loads the certificate and key. It fails if they cannot be
+// loaded, so a misconfigured server does not start.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Info describes the current certificate
+func (r *Reloader) Info() Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.info
+}
+
+// Check fails if the current certificate is not valid now
+func (r *Reloader) Check(ctx context.Context) error {
+	info := r.Info()
+	now := time.Now()
+	switch {
+	case now.After(info.NotAfter):
+		return fmt.Errorf("certificate expired at %s", info.NotAfter.Format(time.RFC3339))
+	case now.Before(info.NotBefore):
+		return fmt.Errorf("certificate not valid before %s", info.NotBefore.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Watch checks the files every interval and reloads the certificate when
+// they change, until the context is cancelled. A certificate that fails to
+// load is logged and the previous one stays in use.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		certID, certErr := statFile(r.certFile)
+		keyID, keyErr := statFile(r.keyFile)
+		r.mu.RLock()
+		unchanged := certID == r.certID && keyID == r.keyID
+		r.mu.RUnlock()
+		if certErr != nil || keyErr != nil || unchanged {
+			continue
+		}
+
+		if err := r.reload(); err != nil {
+			slog.Error("Failed to reload TLS certificate", "error", err)
+			r.mu.Lock()
+			r.info.ReloadErr = err.Error()
+			// Retry only after the files change again
+			r.certID, r.keyID = certID, keyID
+			r.mu.Unlock()
+			continue
+		}
+		info := r.Info()
+		slog.Info("Reloaded TLS certificate", "subject", info.Subject, "not_after", info.NotAfter)
+	}
+}
+
+// reload reads both files and replaces the certificate
+func (r *Reloader) reload() error {
+	// Stat before reading, so a change during the read is picked up next time
+	certID, err := statFile(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyID, err := statFile(r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.info = Info{
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		DNSNames:  leaf.DNSNames,
+		Serial:    strings.ToUpper(leaf.SerialNumber.Text(16)),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		LoadedAt:  time.Now().UTC(),
+	}
+	r.certID, r.keyID = certID, keyID
+	return nil
+}
+
+func statFile(path string) (fileID, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileID{}, err
+	}
+	return fileID{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// ClientAuth modes of the server
+const (
+	ClientAuthNone     = "none"     // No client certificates
+	ClientAuthOptional = "optional" // Certificates are verified if sent
+	ClientAuthRequire  = "require"  // Every request except health checks needs a certificate
+)
+
+// LoadClientCAs reads the PEM certificates that client certificates must
+// be issued by
+func LoadClientCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("client CA file contains no PEM certificates")
+	}
+	return pool, nil
+}
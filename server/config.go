@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"baufi-optimierer/server/config"
+)
+
+// runConfigCommand implements the config subcommand. "config print" loads
+// the configuration like the server does, from the same flags, environment
+// and file, and writes the effective settings.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: baufi-opt config print [flags]")
+		return 2
+	}
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		exitWithConfigError(err)
+	}
+	cfg.Print(os.Stdout)
+	return 0
+}
+
+// exitWithConfigError reports an invalid configuration before logging is
+// set up and exits. -help exits successfully after printing the flags.
+func exitWithConfigError(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
@@ -0,0 +1,456 @@
+// Package config loads the server configuration from defaults, an optional
+// TOML file, environment variables and command-line flags. Later sources
+// override earlier ones: flags win over environment variables, which win
+// over the file.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/proxy"
+)
+
+// Config is the effective configuration of the server
+type Config struct {
+	Server struct {
+		Address         string
+		ReadTimeout     time.Duration
+		WriteTimeout    time.Duration
+		IdleTimeout     time.Duration
+		ShutdownDelay   time.Duration
+		ShutdownTimeout time.Duration
+		TrustedProxies  []string
+	}
+	TLS struct {
+		CertFile        string
+		KeyFile         string
+		ReloadInterval  time.Duration
+		RedirectAddress string
+		ClientAuth      string
+		ClientCAFile    string
+	}
+	Database struct {
+		Path         string
+		MaxOpenConns int
+		MaxIdleConns int
+	}
+	Log struct {
+		Level  string
+		Format string
+	}
+	Auth struct {
+		RegistrationEnabled bool
+		OIDC                struct {
+			IssuerURL    string
+			ClientID     string
+			ClientSecret string
+			RedirectURL  string
+			Scopes       []string
+		}
+	}
+	Security struct {
+		CSP            string
+		HSTSMaxAge     time.Duration
+		ReferrerPolicy string
+		CORSOrigins    []string
+	}
+	Limits struct {
+		ReadsPerMinute     int
+		WritesPerMinute    int
+		MaxBodyBytes       int
+		MaxImportBytes     int
+		MaxLoansPerUser    int
+		MaxPaymentsPerLoan int
+	}
+	Features struct {
+		RequireIfMatch     bool
+		Metrics            bool
+		TrashRetentionDays int
+	}
+	Metrics struct {
+		Address string
+	}
+}
+
+// setting binds a configuration key to its field
+type setting struct {
+	key    string // Key in the file and name of the flag, e.g. "server.address"
+	env    string
+	usage  string
+	secret bool // Masked by Print
+}
+
+// settings returns the flags of all settings bound to the fields of c,
+// with their defaults, and the settings in the order Print writes them
+func (c *Config) settings() (*flag.FlagSet, []setting) {
+	fs := flag.NewFlagSet("baufi-opt", flag.ContinueOnError)
+	var list []setting
+	add := func(s setting, bind func(name, usage string)) {
+		bind(s.key, s.usage+" (env "+s.env+")")
+		list = append(list, s)
+	}
+	str := func(p *string, value string) func(string, string) {
+		return func(name, usage string) { fs.StringVar(p, name, value, usage) }
+	}
+	integer := func(p *int, value int) func(string, string) {
+		return func(name, usage string) { fs.IntVar(p, name, value, usage) }
+	}
+	boolean := func(p *bool, value bool) func(string, string) {
+		return func(name, usage string) { fs.BoolVar(p, name, value, usage) }
+	}
+	duration := func(p *time.Duration, value time.Duration) func(string, string) {
+		return func(name, usage string) { fs.DurationVar(p, name, value, usage) }
+	}
+	stringList := func(p *[]string, value []string) func(string, string) {
+		*p = value
+		return func(name, usage string) { fs.Var((*listValue)(p), name, usage) }
+	}
+
+	add(setting{key: "server.address", env: "LISTEN_ADDRESS", usage: "address to listen on, e.g. :8080"}, str(&c.Server.Address, ":8080"))
+	add(setting{key: "server.read_timeout", env: "READ_TIMEOUT", usage: "maximum duration for reading a request"}, duration(&c.Server.ReadTimeout, 15*time.Second))
+	add(setting{key: "server.write_timeout", env: "WRITE_TIMEOUT", usage: "maximum duration for writing a response"}, duration(&c.Server.WriteTimeout, 15*time.Second))
+	add(setting{key: "server.idle_timeout", env: "IDLE_TIMEOUT", usage: "how long idle keep-alive connections stay open"}, duration(&c.Server.IdleTimeout, 60*time.Second))
+	add(setting{key: "server.shutdown_delay", env: "SHUTDOWN_DELAY", usage: "how long to keep serving after readiness fails on shutdown"}, duration(&c.Server.ShutdownDelay, 0))
+	add(setting{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", usage: "how long to wait for requests in flight on shutdown"}, duration(&c.Server.ShutdownTimeout, 30*time.Second))
+	add(setting{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "addresses or CIDR ranges of reverse proxies whose X-Forwarded-For and X-Forwarded-Proto are trusted"}, stringList(&c.Server.TrustedProxies, nil))
+	add(setting{key: "tls.cert_file", env: "TLS_CERT_FILE", usage: "PEM certificate chain; serves HTTPS if set"}, str(&c.TLS.CertFile, ""))
+	add(setting{key: "tls.key_file", env: "TLS_KEY_FILE", usage: "PEM private key of the certificate"}, str(&c.TLS.KeyFile, ""))
+	add(setting{key: "tls.reload_interval", env: "TLS_RELOAD_INTERVAL", usage: "how often to check the certificate files for changes"}, duration(&c.TLS.ReloadInterval, 30*time.Second))
+	add(setting{key: "tls.redirect_address", env: "TLS_REDIRECT_ADDRESS", usage: "address for plain HTTP redirecting to HTTPS, e.g. :80"}, str(&c.TLS.RedirectAddress, ""))
+	add(setting{key: "tls.client_auth", env: "TLS_CLIENT_AUTH", usage: "client certificates: none, optional or require"}, str(&c.TLS.ClientAuth, "none"))
+	add(setting{key: "tls.client_ca_file", env: "TLS_CLIENT_CA_FILE", usage: "PEM certificates that client certificates must be issued by"}, str(&c.TLS.ClientCAFile, ""))
+	add(setting{key: "database.path", env: "DB_PATH", usage: "SQLite database file"}, str(&c.Database.Path, defaultDBPath()))
+	add(setting{key: "database.max_open_conns", env: "DB_MAX_OPEN_CONNS", usage: "maximum number of open database connections"}, integer(&c.Database.MaxOpenConns, 25))
+	add(setting{key: "database.max_idle_conns", env: "DB_MAX_IDLE_CONNS", usage: "maximum number of idle database connections"}, integer(&c.Database.MaxIdleConns, 5))
+	add(setting{key: "log.level", env: "LOG_LEVEL", usage: "debug, info, warn or error; debug logs database queries"}, str(&c.Log.Level, "info"))
+	add(setting{key: "log.format", env: "LOG_FORMAT", usage: "text or json"}, str(&c.Log.Format, "text"))
+	add(setting{key: "auth.registration_enabled", env: "REGISTRATION_ENABLED", usage: "allow new accounts to sign up; the first account is always allowed"}, boolean(&c.Auth.RegistrationEnabled, true))
+	add(setting{key: "auth.oidc.issuer_url", env: "OIDC_ISSUER_URL", usage: "OpenID Connect issuer; enables single sign-on if set"}, str(&c.Auth.OIDC.IssuerURL, ""))
+	add(setting{key: "auth.oidc.client_id", env: "OIDC_CLIENT_ID", usage: "OpenID Connect client ID"}, str(&c.Auth.OIDC.ClientID, ""))
+	add(setting{key: "auth.oidc.client_secret", env: "OIDC_CLIENT_SECRET", usage: "OpenID Connect client secret", secret: true}, str(&c.Auth.OIDC.ClientSecret, ""))
+	add(setting{key: "auth.oidc.redirect_url", env: "OIDC_REDIRECT_URL", usage: "OpenID Connect redirect URL; derived from the request if empty"}, str(&c.Auth.OIDC.RedirectURL, ""))
+	add(setting{key: "auth.oidc.scopes", env: "OIDC_SCOPES", usage: "OpenID Connect scopes, separated by commas or spaces"}, stringList(&c.Auth.OIDC.Scopes, []string{"openid", "email", "profile"}))
+	add(setting{key: "security.csp", env: "CONTENT_SECURITY_POLICY", usage: "Content-Security-Policy of the app; derived from the embedded index.html if empty"}, str(&c.Security.CSP, ""))
+	add(setting{key: "security.hsts_max_age", env: "HSTS_MAX_AGE", usage: "Strict-Transport-Security max-age sent over HTTPS; 0 disables it"}, duration(&c.Security.HSTSMaxAge, 365*24*time.Hour))
+	add(setting{key: "security.referrer_policy", env: "REFERRER_POLICY", usage: "Referrer-Policy of all responses"}, str(&c.Security.ReferrerPolicy, "same-origin"))
+	add(setting{key: "security.cors_origins", env: "CORS_ORIGINS", usage: "origins allowed to call /api from the browser, e.g. https://dashboard.example.com"}, stringList(&c.Security.CORSOrigins, nil))
+	add(setting{key: "limits.reads_per_minute", env: "RATE_LIMIT_READS", usage: "GET requests per minute and client to /api; 0 disables the limit"}, integer(&c.Limits.ReadsPerMinute, 300))
+	add(setting{key: "limits.writes_per_minute", env: "RATE_LIMIT_WRITES", usage: "other requests per minute and client to /api; 0 disables the limit"}, integer(&c.Limits.WritesPerMinute, 60))
+	add(setting{key: "limits.max_body_bytes", env: "MAX_BODY_BYTES", usage: "maximum size of a request body"}, integer(&c.Limits.MaxBodyBytes, 64<<10))
+	add(setting{key: "limits.max_import_bytes", env: "MAX_IMPORT_BYTES", usage: "maximum size of an import"}, integer(&c.Limits.MaxImportBytes, 10<<20))
+	add(setting{key: "limits.max_loans_per_user", env: "MAX_LOANS_PER_USER", usage: "loans a user may create; 0 is unlimited"}, integer(&c.Limits.MaxLoansPerUser, 100))
+	add(setting{key: "limits.max_payments_per_loan", env: "MAX_PAYMENTS_PER_LOAN", usage: "special payments a loan may have; 0 is unlimited"}, integer(&c.Limits.MaxPaymentsPerLoan, 500))
+	add(setting{key: "features.require_if_match", env: "REQUIRE_IF_MATCH", usage: "require If-Match when changing loans"}, boolean(&c.Features.RequireIfMatch, false))
+	add(setting{key: "features.metrics", env: "METRICS_ENABLED", usage: "serve Prometheus metrics at /metrics"}, boolean(&c.Features.Metrics, true))
+	add(setting{key: "features.trash_retention_days", env: "TRASH_RETENTION_DAYS", usage: "days until deleted loans and special payments are purged"}, integer(&c.Features.TrashRetentionDays, 30))
+	add(setting{key: "metrics.address", env: "METRICS_ADDRESS", usage: "separate plain HTTP address for /metrics, e.g. :9090; served on server.address if empty"}, str(&c.Metrics.Address, ""))
+	return fs, list
+}
+
+// defaultDBPath keeps the database next to the binary, so it is found
+// regardless of the working directory
+func defaultDBPath() string {
+	exePath, err := os.Executable()
+	if err != nil {
+		return filepath.Join("data", "loans.db")
+	}
+	return filepath.Join(filepath.Dir(exePath), "data", "loans.db")
+}
+
+// Load builds the configuration from the command-line arguments, the
+// environment and the file named by -config or CONFIG_FILE, and validates
+// it. The error names every invalid setting.
+func Load(args []string) (*Config, error) {
+	c := &Config{}
+	fs, settings := c.settings()
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "TOML configuration file (env CONFIG_FILE)")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	// Flags win, so only settings without a flag are taken from env and file
+	fromFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { fromFlags[f.Name] = true })
+
+	var problems []string
+	set := func(key, value, source string) {
+		if err := fs.Set(key, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s from %s: invalid value %q, expected %s",
+				key, source, value, expectedType(fs.Lookup(key).Value)))
+		}
+	}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool)
+		for _, s := range settings {
+			known[s.key] = true
+			if value, ok := values[s.key]; ok && !fromFlags[s.key] {
+				set(s.key, value, *configFile)
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				problems = append(problems, fmt.Sprintf("%s from %s: unknown setting", key, *configFile))
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := lookupEnv(s); ok && !fromFlags[s.key] {
+			set(s.key, value, s.env)
+		}
+	}
+
+	// A value that failed to parse leaves a zero behind, so only valid
+	// values are checked further
+	if len(problems) == 0 {
+		problems = c.validate()
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return c, nil
+}
+
+// lookupEnv reads the environment variable of a setting. PORT and
+// LOG_DB_QUERIES are still understood for existing deployments.
+func lookupEnv(s setting) (string, bool) {
+	if value, ok := os.LookupEnv(s.env); ok {
+		return value, true
+	}
+	switch s.key {
+	case "server.address":
+		if port, ok := os.LookupEnv("PORT"); ok {
+			return ":" + port, true
+		}
+	case "log.level":
+		if os.Getenv("LOG_DB_QUERIES") == "true" {
+			return "debug", true
+		}
+	}
+	return "", false
+}
+
+// readFile parses a TOML configuration file
+func readFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	defer f.Close()
+	values, err := parseTOML(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// validate returns a message for each invalid setting
+func (c *Config) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	_, port, err := net.SplitHostPort(c.Server.Address)
+	check(err == nil && port != "", "server.address: %q is not host:port, e.g. :8080", c.Server.Address)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout: must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout: must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout: must be positive")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay: must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	_, err = proxy.ParsePrefixes(c.Server.TrustedProxies)
+	check(err == nil, "server.trusted_proxies: %v", err)
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls: cert_file and key_file must be set together")
+	check(c.TLS.ReloadInterval > 0, "tls.reload_interval: must be positive")
+	check(oneOf(c.TLS.ClientAuth, "none", "optional", "require"), "tls.client_auth: %q is not none, optional or require", c.TLS.ClientAuth)
+	if c.TLS.CertFile == "" {
+		check(c.TLS.RedirectAddress == "", "tls.redirect_address: requires tls.cert_file")
+		check(c.TLS.ClientAuth == "none", "tls.client_auth: requires tls.cert_file")
+	}
+	if c.TLS.RedirectAddress != "" {
+		_, port, err := net.SplitHostPort(c.TLS.RedirectAddress)
+		check(err == nil && port != "", "tls.redirect_address: %q is not host:port, e.g. :80", c.TLS.RedirectAddress)
+		check(c.TLS.RedirectAddress != c.Server.Address, "tls.redirect_address: must differ from server.address")
+	}
+	if c.TLS.ClientAuth == "optional" || c.TLS.ClientAuth == "require" {
+		check(c.TLS.ClientCAFile != "", "tls.client_ca_file: required when tls.client_auth is %s", c.TLS.ClientAuth)
+	}
+
+	check(c.Database.Path != "", "database.path: must not be empty")
+	check(c.Database.MaxOpenConns >= 1, "database.max_open_conns: must be at least 1")
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns: must be between 0 and max_open_conns (%d)", c.Database.MaxOpenConns)
+
+	check(oneOf(c.Log.Level, "debug", "info", "warn", "error"), "log.level: %q is not debug, info, warn or error", c.Log.Level)
+	check(oneOf(c.Log.Format, "text", "json"), "log.format: %q is not text or json", c.Log.Format)
+
+	if c.Auth.OIDC.IssuerURL != "" {
+		check(c.Auth.OIDC.ClientID != "", "auth.oidc.client_id: required when auth.oidc.issuer_url is set")
+	}
+
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age: must not be negative")
+	check(oneOf(c.Security.ReferrerPolicy, "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+		"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url"),
+		"security.referrer_policy: %q is not a referrer policy", c.Security.ReferrerPolicy)
+	for _, origin := range c.Security.CORSOrigins {
+		check(validOrigin(origin), "security.cors_origins: %q is not an origin like https://example.com", origin)
+	}
+
+	check(c.Limits.ReadsPerMinute >= 0, "limits.reads_per_minute: must not be negative")
+	check(c.Limits.WritesPerMinute >= 0, "limits.writes_per_minute: must not be negative")
+	check(c.Limits.MaxBodyBytes >= 1024, "limits.max_body_bytes: must be at least 1024")
+	check(c.Limits.MaxImportBytes >= c.Limits.MaxBodyBytes, "limits.max_import_bytes: must be at least limits.max_body_bytes")
+	check(c.Limits.MaxLoansPerUser >= 0, "limits.max_loans_per_user: must not be negative")
+	check(c.Limits.MaxPaymentsPerLoan >= 0, "limits.max_payments_per_loan: must not be negative")
+
+	check(c.Features.TrashRetentionDays >= 1, "features.trash_retention_days: must be a positive number of days")
+
+	if c.Metrics.Address != "" {
+		_, port, err := net.SplitHostPort(c.Metrics.Address)
+		check(err == nil && port != "", "metrics.address: %q is not host:port, e.g. :9090", c.Metrics.Address)
+		check(c.Metrics.Address != c.Server.Address && c.Metrics.Address != c.TLS.RedirectAddress,
+			"metrics.address: must differ from server.address and tls.redirect_address")
+		check(c.Features.Metrics, "metrics.address: requires features.metrics")
+	}
+	return problems
+}
+
+// validOrigin accepts scheme://host[:port] without a path, as browsers send
+// it in the Origin header
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the configuration as a TOML file, with secrets masked. The
+// output can be used as a configuration file after filling them in.
+func (c *Config) Print(w io.Writer) {
+	// Binding the flags resets the fields to their defaults, so bind a copy
+	// and restore the values afterwards
+	printed := *c
+	fs, settings := printed.settings()
+	printed = *c
+
+	section := ""
+	for _, s := range settings {
+		table, key := "", s.key
+		if i := strings.LastIndex(s.key, "."); i >= 0 {
+			table, key = s.key[:i], s.key[i+1:]
+		}
+		if table != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "[%s]\n", table)
+			section = table
+		}
+
+		f := fs.Lookup(s.key)
+		value := f.Value.String()
+		switch {
+		case s.secret && value != "":
+			value = strconv.Quote("********")
+		case isQuoted(f.Value):
+			value = strconv.Quote(value)
+		case isList(f.Value):
+			value = formatList(value)
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", key, value, s.env)
+	}
+}
+
+// expectedType describes the values a flag accepts
+func expectedType(v flag.Value) string {
+	switch v.(flag.Getter).Get().(type) {
+	case bool:
+		return "true or false"
+	case int:
+		return "an integer"
+	case time.Duration:
+		return "a duration such as 30s or 5m"
+	}
+	return "a string"
+}
+
+// isQuoted reports whether the TOML form of a flag value is a string
+func isQuoted(v flag.Value) bool {
+	switch v.(flag.Getter).Get().(type) {
+	case string, time.Duration:
+		return true
+	}
+	return false
+}
+
+func isList(v flag.Value) bool {
+	_, ok := v.(*listValue)
+	return ok
+}
+
+// formatList formats a comma-separated list as a TOML array
+func formatList(value string) string {
+	if value == "" {
+		return "[]"
+	}
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		items[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// listValue is a flag holding a list separated by commas or spaces
+type listValue []string
+
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = strings.Fields(strings.ReplaceAll(value, ",", " "))
+	return nil
+}
+
+func (l *listValue) Get() interface{} {
+	return []string(*l)
+}
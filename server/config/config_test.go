@@ -0,0 +1,211 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a configuration file into a temporary directory
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]string
+		err   string // Part of the expected error
+	}{
+		{name: "tables and keys", input: "top = 1\n[server]\naddress = \":8080\"\n[auth.oidc]\nclient_id = 'app'\n",
+			want: map[string]string{"top": "1", "server.address": ":8080", "auth.oidc.client_id": "app"}},
+		{name: "comments", input: "# file comment\n[log] # table comment\nlevel = \"info\" # trailing\nformat = \"a # b\"\n",
+			want: map[string]string{"log.level": "info", "log.format": "a # b"}},
+		{name: "escapes", input: `csp = "default-src \"self\"\\n\t"` + "\nraw = 'C:\\data\\n'\n",
+			want: map[string]string{"csp": "default-src \"self\"\\n\t", "raw": `C:\data\n`}},
+		{name: "numbers and booleans", input: "a = 1_000\nb = 2.5\nc = true\nd = false\n",
+			want: map[string]string{"a": "1000", "b": "2.5", "c": "true", "d": "false"}},
+		{name: "arrays", input: "empty = []\nlist = [\"a\", 'b',\"c\" ]\n",
+			want: map[string]string{"empty": "", "list": "a,b,c"}},
+		{name: "unquoted string", input: "level = info\n", err: "line 1: level: invalid value info: strings must be quoted"},
+		{name: "unterminated string", input: "level = \"info\n", err: "unterminated string"},
+		{name: "text after string", input: "level = \"info\" debug\n", err: "unexpected text after string"},
+		{name: "unsupported escape", input: `path = "C:\data"` + "\n", err: `unsupported escape \d`},
+		{name: "array of numbers", input: "list = [1, 2]\n", err: "arrays must contain strings"},
+		{name: "multi-line array", input: "list = [\"a\",\n\"b\"]\n", err: "end on the same line"},
+		{name: "array without comma", input: "list = [\"a\" \"b\"]\n", err: "expected , or ]"},
+		{name: "missing value", input: "level =\n", err: "missing value"},
+		{name: "no equals sign", input: "[log]\nlevel\n", err: "line 2: expected key = value"},
+		{name: "key set twice", input: "[log]\nlevel = \"info\"\nlevel = \"warn\"\n", err: "line 3: log.level is set twice"},
+		{name: "array of tables", input: "[[server]]\n", err: "invalid table header"},
+		{name: "invalid table name", input: "[server..tls]\n", err: "invalid table name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Flags win over environment variables, which win over the file
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+[server]
+address = ":7000"
+
+[log]
+level = "warn"
+format = "json"
+
+[limits]
+reads_per_minute = 10
+`)
+	t.Setenv("LISTEN_ADDRESS", ":8000")
+	t.Setenv("LOG_LEVEL", "error")
+
+	c, err := Load([]string{"-config", path, "-server.address", ":9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Address != ":9000" {
+		t.Errorf("server.address = %q, want the flag :9000", c.Server.Address)
+	}
+	if c.Log.Level != "error" {
+		t.Errorf("log.level = %q, want the env error", c.Log.Level)
+	}
+	if c.Log.Format != "json" || c.Limits.ReadsPerMinute != 10 {
+		t.Errorf("log.format = %q, limits.reads_per_minute = %d, want the file's json and 10", c.Log.Format, c.Limits.ReadsPerMinute)
+	}
+	if c.Limits.WritesPerMinute != 60 {
+		t.Errorf("limits.writes_per_minute = %d, want the default 60", c.Limits.WritesPerMinute)
+	}
+
+	// CONFIG_FILE names the file when -config is missing
+	t.Setenv("CONFIG_FILE", path)
+	if c, err := Load(nil); err != nil || c.Log.Format != "json" {
+		t.Errorf("Load() with CONFIG_FILE = %+v, %v, want log.format json", c, err)
+	}
+}
+
+func TestLoadLegacyEnv(t *testing.T) {
+	t.Setenv("PORT", "9090")
+	t.Setenv("LOG_DB_QUERIES", "true")
+	c, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Address != ":9090" || c.Log.Level != "debug" {
+		t.Errorf("server.address = %q, log.level = %q, want :9090 and debug", c.Server.Address, c.Log.Level)
+	}
+
+	// The current names win over the legacy ones
+	t.Setenv("LISTEN_ADDRESS", "127.0.0.1:8000")
+	t.Setenv("LOG_LEVEL", "warn")
+	c, err = Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Address != "127.0.0.1:8000" || c.Log.Level != "warn" {
+		t.Errorf("server.address = %q, log.level = %q, want 127.0.0.1:8000 and warn", c.Server.Address, c.Log.Level)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string // Lines of the error
+	}{
+		{name: "unknown key", file: "[server]\nadress = \":8080\"\n",
+			want: []string{"server.adress from CONFIG: unknown setting"}},
+		{name: "wrong types", file: "[database]\nmax_open_conns = \"many\"\n[server]\nread_timeout = 30\n",
+			want: []string{
+				`database.max_open_conns from CONFIG: invalid value "many", expected an integer`,
+				`server.read_timeout from CONFIG: invalid value "30", expected a duration such as 30s or 5m`,
+			}},
+		{name: "wrong type in env", env: map[string]string{"REQUIRE_IF_MATCH": "yes"},
+			want: []string{`features.require_if_match from REQUIRE_IF_MATCH: invalid value "yes", expected true or false`}},
+		{name: "trash retention", file: "[features]\ntrash_retention_days = 0\n",
+			want: []string{"features.trash_retention_days: must be a positive number of days"}},
+		{name: "idle above open connections", args: []string{"-database.max_open_conns", "2", "-database.max_idle_conns", "3"},
+			want: []string{"database.max_idle_conns: must be between 0 and max_open_conns (2)"}},
+		{name: "all problems at once", file: "[log]\nlevel = \"verbose\"\n", env: map[string]string{"LISTEN_ADDRESS": "8080"},
+			want: []string{
+				`log.level: "verbose" is not debug, info, warn or error`,
+				`server.address: "8080" is not host:port, e.g. :8080`,
+			}},
+		{name: "metrics on the server address", env: map[string]string{"METRICS_ADDRESS": ":8080"},
+			want: []string{"metrics.address: must differ from server.address and tls.redirect_address"}},
+		{name: "unexpected argument", args: []string{"serve"}, want: []string{`unexpected argument "serve"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			args := tt.args
+			var path string
+			if tt.file != "" {
+				path = writeConfig(t, tt.file)
+				args = append([]string{"-config", path}, args...)
+			}
+
+			_, err := Load(args)
+			if err == nil {
+				t.Fatal("Load() accepted the configuration")
+			}
+			message := err.Error()
+			if path != "" {
+				message = strings.ReplaceAll(message, path, "CONFIG")
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(message, line) {
+					t.Errorf("error %q does not contain %q", message, line)
+				}
+			}
+		})
+	}
+}
+
+// The printed configuration loads as a file into the same configuration
+func TestPrintRoundTrip(t *testing.T) {
+	c, err := Load([]string{"-server.trusted_proxies", "10.0.0.0/8, 192.168.1.1", "-security.csp", `default-src "self"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	c.Print(&want)
+
+	loaded, err := Load([]string{"-config", writeConfig(t, want.String())})
+	if err != nil {
+		t.Fatalf("printed configuration does not load: %v\n%s", err, want.String())
+	}
+	var got bytes.Buffer
+	loaded.Print(&got)
+	if got.String() != want.String() {
+		t.Errorf("loaded configuration prints as\n%s\nwant\n%s", got.String(), want.String())
+	}
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseTOML reads the subset of TOML used by config files: [section] and
+// [section.sub] tables, key = value pairs, # comments, and values that are
+// strings, integers, floats, booleans or single-line arrays of strings. It
+// returns the values by dotted key, e.g. "server.address", as the text
+// form a flag accepts; arrays are joined with commas.
+func parseTOML(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %q", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if !validKey(section) {
+				return nil, fmt.Errorf("line %d: invalid table name %q", lineNo, section)
+			}
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !validKey(key) {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		if section != "" {
+			key = section + "." + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", lineNo, key)
+		}
+
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", lineNo, key, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// stripComment removes a # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// validKey accepts bare keys, dotted with at most one level per dot
+func validKey(key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		if part == "" {
+			return false
+		}
+		for _, c := range part {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseValue converts a TOML value to its text form
+func parseValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case raw[0] == '"' || raw[0] == '\'':
+		value, rest, err := parseString(raw)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return "", fmt.Errorf("unexpected text after string")
+		}
+		return value, nil
+	case raw[0] == '[':
+		return parseArray(raw)
+	case raw == "true" || raw == "false":
+		return raw, nil
+	}
+	// Numbers may use underscores as separators, e.g. 1_000
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return "", fmt.Errorf("invalid value %s: strings must be quoted", raw)
+	}
+	return number, nil
+}
+
+// parseString reads a basic ("...") or literal ('...') string at the start
+// of raw and returns it with the remaining text
+func parseString(raw string) (string, string, error) {
+	quote := raw[0]
+	var b strings.Builder
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == quote:
+			return b.String(), raw[i+1:], nil
+		case c == '\\' && quote == '"':
+			i++
+			if i == len(raw) {
+				break
+			}
+			switch raw[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(raw[i])
+			default:
+				return "", "", fmt.Errorf("unsupported escape \\%c", raw[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// parseArray reads a single-line array of strings
+func parseArray(raw string) (string, error) {
+	rest := strings.TrimSpace(raw[1:])
+	var items []string
+	for {
+		if strings.HasPrefix(rest, "]") {
+			if strings.TrimSpace(rest[1:]) != "" {
+				return "", fmt.Errorf("unexpected text after array")
+			}
+			return strings.Join(items, ","), nil
+		}
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			return "", fmt.Errorf("arrays must contain strings and end on the same line")
+		}
+		item, after, err := parseString(rest)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+		rest = strings.TrimSpace(after)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if !strings.HasPrefix(rest, "]") {
+			return "", fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
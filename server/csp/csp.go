@@ -0,0 +1,86 @@
+// Package csp builds Content-Security-Policy headers for the HTML pages the
+// server embeds. Inline scripts and styles are allowed by their hash, so the
+// policies do not need 'unsafe-inline' for them.
+package csp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// Sources returns the source expressions the elements with the given tag
+// ("script" or "style") in an HTML document need: the hash, such as
+// 'sha256-…', of each inline element and the origin of each element loaded
+// from another site. Relative sources are covered by 'self'.
+func Sources(html []byte, tag string) []string {
+	lower := bytes.ToLower(html)
+	open, end := []byte("<"+tag), []byte("</"+tag)
+
+	var sources []string
+	for {
+		start := bytes.Index(lower, open)
+		if start < 0 {
+			return sources
+		}
+		lower, html = lower[start+len(open):], html[start+len(open):]
+
+		// The tag name must end here, e.g. <script> but not <scripts>
+		if len(lower) == 0 || !strings.ContainsRune(" \t\r\n/>", rune(lower[0])) {
+			continue
+		}
+		closeTag := bytes.IndexByte(lower, '>')
+		if closeTag < 0 {
+			return sources
+		}
+		attrs := lower[:closeTag]
+		lower, html = lower[closeTag+1:], html[closeTag+1:]
+
+		stop := bytes.Index(lower, end)
+		if stop < 0 {
+			return sources
+		}
+		if _, src, found := bytes.Cut(attrs, []byte("src=")); found {
+			if origin := originOf(string(src)); origin != "" {
+				sources = append(sources, origin)
+			}
+		} else {
+			sum := sha256.Sum256(html[:stop])
+			sources = append(sources, "'sha256-"+base64.StdEncoding.EncodeToString(sum[:])+"'")
+		}
+		lower, html = lower[stop:], html[stop:]
+	}
+}
+
+// originOf returns the origin of an absolute URL at the start of an
+// attribute value, or "" for a relative one
+func originOf(value string) string {
+	value = strings.TrimLeft(value, `"'`)
+	if end := strings.IndexAny(value, "\"' \t\r\n>"); end >= 0 {
+		value = value[:end]
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Scheme == "" {
+		// Protocol-relative, e.g. //cdn.example.com/lib.js, matches the
+		// scheme of the page
+		return u.Host
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Policy joins directives, such as "default-src 'self'", into a header value.
+// Empty directives are left out.
+func Policy(directives ...string) string {
+	var parts []string
+	for _, d := range directives {
+		if d = strings.TrimSpace(d); d != "" {
+			parts = append(parts, d)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
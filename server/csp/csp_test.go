@@ -0,0 +1,85 @@
+package csp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+// hash returns the source expression of an inline element's content
+func hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// index is shaped like the index.html the UI build produces
+const index = `<!doctype html>
+<html lang="de">
+  <head>
+    <meta charset="UTF-8" />
+    <title>Baufi</title>
+    <script>window.APP_VERSION = "1.2.3";</script>
+    <SCRIPT type="text/javascript">
+      if (localStorage.theme === 'dark') document.documentElement.classList.add('dark')
+    </SCRIPT>
+    <script type="module" crossorigin src="/assets/index-Bq3x9.js"></script>
+    <script src='https://cdn.example.com/lib/chart.js?v=4'></script>
+    <script src=//stats.example.org/s.js async></script>
+    <scripts>not a script</scripts>
+    <style>body { margin: 0 }</style>
+    <link rel="stylesheet" crossorigin href="/assets/index-Xy7.css">
+  </head>
+  <body><div id="root"></div></body>
+</html>`
+
+func TestSources(t *testing.T) {
+	scripts := Sources([]byte(index), "script")
+	want := []string{
+		hash(`window.APP_VERSION = "1.2.3";`),
+		hash("\n      if (localStorage.theme === 'dark') document.documentElement.classList.add('dark')\n    "),
+		"https://cdn.example.com",
+		"stats.example.org",
+	}
+	if !reflect.DeepEqual(scripts, want) {
+		t.Errorf("script sources = %q, want %q", scripts, want)
+	}
+
+	if styles := Sources([]byte(index), "style"); !reflect.DeepEqual(styles, []string{hash("body { margin: 0 }")}) {
+		t.Errorf("style sources = %q", styles)
+	}
+	if sources := Sources([]byte("<html><script>unterminated"), "script"); sources != nil {
+		t.Errorf("unterminated script: sources = %q, want none", sources)
+	}
+	if sources := Sources(nil, "script"); sources != nil {
+		t.Errorf("no document: sources = %q, want none", sources)
+	}
+}
+
+func TestOriginOf(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`"https://cdn.example.com/lib.js"></script>`, "https://cdn.example.com"},
+		{`'http://cdn.example.com:8080/lib.js' defer>`, "http://cdn.example.com:8080"},
+		{`https://cdn.example.com/lib.js>`, "https://cdn.example.com"},
+		{`"//cdn.example.com/lib.js"`, "cdn.example.com"},
+		{`"/assets/index.js"`, ""},
+		{`"assets/index.js"`, ""},
+		{`""`, ""},
+	}
+	for _, tt := range tests {
+		if got := originOf(tt.value); got != tt.want {
+			t.Errorf("originOf(%s) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	got := Policy("default-src 'self'", "", "  script-src 'self' 'sha256-abc'  ", "object-src 'none'")
+	want := "default-src 'self'; script-src 'self' 'sha256-abc'; object-src 'none'"
+	if got != want {
+		t.Errorf("Policy() = %q, want %q", got, want)
+	}
+}
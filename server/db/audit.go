@@ -0,0 +1,404 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/models"
+)
+
+// Audit log queries. Every create, update and delete of a loan or special
+// payment appends an entry in the same transaction as the change.
+
+// auditFields maps the audited JSON field names to their values
+type auditFields map[string]interface{}
+
+// loanAuditFields returns the audited fields of a loan
+func loanAuditFields(loan *models.Loan) auditFields {
+	return auditFields{
+		"name":               loan.Name,
+		"amount":             loan.Amount,
+		"interestRate":       loan.InterestRate,
+		"startDate":          loan.StartDate,
+		"fixedInterestYears": loan.FixedInterestYears,
+		"repaymentType":      loan.RepaymentType,
+		"repaymentValue":     loan.RepaymentValue,
+	}
+}
+
+// paymentAuditFields returns the audited fields of a special payment
+func paymentAuditFields(payment *models.SpecialPayment) auditFields {
+	return auditFields{
+		"date":   payment.Date,
+		"amount": payment.Amount,
+		"note":   payment.Note,
+	}
+}
+
+// recordAudit appends an audit entry with the fields that differ between
+// before and after. before is nil for creates, after is nil for deletes.
+// Updates without changes are not recorded.
+func recordAudit(ctx context.Context, tx *sql.Tx, actorID, loanID, entityType, entityID, operation string, before, after auditFields, restoredFrom int64) error {
+	changes := map[string]models.FieldChange{}
+	for field, value := range after {
+		if before == nil || fmt.Sprint(before[field]) != fmt.Sprint(value) {
+			changes[field] = models.FieldChange{Before: before[field], After: value}
+		}
+	}
+	for field, value := range before {
+		if after == nil {
+			changes[field] = models.FieldChange{Before: value}
+		}
+	}
+	if operation == models.AuditUpdate && len(changes) == 0 {
+		return nil
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	var actorValue *string
+	if actorID != "" {
+		actorValue = &actorID
+	}
+	var restoredValue *int64
+	if restoredFrom != 0 {
+		restoredValue = &restoredFrom
+	}
+
+	_, err = txExec(ctx, tx, `
+		INSERT INTO audit_log (loan_id, entity_type, entity_id, operation, actor_id, changes, restored_from, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, loanID, entityType, entityID, operation, actorValue, string(changesJSON), restoredValue,
+		time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// txLoan reads a loan without special payments inside a transaction
+func txLoan(ctx context.Context, tx *sql.Tx, id string) (*models.Loan, error) {
+	var loan models.Loan
+	err := txQueryRow(ctx, tx, `
+		SELECT id, name, amount, interest_rate, start_date, fixed_interest_years,
+		       repayment_type, repayment_value, version
+		FROM loans
+		WHERE id = ?
+	`, id).Scan(&loan.ID, &loan.Name, &loan.Amount, &loan.InterestRate, &loan.StartDate,
+		&loan.FixedInterestYears, &loan.RepaymentType, &loan.RepaymentValue, &loan.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// txSpecialPayments reads the special payments of a loan inside a transaction
+func txSpecialPayments(ctx context.Context, tx *sql.Tx, loanID string) ([]models.SpecialPayment, error) {
+	rows, err := txQueryRows(ctx, tx, `
+		SELECT id, loan_id, date, amount, COALESCE(note, '')
+		FROM special_payments
+		WHERE loan_id = ? AND deleted_at IS NULL
+		ORDER BY date ASC
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []models.SpecialPayment{}
+	for rows.Next() {
+		var payment models.SpecialPayment
+		if err := rows.Scan(&payment.ID, &payment.LoanID, &payment.Date, &payment.Amount, &payment.Note); err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// auditLoanDeletes records the deletion of all loans of a household.
+// Loans in the trash already have their delete recorded.
+func auditLoanDeletes(ctx context.Context, tx *sql.Tx, actorID, householdID string) error {
+	rows, err := txQueryRows(ctx, tx, "SELECT id FROM loans WHERE household_id = ? AND deleted_at IS NULL", householdID)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		loan, err := txLoan(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, actorID, id, models.AuditEntityLoan, id, models.AuditDelete,
+			loanAuditFields(loan), nil, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLoanHistory retrieves the audit entries of a loan and its special payments, newest first
+func GetLoanHistory(ctx context.Context, loanID string) ([]models.AuditEntry, error) {
+	rows, err := queryRows(ctx, `
+		SELECT a.id, a.loan_id, a.entity_type, a.entity_id, a.operation,
+		       COALESCE(a.actor_id, ''), COALESCE(u.name, ''), a.changes,
+		       COALESCE(a.restored_from, 0), a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE a.loan_id = ?
+		ORDER BY a.id DESC
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes string
+
+		if err := rows.Scan(&entry.ID, &entry.LoanID, &entry.EntityType, &entry.EntityID,
+			&entry.Operation, &entry.ActorID, &entry.ActorName, &changes,
+			&entry.RestoredFrom, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// RestoreLoanVersion resets a loan and its special payments to the state
+// right after the given audit entry. The state is rebuilt by undoing all
+// later entries, starting from the current state. The restore itself is
+// recorded as ordinary changes that reference the restored entry.
+func RestoreLoanVersion(ctx context.Context, actorID, loanID string, entryID int64) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var entryLoanID string
+	err = txQueryRow(ctx, tx, "SELECT loan_id FROM audit_log WHERE id = ?", entryID).Scan(&entryLoanID)
+	if err == sql.ErrNoRows || (err == nil && entryLoanID != loanID) {
+		return ErrHistoryEntryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := txLoan(ctx, tx, loanID)
+	if err == sql.ErrNoRows {
+		return ErrLoanNotFound
+	}
+	if err != nil {
+		return err
+	}
+	currentPayments, err := txSpecialPayments(ctx, tx, loanID)
+	if err != nil {
+		return err
+	}
+
+	// Rebuild the target state
+	loanState := loanAuditFields(current)
+	paymentStates := map[string]auditFields{}
+	for i := range currentPayments {
+		paymentStates[currentPayments[i].ID] = paymentAuditFields(&currentPayments[i])
+	}
+
+	rows, err := txQueryRows(ctx, tx, `
+		SELECT entity_type, entity_id, operation, changes
+		FROM audit_log
+		WHERE loan_id = ? AND id > ?
+		ORDER BY id DESC
+	`, loanID, entryID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var entityType, entityID, operation, changesJSON string
+		if err := rows.Scan(&entityType, &entityID, &operation, &changesJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		var changes map[string]models.FieldChange
+		if err := json.Unmarshal([]byte(changesJSON), &changes); err != nil {
+			rows.Close()
+			return err
+		}
+
+		// Only updates change the fields of the loan itself
+		if entityType == models.AuditEntityLoan {
+			if operation == models.AuditUpdate {
+				for field, change := range changes {
+					loanState[field] = change.Before
+				}
+			}
+			continue
+		}
+
+		switch operation {
+		case models.AuditCreate, models.AuditRestore:
+			delete(paymentStates, entityID)
+		case models.AuditDelete:
+			state := auditFields{}
+			for field, change := range changes {
+				state[field] = change.Before
+			}
+			paymentStates[entityID] = state
+		case models.AuditUpdate:
+			if state, ok := paymentStates[entityID]; ok {
+				for field, change := range changes {
+					state[field] = change.Before
+				}
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Apply the target state
+	now := time.Now().UTC().Format(time.RFC3339)
+	target := loanFromAuditFields(loanID, loanState)
+	if _, err := txExec(ctx, tx, `
+		UPDATE loans
+		SET name = ?, amount = ?, interest_rate = ?, start_date = ?,
+		    fixed_interest_years = ?, repayment_type = ?, repayment_value = ?,
+		    version = version + 1, updated_at = ?
+		WHERE id = ?
+	`, target.Name, target.Amount, target.InterestRate, target.StartDate,
+		target.FixedInterestYears, target.RepaymentType, target.RepaymentValue, now, loanID); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, actorID, loanID, models.AuditEntityLoan, loanID, models.AuditUpdate,
+		loanAuditFields(current), loanAuditFields(target), entryID); err != nil {
+		return err
+	}
+
+	for i := range currentPayments {
+		payment := &currentPayments[i]
+		state, keep := paymentStates[payment.ID]
+		if !keep {
+			if _, err := txExec(ctx, tx, "UPDATE special_payments SET deleted_at = ? WHERE id = ?", now, payment.ID); err != nil {
+				return err
+			}
+			if err := recordAudit(ctx, tx, actorID, loanID, models.AuditEntitySpecialPayment, payment.ID,
+				models.AuditDelete, paymentAuditFields(payment), nil, entryID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		restored := paymentFromAuditFields(payment.ID, loanID, state)
+		if _, err := txExec(ctx, tx, `
+			UPDATE special_payments SET date = ?, amount = ?, note = ?, updated_at = ?
+			WHERE id = ?
+		`, restored.Date, restored.Amount, nullableString(restored.Note), now, payment.ID); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, actorID, loanID, models.AuditEntitySpecialPayment, payment.ID,
+			models.AuditUpdate, paymentAuditFields(payment), paymentAuditFields(restored), entryID); err != nil {
+			return err
+		}
+		delete(paymentStates, payment.ID)
+	}
+
+	// Payments that were deleted after the restored version. They are taken
+	// out of the trash, or inserted again if they have been purged.
+	for id, state := range paymentStates {
+		restored := paymentFromAuditFields(id, loanID, state)
+		if _, err := txExec(ctx, tx, `
+			INSERT INTO special_payments (id, loan_id, date, amount, note, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE
+			SET date = excluded.date, amount = excluded.amount, note = excluded.note,
+			    updated_at = excluded.updated_at, deleted_at = NULL
+		`, id, loanID, restored.Date, restored.Amount, nullableString(restored.Note), now, now); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, actorID, loanID, models.AuditEntitySpecialPayment, id,
+			models.AuditCreate, nil, paymentAuditFields(restored), entryID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// loanFromAuditFields builds a loan from audited field values.
+// Numbers are float64 after a JSON round trip.
+func loanFromAuditFields(id string, fields auditFields) *models.Loan {
+	loan := &models.Loan{ID: id}
+	loan.Name, _ = fields["name"].(string)
+	loan.Amount = auditNumber(fields["amount"])
+	loan.InterestRate = auditNumber(fields["interestRate"])
+	loan.StartDate, _ = fields["startDate"].(string)
+	loan.FixedInterestYears = int(auditNumber(fields["fixedInterestYears"]))
+	loan.RepaymentType, _ = fields["repaymentType"].(string)
+	loan.RepaymentValue = auditNumber(fields["repaymentValue"])
+	return loan
+}
+
+// paymentFromAuditFields builds a special payment from audited field values
+func paymentFromAuditFields(id, loanID string, fields auditFields) *models.SpecialPayment {
+	payment := &models.SpecialPayment{ID: id, LoanID: loanID}
+	payment.Date, _ = fields["date"].(string)
+	payment.Amount = auditNumber(fields["amount"])
+	payment.Note, _ = fields["note"].(string)
+	return payment
+}
+
+// auditNumber converts a numeric field value to float64
+func auditNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// nullableString converts an empty string to nil for proper NULL insertion
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
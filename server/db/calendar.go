@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/models"
+)
+
+// Calendar token queries
+
+// GetCalendarTokens retrieves all calendar tokens of a user (without their secret)
+func GetCalendarTokens(ctx context.Context, userID string) ([]models.CalendarToken, error) {
+	rows, err := queryRows(ctx, `
+		SELECT id, loan_id, created_at, last_used_at
+		FROM calendar_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.CalendarToken{}
+	for rows.Next() {
+		var token models.CalendarToken
+		var loanID, lastUsedAt *string
+
+		if err := rows.Scan(&token.ID, &loanID, &token.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+
+		if loanID != nil {
+			token.LoanID = *loanID
+		}
+		if lastUsedAt != nil {
+			token.LastUsedAt = *lastUsedAt
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// CreateCalendarToken stores a new calendar token of a user. Only the hash
+// of token.Token is persisted.
+func CreateCalendarToken(ctx context.Context, userID string, token *models.CalendarToken) error {
+	var loanValue *string
+	if token.LoanID != "" {
+		// Verify loan exists in a household of the user
+		row := queryRow(ctx, "SELECT id FROM loans WHERE id = ? AND deleted_at IS NULL AND household_id IN ("+memberHouseholds+")", token.LoanID, userID)
+		var loanID string
+		if err := row.Scan(&loanID); err != nil {
+			return notFound(err, ErrLoanNotFound)
+		}
+		loanValue = &token.LoanID
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := execQuery(ctx, `
+		INSERT INTO calendar_tokens (id, token_hash, loan_id, user_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, token.ID, masked(auth.HashToken(token.Token)), loanValue, userID, now)
+
+	if err == nil {
+		token.CreatedAt = now
+		// Force WAL checkpoint to ensure data is persisted
+		if err := forceCheckpoint(ctx); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return err
+}
+
+// UseCalendarToken looks up a token by its secret and records the access.
+// The returned token has an empty LoanID if it covers all loans.
+func UseCalendarToken(ctx context.Context, secret string) (*models.CalendarToken, error) {
+	var token models.CalendarToken
+	var loanID *string
+
+	row := queryRow(ctx, `
+		SELECT id, loan_id, user_id, created_at
+		FROM calendar_tokens
+		WHERE token_hash = ?
+	`, masked(auth.HashToken(secret)))
+	if err := row.Scan(&token.ID, &loanID, &token.UserID, &token.CreatedAt); err != nil {
+		return nil, notFound(err, ErrCalendarTokenNotFound)
+	}
+	if loanID != nil {
+		token.LoanID = *loanID
+	}
+
+	token.LastUsedAt = time.Now().UTC().Format(time.RFC3339)
+	if _, err := execQuery(ctx, "UPDATE calendar_tokens SET last_used_at = ? WHERE id = ?", token.LastUsedAt, token.ID); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// DeleteCalendarToken revokes a calendar token of a user
+func DeleteCalendarToken(ctx context.Context, userID, id string) error {
+	result, err := execQuery(ctx, "DELETE FROM calendar_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrCalendarTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+func TestCreateCalendarTokenErrors(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+
+	token := &models.CalendarToken{ID: uuid.New().String(), LoanID: uuid.New().String(), Token: uuid.New().String()}
+	if err := CreateCalendarToken(ctx, user.ID, token); !errors.Is(err, ErrLoanNotFound) {
+		t.Errorf("unknown loan: err = %v, want ErrLoanNotFound", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	loan := createTestLoan(t, user.ID, user.ID)
+	token.LoanID = loan.ID
+	err := CreateCalendarToken(canceled, user.ID, token)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("canceled query: err = %v, want the query error", err)
+	}
+}
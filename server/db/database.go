@@ -1,22 +1,25 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"log"
-	"os"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	DB    *sql.DB
-	dbMu  sync.Mutex
-	logDB = os.Getenv("LOG_DB_QUERIES") == "true"
+	DB   *sql.DB
+	dbMu sync.Mutex
 )
 
 // InitDB initializes the SQLite database connection pool
-func InitDB(dbPath string) error {
+func InitDB(dbPath string, maxOpenConns, maxIdleConns int) error {
 	dbMu.Lock()
 	defer dbMu.Unlock()
 
@@ -36,11 +39,11 @@ func InitDB(dbPath string) error {
 	}
 
 	// Configure connection pool
-	sqldb.SetMaxOpenConns(25)
-	sqldb.SetMaxIdleConns(5)
+	sqldb.SetMaxOpenConns(maxOpenConns)
+	sqldb.SetMaxIdleConns(maxIdleConns)
 
 	DB = sqldb
-	log.Printf("Database initialized: %s", dbPath)
+	slog.Info("Database initialized", "path", dbPath)
 
 	// Initialize tables
 	if err := initTables(); err != nil {
@@ -49,47 +52,116 @@ func InitDB(dbPath string) error {
 		return err
 	}
 
-	log.Println("Database tables initialized")
+	slog.Info("Database tables initialized")
 	return nil
 }
 
-// Close closes the database connection
+// Close checkpoints the WAL into the database file and closes the
+// database. Queries that have started are finished first.
 func Close() error {
-	if DB != nil {
-		return DB.Close()
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	if DB == nil {
+		return nil
 	}
-	return nil
+	// TRUNCATE also empties the WAL file, so the database file is complete on its own
+	_, checkpointErr := DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	err := DB.Close()
+	if checkpointErr != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", checkpointErr)
+	}
+	return err
 }
 
-// execQuery logs and executes a query
-func execQuery(query string, args ...interface{}) (sql.Result, error) {
-	if logDB {
-		log.Printf("QUERY: %s | ARGS: %v", query, args)
-	}
-	return DB.Exec(query, args...)
+// execQuery logs, times and executes a query
+func execQuery(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return DB.ExecContext(ctx, query, args...)
 }
 
-// queryRow logs and executes a single row query
-func queryRow(query string, args ...interface{}) *sql.Row {
-	if logDB {
-		log.Printf("QUERY: %s | ARGS: %v", query, args)
-	}
-	return DB.QueryRow(query, args...)
+// queryRow logs, times and executes a single row query
+func queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return DB.QueryRowContext(ctx, query, args...)
 }
 
-// queryRows logs and executes a rows query
-func queryRows(query string, args ...interface{}) (*sql.Rows, error) {
-	if logDB {
-		log.Printf("QUERY: %s | ARGS: %v", query, args)
-	}
-	return DB.Query(query, args...)
+// queryRows logs, times and executes a rows query
+func queryRows(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return DB.QueryContext(ctx, query, args...)
+}
+
+// txExec logs, times and executes a query inside a transaction
+func txExec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// txQueryRow logs, times and executes a single row query inside a transaction
+func txQueryRow(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return tx.QueryRowContext(ctx, query, args...)
+}
+
+// txQueryRows logs, times and executes a rows query inside a transaction
+func txQueryRows(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (*sql.Rows, error) {
+	logQuery(ctx, query, args)
+	defer observeQuery(time.Now())
+	return tx.QueryContext(ctx, query, args...)
 }
 
 // forceCheckpoint forces a WAL checkpoint to persist pending writes to disk
-func forceCheckpoint() error {
-	if logDB {
-		log.Println("QUERY: PRAGMA wal_checkpoint(RESTART)")
-	}
-	_, err := DB.Exec("PRAGMA wal_checkpoint(RESTART)")
+func forceCheckpoint(ctx context.Context) error {
+	// The writes are committed, so the checkpoint runs even if the request is cancelled
+	ctx = context.WithoutCancel(ctx)
+	logQuery(ctx, "PRAGMA wal_checkpoint(RESTART)", nil)
+	defer observeQuery(time.Now())
+	_, err := DB.ExecContext(ctx, "PRAGMA wal_checkpoint(RESTART)")
 	return err
 }
+
+// sensitive marks a query argument that is masked in the query log, such
+// as a password or token hash
+type sensitive struct {
+	value driver.Value
+}
+
+// masked marks a value as sensitive. An empty value is stored as NULL.
+func masked(value string) sensitive {
+	if value == "" {
+		return sensitive{}
+	}
+	return sensitive{value}
+}
+
+func (s sensitive) Value() (driver.Value, error) {
+	return s.value, nil
+}
+
+// logQuery logs a query at debug level with the request ID of the context.
+// Sensitive arguments are masked.
+func logQuery(ctx context.Context, query string, args []interface{}) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	logged := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case sensitive:
+			logged[i] = "***"
+		case *string:
+			if v != nil {
+				logged[i] = *v
+			}
+		default:
+			logged[i] = arg
+		}
+	}
+	slog.DebugContext(ctx, "Database query", "query", strings.Join(strings.Fields(query), " "), "args", logged)
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+// openTestDB initializes a fresh database in a temporary directory
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := InitDB(filepath.Join(t.TempDir(), "test.db"), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close()
+		DB = nil
+	})
+}
+
+// createTestUser creates a user, whose personal household has the user's ID
+func createTestUser(t *testing.T, name string) *models.User {
+	t.Helper()
+	user := &models.User{ID: uuid.New().String(), Email: name + "@example.com", Name: name}
+	if err := CreateUser(context.Background(), user, ""); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testLoan returns a valid loan with a new ID that is not stored
+func testLoan(householdID string) *models.Loan {
+	return &models.Loan{
+		ID:                 uuid.New().String(),
+		Name:               "Haus",
+		Amount:             300000,
+		InterestRate:       3.5,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      models.RepaymentTypePercentage,
+		RepaymentValue:     2,
+		HouseholdID:        householdID,
+	}
+}
+
+// createTestLoan creates a loan of the user in a household
+func createTestLoan(t *testing.T, ownerID, householdID string) *models.Loan {
+	t.Helper()
+	loan := testLoan(householdID)
+	if err := CreateLoan(context.Background(), ownerID, loan); err != nil {
+		t.Fatal(err)
+	}
+	return loan
+}
+
+// createTestShareLink shares a loan and logs one access of the link
+func createTestShareLink(t *testing.T, userID, loanID string) *models.ShareLink {
+	t.Helper()
+	ctx := context.Background()
+	link := &models.ShareLink{ID: uuid.New().String(), LoanID: loanID, Token: uuid.New().String()}
+	if err := CreateShareLink(ctx, userID, link, time.Now().Add(time.Hour), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := LogShareAccess(ctx, link.ID, "ok", "203.0.113.5", "test"); err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+// countTestRows counts the rows of a table that match a condition
+func countTestRows(t *testing.T, table, where string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
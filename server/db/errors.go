@@ -0,0 +1,61 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Errors returned by the queries. Every not-found error wraps ErrNotFound,
+// every conflict wraps ErrConflict, every exceeded quota ErrQuotaExceeded and
+// every refused change ErrForbidden, so callers can check either the
+// specific error or its kind with errors.Is.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrConflict      = errors.New("conflict")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrForbidden     = errors.New("forbidden")
+
+	ErrLoanNotFound          = fmt.Errorf("loan %w", ErrNotFound)
+	ErrPaymentNotFound       = fmt.Errorf("special payment %w", ErrNotFound)
+	ErrLoanNotInTrash        = fmt.Errorf("loan %w in trash", ErrNotFound)
+	ErrPaymentNotInTrash     = fmt.Errorf("special payment %w in trash", ErrNotFound)
+	ErrHistoryEntryNotFound  = fmt.Errorf("history entry %w", ErrNotFound)
+	ErrHouseholdNotFound     = fmt.Errorf("household %w", ErrNotFound)
+	ErrMemberNotFound        = fmt.Errorf("member %w", ErrNotFound)
+	ErrInviteNotFound        = fmt.Errorf("invite %w", ErrNotFound)
+	ErrInviteInvalid         = fmt.Errorf("invite %w or expired", ErrNotFound)
+	ErrShareLinkNotFound     = fmt.Errorf("share link %w", ErrNotFound)
+	ErrCalendarTokenNotFound = fmt.Errorf("calendar token %w", ErrNotFound)
+	ErrAPITokenNotFound      = fmt.Errorf("API token %w", ErrNotFound)
+	ErrUserNotFound          = fmt.Errorf("user %w", ErrNotFound)
+	ErrSessionNotFound       = fmt.Errorf("session %w or expired", ErrNotFound)
+
+	ErrVersionConflict = fmt.Errorf("%w: loan has been changed in the meantime", ErrConflict)
+	ErrEmailTaken      = fmt.Errorf("%w: email already registered", ErrConflict)
+	ErrIdentityLinked  = fmt.Errorf("%w: identity already linked to another account", ErrConflict)
+	ErrAccountLinked   = fmt.Errorf("%w: account already linked to another identity", ErrConflict)
+	ErrLastOwner       = fmt.Errorf("%w: a household needs at least one owner", ErrConflict)
+
+	ErrLoanQuotaExceeded    = fmt.Errorf("%w: too many loans", ErrQuotaExceeded)
+	ErrPaymentQuotaExceeded = fmt.Errorf("%w: too many special payments for this loan", ErrQuotaExceeded)
+
+	ErrPersonalHousehold = fmt.Errorf("%w: the personal household of a user cannot be deleted", ErrForbidden)
+)
+
+// notFound turns sql.ErrNoRows into the given not-found error and passes
+// any other error through
+func notFound(err, notFoundErr error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundErr
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is SQLite's UNIQUE constraint error
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
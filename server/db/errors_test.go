@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+// Every query reports a missing row with its sentinel error, never with
+// sql.ErrNoRows, so handlers can map it to a status
+func TestQueriesReturnSentinels(t *testing.T) {
+	openTestDB(t)
+	user := createTestUser(t, "anna")
+	loan := createTestLoan(t, user.ID, user.ID)
+	missing := uuid.New().String()
+
+	tests := []struct {
+		name  string
+		query func(ctx context.Context) error
+		want  error
+	}{
+		{"GetLoan", func(ctx context.Context) error { _, err := GetLoan(ctx, user.ID, missing); return err }, ErrLoanNotFound},
+		{"GetSharedLoan", func(ctx context.Context) error { _, err := GetSharedLoan(ctx, missing); return err }, ErrLoanNotFound},
+		{"GetLoanRole", func(ctx context.Context) error { _, err := GetLoanRole(ctx, user.ID, missing); return err }, ErrLoanNotFound},
+		{"UpdateLoan", func(ctx context.Context) error { return UpdateLoan(ctx, user.ID, &models.Loan{ID: missing}) }, ErrLoanNotFound},
+		{"DeleteLoan", func(ctx context.Context) error { return DeleteLoan(ctx, user.ID, missing, 0) }, ErrLoanNotFound},
+		{"CreateSpecialPayment", func(ctx context.Context) error {
+			return CreateSpecialPayment(ctx, user.ID, &models.SpecialPayment{ID: missing, LoanID: missing})
+		}, ErrLoanNotFound},
+		{"DeleteSpecialPayment", func(ctx context.Context) error { return DeleteSpecialPayment(ctx, user.ID, loan.ID, missing) }, ErrPaymentNotFound},
+		{"RestoreLoan", func(ctx context.Context) error { return RestoreLoan(ctx, user.ID, loan.ID) }, ErrLoanNotInTrash},
+		{"RestoreSpecialPayment", func(ctx context.Context) error { _, err := RestoreSpecialPayment(ctx, user.ID, missing); return err }, ErrPaymentNotInTrash},
+		{"RestoreLoanVersion", func(ctx context.Context) error { return RestoreLoanVersion(ctx, user.ID, loan.ID, 999) }, ErrHistoryEntryNotFound},
+		{"GetHousehold", func(ctx context.Context) error { _, err := GetHousehold(ctx, user.ID, missing); return err }, ErrHouseholdNotFound},
+		{"GetHouseholdRole", func(ctx context.Context) error { _, err := GetHouseholdRole(ctx, user.ID, missing); return err }, ErrHouseholdNotFound},
+		{"UpdateHousehold", func(ctx context.Context) error {
+			return UpdateHousehold(ctx, &models.Household{ID: missing, Name: "x"})
+		}, ErrHouseholdNotFound},
+		{"DeleteHousehold", func(ctx context.Context) error { return DeleteHousehold(ctx, user.ID, missing) }, ErrHouseholdNotFound},
+		{"UpdateHouseholdMemberRole", func(ctx context.Context) error {
+			return UpdateHouseholdMemberRole(ctx, user.ID, missing, models.RoleEditor)
+		}, ErrMemberNotFound},
+		{"RemoveHouseholdMember", func(ctx context.Context) error { return RemoveHouseholdMember(ctx, user.ID, missing) }, ErrMemberNotFound},
+		{"DeleteHouseholdInvite", func(ctx context.Context) error { return DeleteHouseholdInvite(ctx, user.ID, missing) }, ErrInviteNotFound},
+		{"AcceptHouseholdInvite", func(ctx context.Context) error { _, err := AcceptHouseholdInvite(ctx, user.ID, missing); return err }, ErrInviteInvalid},
+		{"RevokeShareLink", func(ctx context.Context) error { return RevokeShareLink(ctx, loan.ID, missing) }, ErrShareLinkNotFound},
+		{"FindShareLink", func(ctx context.Context) error { _, _, err := FindShareLink(ctx, missing); return err }, ErrShareLinkNotFound},
+		{"GetShareAccesses", func(ctx context.Context) error { _, err := GetShareAccesses(ctx, loan.ID, missing); return err }, ErrShareLinkNotFound},
+		{"DeleteCalendarToken", func(ctx context.Context) error { return DeleteCalendarToken(ctx, user.ID, missing) }, ErrCalendarTokenNotFound},
+		{"UseCalendarToken", func(ctx context.Context) error { _, err := UseCalendarToken(ctx, missing); return err }, ErrCalendarTokenNotFound},
+		{"DeleteAPIToken", func(ctx context.Context) error { return DeleteAPIToken(ctx, user.ID, missing) }, ErrAPITokenNotFound},
+		{"UseAPIToken", func(ctx context.Context) error { _, _, err := UseAPIToken(ctx, missing); return err }, ErrAPITokenNotFound},
+		{"GetUserByEmail", func(ctx context.Context) error { _, _, err := GetUserByEmail(ctx, "nobody@example.com"); return err }, ErrUserNotFound},
+		{"GetUserByOIDCSubject", func(ctx context.Context) error {
+			_, err := GetUserByOIDCSubject(ctx, "https://idp", missing)
+			return err
+		}, ErrUserNotFound},
+		{"GetSessionUser", func(ctx context.Context) error { _, err := GetSessionUser(ctx, missing); return err }, ErrSessionNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query(context.Background())
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrNotFound) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("err = %v wraps sql.ErrNoRows", err)
+			}
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	if err := notFound(sql.ErrNoRows, ErrLoanNotFound); err != ErrLoanNotFound {
+		t.Errorf("notFound(sql.ErrNoRows) = %v, want ErrLoanNotFound", err)
+	}
+	other := errors.New("disk I/O error")
+	if err := notFound(other, ErrLoanNotFound); err != other {
+		t.Errorf("notFound(other) = %v, want the error itself", err)
+	}
+	if err := notFound(nil, ErrLoanNotFound); err != nil {
+		t.Errorf("notFound(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+// Export / import queries
+
+// ExportData returns a snapshot of all loans of a household and their special payments
+func ExportData(ctx context.Context, userID, householdID string) (*models.ExportDocument, error) {
+	all, err := GetAllLoans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	loans := []models.Loan{}
+	for _, loan := range all {
+		if loan.HouseholdID != householdID {
+			continue
+		}
+		// The household and role are not part of the document, it can be imported anywhere
+		loan.HouseholdID = ""
+		loan.Role = ""
+		loans = append(loans, loan)
+	}
+
+	return &models.ExportDocument{
+		Version:    models.ExportVersion,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Loans:      loans,
+	}, nil
+}
+
+// ImportData restores loans and special payments of a household from an
+// export document. In replace mode all existing loans of the household,
+// including those in the trash, are removed first with their share links and
+// calendar tokens. In merge mode records with
+// an existing ID are skipped or overwritten depending on onConflict, while
+// records in the trash are restored and overwritten. New loans are recorded as created by
+// the user. Records whose ID is taken outside the household get a new ID,
+// so an import does not reveal which IDs exist. The whole import runs in one
+// transaction.
+func ImportData(ctx context.Context, userID, householdID string, doc *models.ExportDocument, mode, onConflict string) (*models.ImportResult, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &models.ImportResult{Mode: mode}
+
+	if mode == models.ImportModeReplace {
+		if err := auditLoanDeletes(ctx, tx, userID, householdID); err != nil {
+			return nil, err
+		}
+		if _, err := deleteLoans(ctx, tx, "SELECT id FROM loans WHERE household_id = ?", householdID); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	for i := range doc.Loans {
+		loan := &doc.Loans[i]
+		createdAt, updatedAt := importTimestamps(loan.CreatedAt, loan.UpdatedAt, now)
+
+		var existingHousehold, deletedAt *string
+		err := txQueryRow(ctx, tx, "SELECT household_id, deleted_at FROM loans WHERE id = ?", loan.ID).Scan(&existingHousehold, &deletedAt)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		exists := err == nil
+		if exists && (existingHousehold == nil || *existingHousehold != householdID) {
+			loan.ID = uuid.New().String()
+			exists = false
+		}
+		trashed := exists && deletedAt != nil
+
+		touched := false
+		switch {
+		case !exists:
+			if _, err := txExec(ctx, tx, `
+				INSERT INTO loans (id, name, amount, interest_rate, start_date, fixed_interest_years,
+				                   repayment_type, repayment_value, owner_id, household_id, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, loan.ID, loan.Name, loan.Amount, loan.InterestRate, loan.StartDate,
+				loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue, userID, householdID,
+				createdAt, updatedAt); err != nil {
+				return nil, err
+			}
+			if err := recordAudit(ctx, tx, userID, loan.ID, models.AuditEntityLoan, loan.ID, models.AuditCreate,
+				nil, loanAuditFields(loan), 0); err != nil {
+				return nil, err
+			}
+			result.LoansCreated++
+			touched = true
+		case trashed || onConflict == models.ConflictOverwrite:
+			before, err := txLoan(ctx, tx, loan.ID)
+			if err != nil {
+				return nil, err
+			}
+			if trashed {
+				if err := recordAudit(ctx, tx, userID, loan.ID, models.AuditEntityLoan, loan.ID, models.AuditRestore,
+					nil, loanAuditFields(before), 0); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := txExec(ctx, tx, `
+				UPDATE loans
+				SET name = ?, amount = ?, interest_rate = ?, start_date = ?,
+				    fixed_interest_years = ?, repayment_type = ?, repayment_value = ?,
+				    version = version + 1, created_at = ?, updated_at = ?, deleted_at = NULL
+				WHERE id = ? AND household_id = ?
+			`, loan.Name, loan.Amount, loan.InterestRate, loan.StartDate,
+				loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue,
+				createdAt, updatedAt, loan.ID, householdID); err != nil {
+				return nil, err
+			}
+			if err := recordAudit(ctx, tx, userID, loan.ID, models.AuditEntityLoan, loan.ID, models.AuditUpdate,
+				loanAuditFields(before), loanAuditFields(loan), 0); err != nil {
+				return nil, err
+			}
+			if trashed {
+				result.LoansCreated++
+			} else {
+				result.LoansUpdated++
+			}
+			touched = true
+		default:
+			result.LoansSkipped++
+		}
+
+		paymentsChanged := result.PaymentsCreated + result.PaymentsUpdated
+		for j := range loan.SpecialPayments {
+			if err := importSpecialPayment(ctx, tx, userID, loan.ID, &loan.SpecialPayments[j], onConflict, now, result); err != nil {
+				return nil, err
+			}
+		}
+		// A skipped loan still gets a new version when its payments changed
+		if !touched && result.PaymentsCreated+result.PaymentsUpdated != paymentsChanged {
+			if err := touchLoan(ctx, tx, loan.ID, now); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkPaymentQuota(ctx, tx, loan.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkLoanQuota(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+
+	return result, nil
+}
+
+// importSpecialPayment inserts or merges a single special payment of an imported loan
+func importSpecialPayment(ctx context.Context, tx *sql.Tx, userID, loanID string, payment *models.SpecialPayment, onConflict, now string, result *models.ImportResult) error {
+	createdAt, updatedAt := importTimestamps(payment.CreatedAt, payment.UpdatedAt, now)
+
+	// Convert empty note to nil for proper NULL insertion
+	var noteValue *string
+	if payment.Note != "" {
+		noteValue = &payment.Note
+	}
+
+	var existingLoanID string
+	var deletedAt *string
+	err := txQueryRow(ctx, tx, "SELECT loan_id, deleted_at FROM special_payments WHERE id = ?", payment.ID).Scan(&existingLoanID, &deletedAt)
+	if err == nil && existingLoanID != loanID {
+		// The ID is taken by a payment of another loan, maybe in another household
+		payment.ID = uuid.New().String()
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		if _, err := txExec(ctx, tx, `
+			INSERT INTO special_payments (id, loan_id, date, amount, note, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, payment.ID, loanID, payment.Date, payment.Amount, noteValue, createdAt, updatedAt); err != nil {
+			return err
+		}
+		if err := recordAudit(ctx, tx, userID, loanID, models.AuditEntitySpecialPayment, payment.ID,
+			models.AuditCreate, nil, paymentAuditFields(payment), 0); err != nil {
+			return err
+		}
+		result.PaymentsCreated++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	trashed := deletedAt != nil
+	if !trashed && onConflict != models.ConflictOverwrite {
+		result.PaymentsSkipped++
+		return nil
+	}
+
+	var before models.SpecialPayment
+	if err := txQueryRow(ctx, tx, "SELECT date, amount, COALESCE(note, '') FROM special_payments WHERE id = ?",
+		payment.ID).Scan(&before.Date, &before.Amount, &before.Note); err != nil {
+		return err
+	}
+	if trashed {
+		if err := recordAudit(ctx, tx, userID, loanID, models.AuditEntitySpecialPayment, payment.ID,
+			models.AuditRestore, nil, paymentAuditFields(&before), 0); err != nil {
+			return err
+		}
+	}
+
+	if _, err := txExec(ctx, tx, `
+		UPDATE special_payments
+		SET date = ?, amount = ?, note = ?, created_at = ?, updated_at = ?, deleted_at = NULL
+		WHERE id = ?
+	`, payment.Date, payment.Amount, noteValue, createdAt, updatedAt, payment.ID); err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, userID, loanID, models.AuditEntitySpecialPayment, payment.ID,
+		models.AuditUpdate, paymentAuditFields(&before), paymentAuditFields(payment), 0); err != nil {
+		return err
+	}
+	if trashed {
+		result.PaymentsCreated++
+	} else {
+		result.PaymentsUpdated++
+	}
+	return nil
+}
+
+// importTimestamps keeps the exported timestamps and falls back to now for missing ones
+func importTimestamps(createdAt, updatedAt, now string) (string, string) {
+	if createdAt == "" {
+		createdAt = now
+	}
+	if updatedAt == "" {
+		updatedAt = createdAt
+	}
+	return createdAt, updatedAt
+}
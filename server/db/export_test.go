@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+func TestImportReplaceDeletesDependents(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	old := createTestLoan(t, user.ID, user.ID)
+	link := createTestShareLink(t, user.ID, old.ID)
+	token := &models.CalendarToken{ID: uuid.New().String(), LoanID: old.ID, Token: uuid.New().String()}
+	if err := CreateCalendarToken(ctx, user.ID, token); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := &models.ExportDocument{Version: models.ExportVersion, Loans: []models.Loan{*testLoan("")}}
+	result, err := ImportData(ctx, user.ID, user.ID, doc, models.ImportModeReplace, models.ConflictSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.LoansCreated != 1 {
+		t.Errorf("LoansCreated = %d, want 1", result.LoansCreated)
+	}
+
+	remaining := []struct {
+		table, where string
+		arg          string
+	}{
+		{"loans", "id = ?", old.ID},
+		{"calendar_tokens", "loan_id = ?", old.ID},
+		{"share_links", "loan_id = ?", old.ID},
+		{"share_accesses", "share_link_id = ?", link.ID},
+	}
+	for _, r := range remaining {
+		if n := countTestRows(t, r.table, r.where, r.arg); n != 0 {
+			t.Errorf("%d rows left in %s", n, r.table)
+		}
+	}
+	if n := countTestRows(t, "audit_log", "loan_id = ? AND operation = ?", old.ID, models.AuditDelete); n != 1 {
+		t.Errorf("%d delete entries for the replaced loan, want 1", n)
+	}
+}
+
+func TestImportRenamesForeignIDs(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	anna := createTestUser(t, "anna")
+	ben := createTestUser(t, "ben")
+	foreign := createTestLoan(t, ben.ID, ben.ID)
+	payment := &models.SpecialPayment{ID: uuid.New().String(), LoanID: foreign.ID, Date: "2025-01-01", Amount: 1000}
+	if err := CreateSpecialPayment(ctx, ben.ID, payment); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := *foreign
+	imported.Name = "Kopie"
+	imported.SpecialPayments = []models.SpecialPayment{*payment}
+	doc := &models.ExportDocument{Version: models.ExportVersion, Loans: []models.Loan{imported}}
+	result, err := ImportData(ctx, anna.ID, anna.ID, doc, models.ImportModeMerge, models.ConflictOverwrite)
+	if err != nil {
+		t.Fatalf("import of a foreign ID failed: %v", err)
+	}
+	if result.LoansCreated != 1 || result.PaymentsCreated != 1 {
+		t.Errorf("result = %+v, want one created loan and payment", result)
+	}
+
+	if n := countTestRows(t, "loans", "household_id = ? AND id != ?", anna.ID, foreign.ID); n != 1 {
+		t.Errorf("%d loans with a new ID in the importing household, want 1", n)
+	}
+	loan, err := GetLoan(ctx, ben.ID, foreign.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loan.Name != foreign.Name || len(loan.SpecialPayments) != 1 || loan.SpecialPayments[0].ID != payment.ID {
+		t.Errorf("the foreign loan was changed: %+v", loan)
+	}
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Ping checks that the database can be reached
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database not initialized")
+	}
+	return DB.PingContext(ctx)
+}
+
+// CheckSchema checks that all migrations have been applied
+func CheckSchema(ctx context.Context) error {
+	var version int
+	if err := queryRow(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		return fmt.Errorf("schema version %d, expected %d", version, len(migrations))
+	}
+	return nil
+}
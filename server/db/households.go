@@ -0,0 +1,470 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/models"
+)
+
+// Household, member and invite queries
+
+// memberHouseholds selects the households a user belongs to
+const memberHouseholds = `SELECT household_id FROM household_members WHERE user_id = ?`
+
+// editableHouseholds selects the households in which a user may change loans
+const editableHouseholds = `SELECT household_id FROM household_members WHERE user_id = ? AND role IN ('owner', 'editor')`
+
+// GetHouseholds retrieves all households of a user with the user's role
+func GetHouseholds(ctx context.Context, userID string) ([]models.Household, error) {
+	rows, err := queryRows(ctx, `
+		SELECT h.id, h.name, m.role, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id
+		WHERE m.user_id = ?
+		ORDER BY h.created_at ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	households := []models.Household{}
+	for rows.Next() {
+		var household models.Household
+		if err := rows.Scan(&household.ID, &household.Name, &household.Role,
+			&household.CreatedAt, &household.UpdatedAt); err != nil {
+			return nil, err
+		}
+		households = append(households, household)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return households, nil
+}
+
+// GetHousehold retrieves a household the user is a member of
+func GetHousehold(ctx context.Context, userID, id string) (*models.Household, error) {
+	var household models.Household
+
+	row := queryRow(ctx, `
+		SELECT h.id, h.name, m.role, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members m ON m.household_id = h.id
+		WHERE h.id = ? AND m.user_id = ?
+	`, id, userID)
+
+	if err := row.Scan(&household.ID, &household.Name, &household.Role,
+		&household.CreatedAt, &household.UpdatedAt); err != nil {
+		return nil, notFound(err, ErrHouseholdNotFound)
+	}
+
+	return &household, nil
+}
+
+// GetHouseholdRole retrieves the role of a user in a household
+func GetHouseholdRole(ctx context.Context, userID, householdID string) (string, error) {
+	var role string
+	err := queryRow(ctx, `
+		SELECT role FROM household_members WHERE household_id = ? AND user_id = ?
+	`, householdID, userID).Scan(&role)
+	return role, notFound(err, ErrHouseholdNotFound)
+}
+
+// GetLoanRole retrieves the role of a user in the household of a loan
+func GetLoanRole(ctx context.Context, userID, loanID string) (string, error) {
+	var role string
+	err := queryRow(ctx, `
+		SELECT m.role
+		FROM loans l
+		JOIN household_members m ON m.household_id = l.household_id
+		WHERE l.id = ? AND m.user_id = ? AND l.deleted_at IS NULL
+	`, loanID, userID).Scan(&role)
+	return role, notFound(err, ErrLoanNotFound)
+}
+
+// GetDefaultHouseholdID returns the household new loans of a user go to:
+// the personal household if the user is still a member, otherwise the
+// oldest household in which the user may change loans
+func GetDefaultHouseholdID(ctx context.Context, userID string) (string, error) {
+	var id string
+	err := queryRow(ctx, `
+		SELECT household_id
+		FROM household_members
+		WHERE user_id = ? AND role IN ('owner', 'editor')
+		ORDER BY household_id = user_id DESC, created_at ASC
+		LIMIT 1
+	`, userID).Scan(&id)
+	return id, notFound(err, ErrHouseholdNotFound)
+}
+
+// CreateHousehold inserts a new household with the user as owner
+func CreateHousehold(ctx context.Context, userID string, household *models.Household) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := txExec(ctx, tx, `
+		INSERT INTO households (id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, household.ID, household.Name, now, now); err != nil {
+		return err
+	}
+	if _, err := txExec(ctx, tx, `
+		INSERT INTO household_members (household_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, household.ID, userID, models.RoleOwner, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	household.Role = models.RoleOwner
+	household.CreatedAt = now
+	household.UpdatedAt = now
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// UpdateHousehold renames a household
+func UpdateHousehold(ctx context.Context, household *models.Household) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := execQuery(ctx, `
+		UPDATE households SET name = ?, updated_at = ? WHERE id = ?
+	`, household.Name, now, household.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrHouseholdNotFound
+	}
+
+	household.UpdatedAt = now
+	return nil
+}
+
+// DeleteHousehold deletes a household with its loans, special payments,
+// members and invites. The loan deletions are recorded in the audit log
+// under the given actor. The personal household of a user, which has the
+// ID of the user, cannot be deleted.
+func DeleteHousehold(ctx context.Context, actorID, id string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var personal bool
+	if err := txQueryRow(ctx, tx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = households.id) FROM households WHERE id = ?",
+		id).Scan(&personal); err != nil {
+		return notFound(err, ErrHouseholdNotFound)
+	}
+	if personal {
+		return ErrPersonalHousehold
+	}
+
+	// Record the deletions before the loans are gone
+	if err := auditLoanDeletes(ctx, tx, actorID, id); err != nil {
+		return err
+	}
+	if _, err := deleteLoans(ctx, tx, "SELECT id FROM loans WHERE household_id = ?", id); err != nil {
+		return err
+	}
+
+	// Delete the household last, foreign keys are not enforced on every connection
+	statements := []string{
+		"DELETE FROM household_members WHERE household_id = ?",
+		"DELETE FROM household_invites WHERE household_id = ?",
+		"DELETE FROM households WHERE id = ?",
+	}
+	for _, stmt := range statements {
+		if _, err := txExec(ctx, tx, stmt, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// GetHouseholdMembers retrieves all members of a household
+func GetHouseholdMembers(ctx context.Context, householdID string) ([]models.HouseholdMember, error) {
+	rows, err := queryRows(ctx, `
+		SELECT u.id, u.email, u.name, m.role, m.created_at
+		FROM household_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.household_id = ?
+		ORDER BY m.created_at ASC
+	`, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.HouseholdMember{}
+	for rows.Next() {
+		var member models.HouseholdMember
+		if err := rows.Scan(&member.UserID, &member.Email, &member.Name,
+			&member.Role, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// UpdateHouseholdMemberRole changes the role of a member. The last owner
+// of a household cannot be demoted.
+func UpdateHouseholdMemberRole(ctx context.Context, householdID, userID, role string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != models.RoleOwner {
+		if err := ensureOtherOwner(ctx, tx, householdID, userID); err != nil {
+			return err
+		}
+	}
+
+	result, err := txExec(ctx, tx, `
+		UPDATE household_members SET role = ? WHERE household_id = ? AND user_id = ?
+	`, role, householdID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	return tx.Commit()
+}
+
+// RemoveHouseholdMember removes a member from a household. The last owner
+// cannot be removed.
+func RemoveHouseholdMember(ctx context.Context, householdID, userID string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureOtherOwner(ctx, tx, householdID, userID); err != nil {
+		return err
+	}
+
+	result, err := txExec(ctx, tx, `
+		DELETE FROM household_members WHERE household_id = ? AND user_id = ?
+	`, householdID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrMemberNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// ensureOtherOwner returns a conflict error if the user is the only owner of the household
+func ensureOtherOwner(ctx context.Context, tx *sql.Tx, householdID, userID string) error {
+	var role string
+	err := txQueryRow(ctx, tx, `
+		SELECT role FROM household_members WHERE household_id = ? AND user_id = ?
+	`, householdID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if role != models.RoleOwner {
+		return nil
+	}
+
+	var otherOwners int
+	if err := txQueryRow(ctx, tx, `
+		SELECT COUNT(*) FROM household_members
+		WHERE household_id = ? AND role = ? AND user_id != ?
+	`, householdID, models.RoleOwner, userID).Scan(&otherOwners); err != nil {
+		return err
+	}
+	if otherOwners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// GetHouseholdInvites retrieves the open invites of a household (without their secret)
+func GetHouseholdInvites(ctx context.Context, householdID string) ([]models.HouseholdInvite, error) {
+	rows, err := queryRows(ctx, `
+		SELECT id, household_id, role, expires_at, created_at
+		FROM household_invites
+		WHERE household_id = ? AND expires_at > ?
+		ORDER BY created_at DESC
+	`, householdID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []models.HouseholdInvite{}
+	for rows.Next() {
+		var invite models.HouseholdInvite
+		if err := rows.Scan(&invite.ID, &invite.HouseholdID, &invite.Role,
+			&invite.ExpiresAt, &invite.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invites, nil
+}
+
+// CreateHouseholdInvite stores a new invite. Only the hash of invite.Token is persisted.
+func CreateHouseholdInvite(ctx context.Context, createdBy string, invite *models.HouseholdInvite) error {
+	now := time.Now().UTC()
+	invite.CreatedAt = now.Format(time.RFC3339)
+	invite.ExpiresAt = now.Add(models.InviteDuration).Format(time.RFC3339)
+
+	_, err := execQuery(ctx, `
+		INSERT INTO household_invites (id, token_hash, household_id, role, created_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, invite.ID, masked(auth.HashToken(invite.Token)), invite.HouseholdID, invite.Role,
+		createdBy, invite.ExpiresAt, invite.CreatedAt)
+
+	if err == nil {
+		// Force WAL checkpoint to ensure data is persisted
+		if err := forceCheckpoint(ctx); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return err
+}
+
+// DeleteHouseholdInvite revokes an invite of a household
+func DeleteHouseholdInvite(ctx context.Context, householdID, id string) error {
+	result, err := execQuery(ctx, "DELETE FROM household_invites WHERE id = ? AND household_id = ?", id, householdID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+
+	return nil
+}
+
+// AcceptHouseholdInvite adds the user to the household of an invite and
+// consumes the invite. Members keep their current role.
+func AcceptHouseholdInvite(ctx context.Context, userID, secret string) (*models.Household, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var inviteID, householdID, role string
+	err = txQueryRow(ctx, tx, `
+		SELECT id, household_id, role
+		FROM household_invites
+		WHERE token_hash = ? AND expires_at > ?
+	`, masked(auth.HashToken(secret)), time.Now().UTC().Format(time.RFC3339)).Scan(&inviteID, &householdID, &role)
+	if err == sql.ErrNoRows {
+		return nil, ErrInviteInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var existingRole string
+	err = txQueryRow(ctx, tx, `
+		SELECT role FROM household_members WHERE household_id = ? AND user_id = ?
+	`, householdID, userID).Scan(&existingRole)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err == sql.ErrNoRows {
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := txExec(ctx, tx, `
+			INSERT INTO household_members (household_id, user_id, role, created_at)
+			VALUES (?, ?, ?, ?)
+		`, householdID, userID, role, now); err != nil {
+			return nil, err
+		}
+		if _, err := txExec(ctx, tx, "DELETE FROM household_invites WHERE id = ?", inviteID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+
+	return GetHousehold(ctx, userID, householdID)
+}
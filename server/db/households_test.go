@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+func TestDeleteHousehold(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	household := &models.Household{ID: uuid.New().String(), Name: "Familie"}
+	if err := CreateHousehold(ctx, user.ID, household); err != nil {
+		t.Fatal(err)
+	}
+	loan := createTestLoan(t, user.ID, household.ID)
+	link := createTestShareLink(t, user.ID, loan.ID)
+
+	if err := DeleteHousehold(ctx, user.ID, user.ID); !errors.Is(err, ErrPersonalHousehold) {
+		t.Errorf("personal household: err = %v, want ErrPersonalHousehold", err)
+	}
+	if err := DeleteHousehold(ctx, user.ID, uuid.New().String()); !errors.Is(err, ErrHouseholdNotFound) {
+		t.Errorf("unknown household: err = %v, want ErrHouseholdNotFound", err)
+	}
+
+	if err := DeleteHousehold(ctx, user.ID, household.ID); err != nil {
+		t.Fatal(err)
+	}
+	remaining := []struct {
+		table, where, arg string
+	}{
+		{"households", "id = ?", household.ID},
+		{"household_members", "household_id = ?", household.ID},
+		{"loans", "id = ?", loan.ID},
+		{"share_links", "id = ?", link.ID},
+		{"share_accesses", "share_link_id = ?", link.ID},
+	}
+	for _, r := range remaining {
+		if n := countTestRows(t, r.table, r.where, r.arg); n != 0 {
+			t.Errorf("%d rows left in %s", n, r.table)
+		}
+	}
+	if n := countTestRows(t, "audit_log", "loan_id = ? AND operation = ?", loan.ID, models.AuditDelete); n != 1 {
+		t.Errorf("%d delete entries for the loan, want 1", n)
+	}
+	if n := countTestRows(t, "households", "id = ?", user.ID); n != 1 {
+		t.Error("the personal household was deleted")
+	}
+}
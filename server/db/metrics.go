@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/metrics"
+)
+
+var queryDuration = metrics.NewHistogramVec("baufi_db_query_duration_seconds",
+	"Duration of database queries by the db function that issued them, until the first row is available; reading the rows is not included.",
+	metrics.DBBuckets, "function")
+
+func init() {
+	metrics.NewGaugeFunc("baufi_loans", "Number of loans, not counting the trash.", func() (float64, error) {
+		return countRows("SELECT COUNT(*) FROM loans WHERE deleted_at IS NULL")
+	})
+	metrics.NewGaugeFunc("baufi_special_payments", "Number of special payments of loans, not counting the trash.", func() (float64, error) {
+		return countRows(`SELECT COUNT(*) FROM special_payments p
+			JOIN loans l ON l.id = p.loan_id
+			WHERE p.deleted_at IS NULL AND l.deleted_at IS NULL`)
+	})
+}
+
+// countRows runs a COUNT query for a gauge
+func countRows(query string) (float64, error) {
+	var count int64
+	if err := queryRow(context.Background(), query).Scan(&count); err != nil {
+		return 0, err
+	}
+	return float64(count), nil
+}
+
+// observeQuery records the duration of a query since start under the name
+// of the function that called the query helper, e.g. "GetLoan", or
+// "countRows" for the queries of the gauges. For row queries it ends when the
+// driver returns the rows, before they are scanned.
+func observeQuery(start time.Time) {
+	duration := time.Since(start).Seconds()
+	function := "unknown"
+	// Skip observeQuery and the query helper
+	if pc, _, _, ok := runtime.Caller(2); ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			name := fn.Name()[strings.LastIndex(fn.Name(), "/")+1:]
+			_, function, _ = strings.Cut(name, ".")
+		}
+	}
+	queryDuration.Observe(duration, function)
+}
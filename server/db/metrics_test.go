@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"baufi-optimierer/server/metrics"
+)
+
+// Query durations are recorded under the db function that ran the query
+func TestObserveQueryNamesCaller(t *testing.T) {
+	openTestDB(t)
+	user := createTestUser(t, "anna")
+	loan := createTestLoan(t, user.ID, user.ID)
+	if _, err := GetLoan(context.Background(), user.ID, loan.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := countRows("SELECT COUNT(*) FROM loans"); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, function := range []string{"GetLoan", "CreateLoan", "countRows"} {
+		series := `baufi_db_query_duration_seconds_count{function="` + function + `"}`
+		if !strings.Contains(w.Body.String(), series) {
+			t.Errorf("no series %s", series)
+		}
+	}
+	if strings.Contains(w.Body.String(), `function="unknown"`) {
+		t.Error("a query was recorded without its function")
+	}
+}
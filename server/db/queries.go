@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -9,14 +11,17 @@ import (
 
 // Loans queries
 
-// GetAllLoans retrieves all loans with their special payments
-func GetAllLoans() ([]models.Loan, error) {
-	rows, err := queryRows(`
-		SELECT id, name, amount, interest_rate, start_date, fixed_interest_years,
-		       repayment_type, repayment_value, created_at, updated_at
-		FROM loans
-		ORDER BY created_at DESC
-	`)
+// GetAllLoans retrieves the loans of all households of a user with their
+// special payments and the user's role
+func GetAllLoans(ctx context.Context, userID string) ([]models.Loan, error) {
+	rows, err := queryRows(ctx, `
+		SELECT l.id, l.name, l.amount, l.interest_rate, l.start_date, l.fixed_interest_years,
+		       l.repayment_type, l.repayment_value, l.version, l.household_id, m.role, l.created_at, l.updated_at
+		FROM loans l
+		JOIN household_members m ON m.household_id = l.household_id
+		WHERE m.user_id = ? AND l.deleted_at IS NULL
+		ORDER BY l.created_at DESC
+	`, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +35,7 @@ func GetAllLoans() ([]models.Loan, error) {
 		if err := rows.Scan(
 			&loan.ID, &loan.Name, &loan.Amount, &loan.InterestRate,
 			&loan.StartDate, &loan.FixedInterestYears, &loan.RepaymentType,
-			&loan.RepaymentValue, &createdAt, &updatedAt,
+			&loan.RepaymentValue, &loan.Version, &loan.HouseholdID, &loan.Role, &createdAt, &updatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -39,7 +44,7 @@ func GetAllLoans() ([]models.Loan, error) {
 		loan.UpdatedAt = updatedAt
 
 		// Get special payments for this loan
-		payments, err := GetSpecialPayments(loan.ID)
+		payments, err := GetSpecialPayments(ctx, loan.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -55,31 +60,33 @@ func GetAllLoans() ([]models.Loan, error) {
 	return loans, nil
 }
 
-// GetLoan retrieves a single loan with all its special payments
-func GetLoan(id string) (*models.Loan, error) {
+// GetLoan retrieves a single loan from a household of the user with all
+// its special payments and the user's role
+func GetLoan(ctx context.Context, userID, id string) (*models.Loan, error) {
 	var loan models.Loan
 	var createdAt, updatedAt string
 
-	row := queryRow(`
-		SELECT id, name, amount, interest_rate, start_date, fixed_interest_years,
-		       repayment_type, repayment_value, created_at, updated_at
-		FROM loans
-		WHERE id = ?
-	`, id)
+	row := queryRow(ctx, `
+		SELECT l.id, l.name, l.amount, l.interest_rate, l.start_date, l.fixed_interest_years,
+		       l.repayment_type, l.repayment_value, l.version, l.household_id, m.role, l.created_at, l.updated_at
+		FROM loans l
+		JOIN household_members m ON m.household_id = l.household_id
+		WHERE l.id = ? AND m.user_id = ? AND l.deleted_at IS NULL
+	`, id, userID)
 
 	if err := row.Scan(
 		&loan.ID, &loan.Name, &loan.Amount, &loan.InterestRate,
 		&loan.StartDate, &loan.FixedInterestYears, &loan.RepaymentType,
-		&loan.RepaymentValue, &createdAt, &updatedAt,
+		&loan.RepaymentValue, &loan.Version, &loan.HouseholdID, &loan.Role, &createdAt, &updatedAt,
 	); err != nil {
-		return nil, err
+		return nil, notFound(err, ErrLoanNotFound)
 	}
 
 	loan.CreatedAt = createdAt
 	loan.UpdatedAt = updatedAt
 
 	// Get special payments for this loan
-	payments, err := GetSpecialPayments(id)
+	payments, err := GetSpecialPayments(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -88,84 +95,182 @@ func GetLoan(id string) (*models.Loan, error) {
 	return &loan, nil
 }
 
-// CreateLoan inserts a new loan
-func CreateLoan(loan *models.Loan) error {
+// GetSharedLoan retrieves a loan with all its special payments regardless of
+// its household. It is used for share links, which carry their own access check.
+func GetSharedLoan(ctx context.Context, id string) (*models.Loan, error) {
+	var loan models.Loan
+
+	row := queryRow(ctx, `
+		SELECT id, name, amount, interest_rate, start_date, fixed_interest_years,
+		       repayment_type, repayment_value, version, created_at, updated_at
+		FROM loans
+		WHERE id = ? AND deleted_at IS NULL
+	`, id)
+
+	if err := row.Scan(
+		&loan.ID, &loan.Name, &loan.Amount, &loan.InterestRate,
+		&loan.StartDate, &loan.FixedInterestYears, &loan.RepaymentType,
+		&loan.RepaymentValue, &loan.Version, &loan.CreatedAt, &loan.UpdatedAt,
+	); err != nil {
+		return nil, notFound(err, ErrLoanNotFound)
+	}
+
+	payments, err := GetSpecialPayments(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	loan.SpecialPayments = payments
+
+	return &loan, nil
+}
+
+// CreateLoan inserts a new loan into loan.HouseholdID. The user is recorded as its creator.
+func CreateLoan(ctx context.Context, ownerID string, loan *models.Loan) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := execQuery(`
+	_, err = txExec(ctx, tx, `
 		INSERT INTO loans (id, name, amount, interest_rate, start_date, fixed_interest_years,
-		                   repayment_type, repayment_value, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		                   repayment_type, repayment_value, owner_id, household_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, loan.ID, loan.Name, loan.Amount, loan.InterestRate, loan.StartDate,
-		loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue, now, now)
-
-	if err == nil {
-		loan.CreatedAt = now
-		loan.UpdatedAt = now
-		loan.SpecialPayments = []models.SpecialPayment{}
-		// Force WAL checkpoint to ensure data is persisted
-		if err := forceCheckpoint(); err != nil {
-			return fmt.Errorf("failed to checkpoint database: %w", err)
-		}
+		loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue, ownerID, loan.HouseholdID, now, now)
+	if err != nil {
+		return err
 	}
-	return err
+	if err := checkLoanQuota(ctx, tx, ownerID); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, tx, ownerID, loan.ID, models.AuditEntityLoan, loan.ID, models.AuditCreate,
+		nil, loanAuditFields(loan), 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	loan.Version = 1
+	loan.CreatedAt = now
+	loan.UpdatedAt = now
+	loan.SpecialPayments = []models.SpecialPayment{}
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
 }
 
-// UpdateLoan updates an existing loan
-func UpdateLoan(loan *models.Loan) error {
+// UpdateLoan updates an existing loan in a household where the user is owner
+// or editor. The update only succeeds if the stored version still equals
+// loan.Version, which is then incremented.
+func UpdateLoan(ctx context.Context, userID string, loan *models.Loan) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existingID string
+	if err := txQueryRow(ctx, tx, "SELECT id FROM loans WHERE id = ? AND deleted_at IS NULL AND household_id IN ("+editableHouseholds+")",
+		loan.ID, userID).Scan(&existingID); err != nil {
+		return notFound(err, ErrLoanNotFound)
+	}
+	before, err := txLoan(ctx, tx, loan.ID)
+	if err != nil {
+		return err
+	}
+
+	// The version check is part of the update, so a concurrent change cannot slip in between
 	now := time.Now().UTC().Format(time.RFC3339)
-	result, err := execQuery(`
+	result, err := txExec(ctx, tx, `
 		UPDATE loans
 		SET name = ?, amount = ?, interest_rate = ?, start_date = ?,
 		    fixed_interest_years = ?, repayment_type = ?, repayment_value = ?,
-		    updated_at = ?
-		WHERE id = ?
+		    version = version + 1, updated_at = ?
+		WHERE id = ? AND version = ?
 	`, loan.Name, loan.Amount, loan.InterestRate, loan.StartDate,
-		loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue, now, loan.ID)
-
+		loan.FixedInterestYears, loan.RepaymentType, loan.RepaymentValue, now, loan.ID, loan.Version)
 	if err != nil {
 		return err
 	}
-
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
 	if rowsAffected == 0 {
-		return fmt.Errorf("loan not found")
+		return ErrVersionConflict
 	}
 
+	if err := recordAudit(ctx, tx, userID, loan.ID, models.AuditEntityLoan, loan.ID, models.AuditUpdate,
+		loanAuditFields(before), loanAuditFields(loan), 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	loan.Version++
 	loan.UpdatedAt = now
 	return nil
 }
 
-// DeleteLoan deletes a loan (cascades to special_payments)
-func DeleteLoan(id string) error {
-	result, err := execQuery("DELETE FROM loans WHERE id = ?", id)
+// DeleteLoan moves a loan in a household where the user is owner or editor
+// to the trash. Its special payments are hidden with it and come back when
+// the loan is restored. A version other than 0 must match the stored version.
+func DeleteLoan(ctx context.Context, userID, id string, version int) error {
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var existingID string
+	if err := txQueryRow(ctx, tx, "SELECT id FROM loans WHERE id = ? AND deleted_at IS NULL AND household_id IN ("+editableHouseholds+")",
+		id, userID).Scan(&existingID); err != nil {
+		return notFound(err, ErrLoanNotFound)
+	}
+	before, err := txLoan(ctx, tx, id)
 	if err != nil {
 		return err
 	}
 
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := txExec(ctx, tx, "UPDATE loans SET deleted_at = ?, version = version + 1 WHERE id = ? AND (? = 0 OR version = ?)",
+		now, id, version, version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
 	if rowsAffected == 0 {
-		return fmt.Errorf("loan not found")
+		return ErrVersionConflict
 	}
 
-	return nil
+	if err := recordAudit(ctx, tx, userID, id, models.AuditEntityLoan, id, models.AuditDelete,
+		loanAuditFields(before), nil, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // Special Payments queries
 
 // GetSpecialPayments retrieves all special payments for a loan
-func GetSpecialPayments(loanID string) ([]models.SpecialPayment, error) {
-	rows, err := queryRows(`
+func GetSpecialPayments(ctx context.Context, loanID string) ([]models.SpecialPayment, error) {
+	rows, err := queryRows(ctx, `
 		SELECT id, loan_id, date, amount, note, created_at, updated_at
 		FROM special_payments
-		WHERE loan_id = ?
+		WHERE loan_id = ? AND deleted_at IS NULL
 		ORDER BY date ASC
 	`, loanID)
 
@@ -200,61 +305,101 @@ func GetSpecialPayments(loanID string) ([]models.SpecialPayment, error) {
 	return payments, nil
 }
 
-// CreateSpecialPayment inserts a new special payment
-func CreateSpecialPayment(payment *models.SpecialPayment) error {
-	// Verify loan exists
-	row := queryRow("SELECT id FROM loans WHERE id = ?", payment.LoanID)
+// CreateSpecialPayment inserts a new special payment for a loan in a
+// household where the user is owner or editor
+func CreateSpecialPayment(ctx context.Context, userID string, payment *models.SpecialPayment) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Verify loan exists and the user may change it
+	row := txQueryRow(ctx, tx, "SELECT id FROM loans WHERE id = ? AND deleted_at IS NULL AND household_id IN ("+editableHouseholds+")", payment.LoanID, userID)
 	var loanID string
 	if err := row.Scan(&loanID); err != nil {
-		return fmt.Errorf("loan not found")
+		return notFound(err, ErrLoanNotFound)
 	}
 
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	// Convert empty note to nil for proper NULL insertion
-	var noteValue *string
-	if payment.Note != "" {
-		noteValue = &payment.Note
-	}
-
-	_, err := execQuery(`
+	_, err = txExec(ctx, tx, `
 		INSERT INTO special_payments (id, loan_id, date, amount, note, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, payment.ID, payment.LoanID, payment.Date, payment.Amount, noteValue, now, now)
-
-	if err == nil {
-		payment.CreatedAt = now
-		payment.UpdatedAt = now
-		// Force WAL checkpoint to ensure data is persisted
-		if err := forceCheckpoint(); err != nil {
-			return fmt.Errorf("failed to checkpoint database: %w", err)
-		}
+	`, payment.ID, payment.LoanID, payment.Date, payment.Amount, nullableString(payment.Note), now, now)
+	if err != nil {
+		return err
 	}
+	if err := checkPaymentQuota(ctx, tx, payment.LoanID); err != nil {
+		return err
+	}
+	if err := touchLoan(ctx, tx, payment.LoanID, now); err != nil {
+		return err
+	}
+
+	if err := recordAudit(ctx, tx, userID, payment.LoanID, models.AuditEntitySpecialPayment, payment.ID,
+		models.AuditCreate, nil, paymentAuditFields(payment), 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// touchLoan increments the version of a loan whose special payments changed,
+// so its ETag changes with the representation
+func touchLoan(ctx context.Context, tx *sql.Tx, loanID, now string) error {
+	_, err := txExec(ctx, tx, "UPDATE loans SET version = version + 1, updated_at = ? WHERE id = ?", now, loanID)
 	return err
 }
 
-// DeleteSpecialPayment deletes a special payment
-func DeleteSpecialPayment(loanID, paymentID string) error {
-	// Verify loan exists
-	row := queryRow("SELECT id FROM loans WHERE id = ?", loanID)
+// DeleteSpecialPayment moves a special payment of a loan in a household
+// where the user is owner or editor to the trash
+func DeleteSpecialPayment(ctx context.Context, userID, loanID, paymentID string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Verify loan exists and the user may change it
+	row := txQueryRow(ctx, tx, "SELECT id FROM loans WHERE id = ? AND deleted_at IS NULL AND household_id IN ("+editableHouseholds+")", loanID, userID)
 	var existingLoanID string
 	if err := row.Scan(&existingLoanID); err != nil {
-		return fmt.Errorf("loan not found")
+		return notFound(err, ErrLoanNotFound)
 	}
 
-	result, err := execQuery("DELETE FROM special_payments WHERE id = ? AND loan_id = ?", paymentID, loanID)
+	var payment models.SpecialPayment
+	err = txQueryRow(ctx, tx, `
+		SELECT id, date, amount, COALESCE(note, '')
+		FROM special_payments
+		WHERE id = ? AND loan_id = ? AND deleted_at IS NULL
+	`, paymentID, loanID).Scan(&payment.ID, &payment.Date, &payment.Amount, &payment.Note)
 	if err != nil {
-		return err
+		return notFound(err, ErrPaymentNotFound)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := txExec(ctx, tx, "UPDATE special_payments SET deleted_at = ? WHERE id = ?", now, paymentID); err != nil {
+		return err
+	}
+	if err := touchLoan(ctx, tx, loanID, now); err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("special payment not found")
+	if err := recordAudit(ctx, tx, userID, loanID, models.AuditEntitySpecialPayment, paymentID,
+		models.AuditDelete, paymentAuditFields(&payment), nil, 0); err != nil {
+		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+func TestUpdateLoanVersion(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	loan := createTestLoan(t, user.ID, user.ID)
+
+	stale := *loan
+	loan.Name = "Wohnung"
+	if err := UpdateLoan(ctx, user.ID, loan); err != nil {
+		t.Fatal(err)
+	}
+	if loan.Version != 2 {
+		t.Errorf("version = %d after the update, want 2", loan.Version)
+	}
+
+	stale.Name = "Garage"
+	if err := UpdateLoan(ctx, user.ID, &stale); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale update: err = %v, want ErrVersionConflict", err)
+	}
+	if err := DeleteLoan(ctx, user.ID, loan.ID, 1); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale delete: err = %v, want ErrVersionConflict", err)
+	}
+
+	stored, err := GetLoan(ctx, user.ID, loan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != "Wohnung" || stored.Version != 2 {
+		t.Errorf("stored loan = %s version %d, want Wohnung version 2", stored.Name, stored.Version)
+	}
+	if n := countTestRows(t, "audit_log", "loan_id = ?", loan.ID); n != 2 {
+		t.Errorf("%d audit entries, want create and one update", n)
+	}
+
+	if err := DeleteLoan(ctx, user.ID, loan.ID, 2); err != nil {
+		t.Errorf("delete with the current version: %v", err)
+	}
+}
+
+// A user sees and changes only the loans of their own households
+func TestLoanIsolation(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	anna := createTestUser(t, "anna")
+	ben := createTestUser(t, "ben")
+	loan := createTestLoan(t, anna.ID, anna.ID)
+	payment := &models.SpecialPayment{ID: uuid.New().String(), LoanID: loan.ID, Date: "2025-01-01", Amount: 5000}
+	if err := CreateSpecialPayment(ctx, anna.ID, payment); err != nil {
+		t.Fatal(err)
+	}
+	trashed := &models.SpecialPayment{ID: uuid.New().String(), LoanID: loan.ID, Date: "2026-01-01", Amount: 1000}
+	if err := CreateSpecialPayment(ctx, anna.ID, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteSpecialPayment(ctx, anna.ID, loan.ID, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	before, err := GetLoan(ctx, anna.ID, loan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loans, err := GetAllLoans(ctx, ben.ID)
+	if err != nil || len(loans) != 0 {
+		t.Errorf("GetAllLoans(ben) = %d loans, %v, want none", len(loans), err)
+	}
+	trash, err := GetTrash(ctx, ben.ID)
+	if err != nil || len(trash.SpecialPayments) != 0 {
+		t.Errorf("GetTrash(ben) = %d payments, %v, want none", len(trash.SpecialPayments), err)
+	}
+
+	changed := *before
+	changed.Name = "Bens Haus"
+	tests := []struct {
+		name  string
+		query func(ctx context.Context) error
+	}{
+		{"GetLoan", func(ctx context.Context) error { _, err := GetLoan(ctx, ben.ID, loan.ID); return err }},
+		{"GetLoanRole", func(ctx context.Context) error { _, err := GetLoanRole(ctx, ben.ID, loan.ID); return err }},
+		{"UpdateLoan", func(ctx context.Context) error { return UpdateLoan(ctx, ben.ID, &changed) }},
+		{"DeleteLoan", func(ctx context.Context) error { return DeleteLoan(ctx, ben.ID, loan.ID, 0) }},
+		{"CreateSpecialPayment", func(ctx context.Context) error {
+			return CreateSpecialPayment(ctx, ben.ID, &models.SpecialPayment{ID: uuid.New().String(), LoanID: loan.ID, Date: "2025-06-01", Amount: 1})
+		}},
+		{"DeleteSpecialPayment", func(ctx context.Context) error { return DeleteSpecialPayment(ctx, ben.ID, loan.ID, payment.ID) }},
+		{"RestoreSpecialPayment", func(ctx context.Context) error { _, err := RestoreSpecialPayment(ctx, ben.ID, trashed.ID); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.query(ctx); !errors.Is(err, ErrNotFound) {
+				t.Errorf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	// Importing the loan's ID into another household creates a copy
+	doc := &models.ExportDocument{Loans: []models.Loan{changed}}
+	if _, err := ImportData(ctx, ben.ID, ben.ID, doc, models.ImportModeMerge, models.ConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := GetLoan(ctx, anna.ID, loan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Name != before.Name || after.Version != before.Version || len(after.SpecialPayments) != 1 {
+		t.Errorf("loan = %s version %d with %d payments, want %s version %d with 1",
+			after.Name, after.Version, len(after.SpecialPayments), before.Name, before.Version)
+	}
+	if n := countTestRows(t, "loans", "household_id = ?", ben.ID); n != 1 {
+		t.Errorf("ben's household has %d loans, want the imported copy", n)
+	}
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Quotas bound what a single user can store, so a misbehaving client cannot
+// fill the database. Zero means unlimited. Loans count for the user who
+// created them; neither count includes the trash.
+var (
+	MaxLoansPerUser    int
+	MaxPaymentsPerLoan int
+)
+
+// checkLoanQuota fails if the user owns more loans than allowed. It runs
+// after the insert in the same transaction, so concurrent requests cannot
+// both stay under the quota.
+func checkLoanQuota(ctx context.Context, tx *sql.Tx, ownerID string) error {
+	if MaxLoansPerUser == 0 {
+		return nil
+	}
+	var count int
+	if err := txQueryRow(ctx, tx, "SELECT COUNT(*) FROM loans WHERE owner_id = ? AND deleted_at IS NULL", ownerID).Scan(&count); err != nil {
+		return err
+	}
+	if count > MaxLoansPerUser {
+		return ErrLoanQuotaExceeded
+	}
+	return nil
+}
+
+// checkPaymentQuota fails if the loan has more special payments than allowed
+func checkPaymentQuota(ctx context.Context, tx *sql.Tx, loanID string) error {
+	if MaxPaymentsPerLoan == 0 {
+		return nil
+	}
+	var count int
+	if err := txQueryRow(ctx, tx, "SELECT COUNT(*) FROM special_payments WHERE loan_id = ? AND deleted_at IS NULL", loanID).Scan(&count); err != nil {
+		return err
+	}
+	if count > MaxPaymentsPerLoan {
+		return ErrPaymentQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+// setQuotas sets the quotas for one test
+func setQuotas(t *testing.T, loans, payments int) {
+	t.Helper()
+	MaxLoansPerUser, MaxPaymentsPerLoan = loans, payments
+	t.Cleanup(func() { MaxLoansPerUser, MaxPaymentsPerLoan = 0, 0 })
+}
+
+func TestLoanQuota(t *testing.T) {
+	openTestDB(t)
+	setQuotas(t, 2, 0)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	createTestLoan(t, user.ID, user.ID)
+	trashed := createTestLoan(t, user.ID, user.ID)
+
+	// Creating beyond the quota rolls back the loan and its audit entry
+	over := testLoan(user.ID)
+	if err := CreateLoan(ctx, user.ID, over); !errors.Is(err, ErrLoanQuotaExceeded) {
+		t.Fatalf("third loan: err = %v, want ErrLoanQuotaExceeded", err)
+	}
+	if n := countTestRows(t, "loans", "id = ?", over.ID); n != 0 {
+		t.Errorf("loan beyond the quota was stored")
+	}
+	if n := countTestRows(t, "audit_log", "loan_id = ?", over.ID); n != 0 {
+		t.Errorf("%d audit entries of the rolled back loan", n)
+	}
+
+	// The trash does not count, but restoring from it does
+	if err := DeleteLoan(ctx, user.ID, trashed.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	createTestLoan(t, user.ID, user.ID)
+	if err := RestoreLoan(ctx, user.ID, trashed.ID); !errors.Is(err, ErrLoanQuotaExceeded) {
+		t.Errorf("restore: err = %v, want ErrLoanQuotaExceeded", err)
+	}
+	if n := countTestRows(t, "loans", "id = ? AND deleted_at IS NOT NULL", trashed.ID); n != 1 {
+		t.Error("loan left the trash although the restore failed")
+	}
+
+	// An import is bounded as a whole
+	doc := &models.ExportDocument{Loans: []models.Loan{*testLoan(user.ID)}}
+	if _, err := ImportData(ctx, user.ID, user.ID, doc, models.ImportModeMerge, models.ConflictSkip); !errors.Is(err, ErrLoanQuotaExceeded) {
+		t.Errorf("import: err = %v, want ErrLoanQuotaExceeded", err)
+	}
+	if n := countTestRows(t, "loans", "owner_id = ? AND deleted_at IS NULL", user.ID); n != 2 {
+		t.Errorf("%d loans after the failed import, want 2", n)
+	}
+
+	// Zero is unlimited
+	setQuotas(t, 0, 0)
+	createTestLoan(t, user.ID, user.ID)
+}
+
+func TestPaymentQuota(t *testing.T) {
+	openTestDB(t)
+	setQuotas(t, 0, 2)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	loan := createTestLoan(t, user.ID, user.ID)
+
+	newPayment := func() *models.SpecialPayment {
+		return &models.SpecialPayment{ID: uuid.New().String(), LoanID: loan.ID, Date: "2025-01-01", Amount: 1000}
+	}
+	var payments []*models.SpecialPayment
+	for i := 0; i < 2; i++ {
+		p := newPayment()
+		if err := CreateSpecialPayment(ctx, user.ID, p); err != nil {
+			t.Fatal(err)
+		}
+		payments = append(payments, p)
+	}
+	before, err := GetLoan(ctx, user.ID, loan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating beyond the quota rolls back the payment and the version bump
+	over := newPayment()
+	if err := CreateSpecialPayment(ctx, user.ID, over); !errors.Is(err, ErrPaymentQuotaExceeded) {
+		t.Fatalf("third payment: err = %v, want ErrPaymentQuotaExceeded", err)
+	}
+	after, err := GetLoan(ctx, user.ID, loan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after.SpecialPayments) != 2 || after.Version != before.Version {
+		t.Errorf("loan has %d payments at version %d, want 2 at version %d", len(after.SpecialPayments), after.Version, before.Version)
+	}
+
+	// Restoring from the trash counts
+	if err := DeleteSpecialPayment(ctx, user.ID, loan.ID, payments[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateSpecialPayment(ctx, user.ID, newPayment()); err != nil {
+		t.Fatalf("payment after moving one to the trash: %v", err)
+	}
+	if _, err := RestoreSpecialPayment(ctx, user.ID, payments[0].ID); !errors.Is(err, ErrPaymentQuotaExceeded) {
+		t.Errorf("restore: err = %v, want ErrPaymentQuotaExceeded", err)
+	}
+
+	// So does importing into an existing loan
+	imported := *loan
+	imported.SpecialPayments = []models.SpecialPayment{*newPayment()}
+	doc := &models.ExportDocument{Loans: []models.Loan{imported}}
+	if _, err := ImportData(ctx, user.ID, user.ID, doc, models.ImportModeMerge, models.ConflictSkip); !errors.Is(err, ErrPaymentQuotaExceeded) {
+		t.Errorf("import: err = %v, want ErrPaymentQuotaExceeded", err)
+	}
+	if n := countTestRows(t, "special_payments", "loan_id = ? AND deleted_at IS NULL", loan.ID); n != 2 {
+		t.Errorf("%d payments after the failed restore and import, want 2", n)
+	}
+}
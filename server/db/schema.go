@@ -1,6 +1,11 @@
 package db
 
-// SQL schema definitions for loans and special payments tables
+import (
+	"fmt"
+	"log/slog"
+)
+
+// SQL schema definitions for all tables
 const (
 	createLoansTable = `
 	CREATE TABLE IF NOT EXISTS loans (
@@ -33,16 +38,150 @@ const (
 	createSpecialPaymentsIndex = `
 	CREATE INDEX IF NOT EXISTS idx_special_payments_loan_id ON special_payments(loan_id);
 	`
+
+	createUsersTable = `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		password_hash TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	createSessionsTable = `
+	CREATE TABLE IF NOT EXISTS sessions (
+		token_hash TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`
+
+	createCalendarTokensTable = `
+	CREATE TABLE IF NOT EXISTS calendar_tokens (
+		id TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		loan_id TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+	);
+	`
+
+	createHouseholdsTable = `
+	CREATE TABLE IF NOT EXISTS households (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	createHouseholdMembersTable = `
+	CREATE TABLE IF NOT EXISTS household_members (
+		household_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (household_id, user_id),
+		FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_household_members_user_id ON household_members(user_id);
+	`
+
+	createHouseholdInvitesTable = `
+	CREATE TABLE IF NOT EXISTS household_invites (
+		id TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		household_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_by TEXT,
+		expires_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (household_id) REFERENCES households(id) ON DELETE CASCADE
+	);
+	`
+
+	createShareLinksTable = `
+	CREATE TABLE IF NOT EXISTS share_links (
+		id TEXT PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		loan_id TEXT NOT NULL,
+		created_by TEXT,
+		password_hash TEXT,
+		expires_at DATETIME NOT NULL,
+		revoked_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY (loan_id) REFERENCES loans(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_share_links_loan_id ON share_links(loan_id);
+	`
+
+	createShareAccessesTable = `
+	CREATE TABLE IF NOT EXISTS share_accesses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		share_link_id TEXT NOT NULL,
+		outcome TEXT NOT NULL,
+		ip_address TEXT,
+		user_agent TEXT,
+		accessed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (share_link_id) REFERENCES share_links(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_share_accesses_link_id ON share_accesses(share_link_id);
+	`
+
+	createAPITokensTable = `
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id TEXT PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	`
+
+	// The audit log has no foreign keys so that it outlives deleted loans.
+	// The triggers make it append-only.
+	createAuditLogTable = `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		loan_id TEXT NOT NULL,
+		entity_type TEXT NOT NULL,
+		entity_id TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		actor_id TEXT,
+		changes TEXT NOT NULL,
+		restored_from INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_loan_id ON audit_log(loan_id);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit log is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'audit log is append-only');
+	END;
+	`
 )
 
 // initTables creates all necessary tables and indexes
 func initTables() error {
 	// Configure SQLite for proper persistence and concurrency
 	pragmas := []string{
-		"PRAGMA journal_mode = WAL;",           // Write-Ahead Logging for better concurrency
-		"PRAGMA synchronous = FULL;",            // Ensure writes are synced to disk
-		"PRAGMA foreign_keys = ON;",             // Enable foreign key constraints
-		"PRAGMA temp_store = MEMORY;",           // Use memory for temporary tables
+		"PRAGMA journal_mode = WAL;",  // Write-Ahead Logging for better concurrency
+		"PRAGMA synchronous = FULL;",  // Ensure writes are synced to disk
+		"PRAGMA foreign_keys = ON;",   // Enable foreign key constraints
+		"PRAGMA temp_store = MEMORY;", // Use memory for temporary tables
 	}
 
 	for _, pragma := range pragmas {
@@ -55,6 +194,16 @@ func initTables() error {
 		createLoansTable,
 		createSpecialPaymentsTable,
 		createSpecialPaymentsIndex,
+		createUsersTable,
+		createSessionsTable,
+		createCalendarTokensTable,
+		createHouseholdsTable,
+		createHouseholdMembersTable,
+		createHouseholdInvitesTable,
+		createShareLinksTable,
+		createShareAccessesTable,
+		createAPITokensTable,
+		createAuditLogTable,
 	}
 
 	for _, stmt := range statements {
@@ -63,5 +212,71 @@ func initTables() error {
 		}
 	}
 
+	return migrate()
+}
+
+// migrations alter tables created by earlier versions. They are applied in
+// order and the number of applied migrations is stored in PRAGMA user_version,
+// so each one runs exactly once per database.
+var migrations = []string{
+	// 1: loans belong to a user
+	`ALTER TABLE loans ADD COLUMN owner_id TEXT REFERENCES users(id) ON DELETE CASCADE;
+	 CREATE INDEX IF NOT EXISTS idx_loans_owner_id ON loans(owner_id);`,
+
+	// 2: calendar tokens belong to a user. Existing tokens cannot be
+	// attributed to anyone and are revoked.
+	`ALTER TABLE calendar_tokens ADD COLUMN user_id TEXT REFERENCES users(id) ON DELETE CASCADE;
+	 DELETE FROM calendar_tokens;`,
+
+	// 3: users can log in through an OpenID Connect provider
+	`ALTER TABLE users ADD COLUMN oidc_issuer TEXT;
+	 ALTER TABLE users ADD COLUMN oidc_subject TEXT;
+	 CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc ON users(oidc_issuer, oidc_subject);`,
+
+	// 4: loans belong to a household. Every user gets a personal household
+	// with the same ID that takes over the loans the user owns.
+	`ALTER TABLE loans ADD COLUMN household_id TEXT REFERENCES households(id) ON DELETE CASCADE;
+	 INSERT OR IGNORE INTO households (id, name, created_at, updated_at)
+	 SELECT id, name, created_at, created_at FROM users;
+	 INSERT OR IGNORE INTO household_members (household_id, user_id, role, created_at)
+	 SELECT id, id, 'owner', created_at FROM users;
+	 UPDATE loans SET household_id = owner_id WHERE owner_id IS NOT NULL;
+	 CREATE INDEX IF NOT EXISTS idx_loans_household_id ON loans(household_id);`,
+
+	// 5: deleted loans and special payments stay in the trash until purged
+	`ALTER TABLE loans ADD COLUMN deleted_at DATETIME;
+	 ALTER TABLE special_payments ADD COLUMN deleted_at DATETIME;`,
+
+	// 6: loans carry a version for optimistic concurrency control
+	`ALTER TABLE loans ADD COLUMN version INTEGER NOT NULL DEFAULT 1;`,
+}
+
+// migrate applies all pending migrations
+func migrate() error {
+	var version int
+	if err := DB.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := DB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+		// PRAGMA does not support placeholders
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("Applied database migration", "version", i+1)
+	}
+
 	return nil
 }
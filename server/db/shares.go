@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/models"
+)
+
+// Share link queries
+
+// GetShareLinks retrieves all share links of a loan (without their secret)
+func GetShareLinks(ctx context.Context, loanID string) ([]models.ShareLink, error) {
+	rows, err := queryRows(ctx, `
+		SELECT s.id, s.loan_id, s.password_hash IS NOT NULL, s.expires_at, s.revoked_at,
+		       s.created_at, s.last_used_at,
+		       (SELECT COUNT(*) FROM share_accesses a WHERE a.share_link_id = s.id)
+		FROM share_links s
+		WHERE s.loan_id = ?
+		ORDER BY s.created_at DESC
+	`, loanID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.ShareLink{}
+	for rows.Next() {
+		var link models.ShareLink
+		var revokedAt, lastUsedAt *string
+
+		if err := rows.Scan(&link.ID, &link.LoanID, &link.HasPassword, &link.ExpiresAt, &revokedAt,
+			&link.CreatedAt, &lastUsedAt, &link.AccessCount); err != nil {
+			return nil, err
+		}
+
+		if revokedAt != nil {
+			link.RevokedAt = *revokedAt
+		}
+		if lastUsedAt != nil {
+			link.LastUsedAt = *lastUsedAt
+		}
+		links = append(links, link)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// CreateShareLink stores a new share link. Only the hash of link.Token is
+// persisted. An empty passwordHash creates a link without password.
+func CreateShareLink(ctx context.Context, createdBy string, link *models.ShareLink, expiresAt time.Time, passwordHash string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	link.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+
+	_, err := execQuery(ctx, `
+		INSERT INTO share_links (id, token_hash, loan_id, created_by, password_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, link.ID, masked(auth.HashToken(link.Token)), link.LoanID, createdBy, masked(passwordHash), link.ExpiresAt, now)
+
+	if err == nil {
+		link.CreatedAt = now
+		link.HasPassword = passwordHash != ""
+		// Force WAL checkpoint to ensure data is persisted
+		if err := forceCheckpoint(ctx); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return err
+}
+
+// RevokeShareLink revokes a share link of a loan. The link and its access
+// log are kept.
+func RevokeShareLink(ctx context.Context, loanID, id string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := execQuery(ctx, `
+		UPDATE share_links SET revoked_at = COALESCE(revoked_at, ?)
+		WHERE id = ? AND loan_id = ?
+	`, now, id, loanID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	return nil
+}
+
+// FindShareLink looks up a share link by its secret, including expired and
+// revoked links, and returns it with its password hash (empty if none)
+func FindShareLink(ctx context.Context, secret string) (*models.ShareLink, string, error) {
+	var link models.ShareLink
+	var passwordHash, revokedAt *string
+
+	row := queryRow(ctx, `
+		SELECT id, loan_id, password_hash, expires_at, revoked_at, created_at
+		FROM share_links
+		WHERE token_hash = ?
+	`, masked(auth.HashToken(secret)))
+	if err := row.Scan(&link.ID, &link.LoanID, &passwordHash, &link.ExpiresAt, &revokedAt, &link.CreatedAt); err != nil {
+		return nil, "", notFound(err, ErrShareLinkNotFound)
+	}
+
+	if revokedAt != nil {
+		link.RevokedAt = *revokedAt
+	}
+	if passwordHash == nil {
+		return &link, "", nil
+	}
+	link.HasPassword = true
+	return &link, *passwordHash, nil
+}
+
+// LogShareAccess appends an entry to the access log of a share link
+func LogShareAccess(ctx context.Context, linkID, outcome, ipAddress, userAgent string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := execQuery(ctx, `
+		INSERT INTO share_accesses (share_link_id, outcome, ip_address, user_agent, accessed_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, linkID, outcome, ipAddress, userAgent, now); err != nil {
+		return err
+	}
+
+	if outcome == models.ShareAccessGranted {
+		if _, err := execQuery(ctx, "UPDATE share_links SET last_used_at = ? WHERE id = ?", now, linkID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetShareAccesses retrieves the access log of a share link of a loan, newest first
+func GetShareAccesses(ctx context.Context, loanID, linkID string) ([]models.ShareAccess, error) {
+	var id string
+	if err := queryRow(ctx, "SELECT id FROM share_links WHERE id = ? AND loan_id = ?", linkID, loanID).Scan(&id); err != nil {
+		return nil, notFound(err, ErrShareLinkNotFound)
+	}
+
+	rows, err := queryRows(ctx, `
+		SELECT accessed_at, outcome, COALESCE(ip_address, ''), COALESCE(user_agent, '')
+		FROM share_accesses
+		WHERE share_link_id = ?
+		ORDER BY id DESC
+	`, linkID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accesses := []models.ShareAccess{}
+	for rows.Next() {
+		var access models.ShareAccess
+		if err := rows.Scan(&access.AccessedAt, &access.Outcome, &access.IPAddress, &access.UserAgent); err != nil {
+			return nil, err
+		}
+		accesses = append(accesses, access)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return accesses, nil
+}
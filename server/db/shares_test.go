@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetShareAccesses(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	user := createTestUser(t, "anna")
+	loan := createTestLoan(t, user.ID, user.ID)
+	link := createTestShareLink(t, user.ID, loan.ID)
+
+	accesses, err := GetShareAccesses(ctx, loan.ID, link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accesses) != 1 || accesses[0].IPAddress != "203.0.113.5" {
+		t.Errorf("accesses = %+v, want the logged access", accesses)
+	}
+
+	other := createTestLoan(t, user.ID, user.ID)
+	if _, err := GetShareAccesses(ctx, other.ID, link.ID); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Errorf("link of another loan: err = %v, want ErrShareLinkNotFound", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := GetShareAccesses(canceled, loan.ID, link.ID); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("canceled query: err = %v, want the query error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/models"
+)
+
+// API token queries
+
+// GetAPITokens retrieves all API tokens of a user (without their secret)
+func GetAPITokens(ctx context.Context, userID string) ([]models.APIToken, error) {
+	rows, err := queryRows(ctx, `
+		SELECT id, name, scopes, created_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		var token models.APIToken
+		var scopes string
+		var lastUsedAt *string
+
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+
+		token.Scopes = strings.Split(scopes, ",")
+		if lastUsedAt != nil {
+			token.LastUsedAt = *lastUsedAt
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// CreateAPIToken stores a new API token of a user. Only the hash of token.Token is persisted.
+func CreateAPIToken(ctx context.Context, userID string, token *models.APIToken) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := execQuery(ctx, `
+		INSERT INTO api_tokens (id, user_id, name, token_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, token.ID, userID, token.Name, masked(auth.HashToken(token.Token)), strings.Join(token.Scopes, ","), now)
+
+	if err == nil {
+		token.CreatedAt = now
+		// Force WAL checkpoint to ensure data is persisted
+		if err := forceCheckpoint(ctx); err != nil {
+			return fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return err
+}
+
+// UseAPIToken looks up the user and scopes of a token by its secret and
+// records the access
+func UseAPIToken(ctx context.Context, secret string) (*models.User, []string, error) {
+	var user models.User
+	var tokenID, scopes string
+
+	row := queryRow(ctx, `
+		SELECT t.id, t.scopes, u.id, u.email, u.name, u.created_at, u.updated_at
+		FROM api_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?
+	`, masked(auth.HashToken(secret)))
+	if err := row.Scan(&tokenID, &scopes, &user.ID, &user.Email, &user.Name,
+		&user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, nil, notFound(err, ErrAPITokenNotFound)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := execQuery(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, tokenID); err != nil {
+		return nil, nil, err
+	}
+
+	return &user, strings.Split(scopes, ","), nil
+}
+
+// DeleteAPIToken revokes an API token of a user
+func DeleteAPIToken(ctx context.Context, userID, id string) error {
+	result, err := execQuery(ctx, "DELETE FROM api_tokens WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/models"
+)
+
+// Trash queries. Deleted loans and special payments keep their rows with
+// deleted_at set until they are restored or purged.
+
+// GetTrash retrieves the deleted loans of all households of a user and the
+// deleted special payments of loans that are not deleted themselves
+func GetTrash(ctx context.Context, userID string) (*models.Trash, error) {
+	trash := &models.Trash{
+		Loans:           []models.Loan{},
+		SpecialPayments: []models.SpecialPayment{},
+	}
+
+	rows, err := queryRows(ctx, `
+		SELECT l.id, l.name, l.amount, l.interest_rate, l.start_date, l.fixed_interest_years,
+		       l.repayment_type, l.repayment_value, l.version, l.household_id, m.role,
+		       l.created_at, l.updated_at, l.deleted_at
+		FROM loans l
+		JOIN household_members m ON m.household_id = l.household_id
+		WHERE m.user_id = ? AND l.deleted_at IS NOT NULL
+		ORDER BY l.deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loan models.Loan
+		if err := rows.Scan(
+			&loan.ID, &loan.Name, &loan.Amount, &loan.InterestRate,
+			&loan.StartDate, &loan.FixedInterestYears, &loan.RepaymentType,
+			&loan.RepaymentValue, &loan.Version, &loan.HouseholdID, &loan.Role,
+			&loan.CreatedAt, &loan.UpdatedAt, &loan.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		trash.Loans = append(trash.Loans, loan)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// The special payments that come back with a restored loan
+	for i := range trash.Loans {
+		payments, err := GetSpecialPayments(ctx, trash.Loans[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		trash.Loans[i].SpecialPayments = payments
+	}
+
+	paymentRows, err := queryRows(ctx, `
+		SELECT p.id, p.loan_id, p.date, p.amount, COALESCE(p.note, ''),
+		       p.created_at, p.updated_at, p.deleted_at
+		FROM special_payments p
+		JOIN loans l ON l.id = p.loan_id
+		JOIN household_members m ON m.household_id = l.household_id
+		WHERE m.user_id = ? AND l.deleted_at IS NULL AND p.deleted_at IS NOT NULL
+		ORDER BY p.deleted_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer paymentRows.Close()
+
+	for paymentRows.Next() {
+		var payment models.SpecialPayment
+		if err := paymentRows.Scan(&payment.ID, &payment.LoanID, &payment.Date, &payment.Amount,
+			&payment.Note, &payment.CreatedAt, &payment.UpdatedAt, &payment.DeletedAt); err != nil {
+			return nil, err
+		}
+		trash.SpecialPayments = append(trash.SpecialPayments, payment)
+	}
+	if err = paymentRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return trash, nil
+}
+
+// RestoreLoan takes a loan in a household where the user is owner or editor
+// out of the trash
+func RestoreLoan(ctx context.Context, userID, id string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID string
+	if err := txQueryRow(ctx, tx, "SELECT owner_id FROM loans WHERE id = ? AND deleted_at IS NOT NULL AND household_id IN ("+editableHouseholds+")",
+		id, userID).Scan(&ownerID); err != nil {
+		return notFound(err, ErrLoanNotInTrash)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := txExec(ctx, tx, "UPDATE loans SET deleted_at = NULL, version = version + 1, updated_at = ? WHERE id = ?", now, id); err != nil {
+		return err
+	}
+	if err := checkLoanQuota(ctx, tx, ownerID); err != nil {
+		return err
+	}
+
+	loan, err := txLoan(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if err := recordAudit(ctx, tx, userID, id, models.AuditEntityLoan, id, models.AuditRestore,
+		nil, loanAuditFields(loan), 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// RestoreSpecialPayment takes a special payment out of the trash. Its loan
+// must not be deleted and must be in a household where the user is owner or editor.
+func RestoreSpecialPayment(ctx context.Context, userID, id string) (*models.SpecialPayment, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var payment models.SpecialPayment
+	err = txQueryRow(ctx, tx, `
+		SELECT p.id, p.loan_id, p.date, p.amount, COALESCE(p.note, ''), p.created_at
+		FROM special_payments p
+		JOIN loans l ON l.id = p.loan_id
+		WHERE p.id = ? AND p.deleted_at IS NOT NULL AND l.deleted_at IS NULL
+		  AND l.household_id IN (`+editableHouseholds+`)
+	`, id, userID).Scan(&payment.ID, &payment.LoanID, &payment.Date, &payment.Amount,
+		&payment.Note, &payment.CreatedAt)
+	if err != nil {
+		return nil, notFound(err, ErrPaymentNotInTrash)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := txExec(ctx, tx, "UPDATE special_payments SET deleted_at = NULL, updated_at = ? WHERE id = ?", now, id); err != nil {
+		return nil, err
+	}
+	if err := checkPaymentQuota(ctx, tx, payment.LoanID); err != nil {
+		return nil, err
+	}
+	if err := touchLoan(ctx, tx, payment.LoanID, now); err != nil {
+		return nil, err
+	}
+
+	if err := recordAudit(ctx, tx, userID, payment.LoanID, models.AuditEntitySpecialPayment, id,
+		models.AuditRestore, nil, paymentAuditFields(&payment), 0); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	payment.UpdatedAt = now
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return &payment, nil
+}
+
+// PurgeTrash permanently deletes loans and special payments that were moved
+// to the trash before the cutoff, with the share links and calendar tokens
+// of the loans. It returns the number of purged loans and special payments.
+func PurgeTrash(ctx context.Context, cutoff time.Time) (int64, int64, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	before := cutoff.UTC().Format(time.RFC3339)
+	purgedLoans := "SELECT id FROM loans WHERE deleted_at < ?"
+
+	result, err := txExec(ctx, tx, "DELETE FROM special_payments WHERE deleted_at < ? OR loan_id IN ("+purgedLoans+")", before, before)
+	if err != nil {
+		return 0, 0, err
+	}
+	payments, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	loans, err := deleteLoans(ctx, tx, purgedLoans, before)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	if loans > 0 || payments > 0 {
+		// Force WAL checkpoint to ensure data is persisted
+		if err := forceCheckpoint(ctx); err != nil {
+			return 0, 0, fmt.Errorf("failed to checkpoint database: %w", err)
+		}
+	}
+	return loans, payments, nil
+}
+
+// deleteLoans permanently deletes the loans that the query selects by ID,
+// with their special payments, calendar tokens and share links. Dependent rows
+// are deleted explicitly, foreign keys are not enforced on every connection.
+// It returns the number of deleted loans.
+func deleteLoans(ctx context.Context, tx *sql.Tx, selectIDs string, args ...interface{}) (int64, error) {
+	statements := []string{
+		"DELETE FROM special_payments WHERE loan_id IN (" + selectIDs + ")",
+		"DELETE FROM calendar_tokens WHERE loan_id IN (" + selectIDs + ")",
+		"DELETE FROM share_accesses WHERE share_link_id IN (SELECT id FROM share_links WHERE loan_id IN (" + selectIDs + "))",
+		"DELETE FROM share_links WHERE loan_id IN (" + selectIDs + ")",
+	}
+	for _, stmt := range statements {
+		if _, err := txExec(ctx, tx, stmt, args...); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := txExec(ctx, tx, "DELETE FROM loans WHERE id IN ("+selectIDs+")", args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/models"
+)
+
+// User and session queries
+
+// CreateUser inserts a new user with a personal household that has the
+// user's ID. The first user of a database takes over all loans created
+// before accounts existed.
+func CreateUser(ctx context.Context, user *models.User, passwordHash string) error {
+	return createUser(ctx, user, passwordHash, "", "")
+}
+
+// CreateOIDCUser inserts a new user without password that is linked to an
+// OpenID Connect identity, in one transaction like CreateUser
+func CreateOIDCUser(ctx context.Context, user *models.User, issuer, subject string) error {
+	return createUser(ctx, user, "", issuer, subject)
+}
+
+func createUser(ctx context.Context, user *models.User, passwordHash, issuer, subject string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userCount int
+	if err := txQueryRow(ctx, tx, "SELECT COUNT(*) FROM users").Scan(&userCount); err != nil {
+		return err
+	}
+
+	// Allow accounts without password (e.g. single sign-on); an empty hash
+	// or identity is stored as NULL
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := txExec(ctx, tx, `
+		INSERT INTO users (id, email, name, password_hash, oidc_issuer, oidc_subject, created_at, updated_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+	`, user.ID, user.Email, user.Name, masked(passwordHash), issuer, subject, now, now); err != nil {
+		if isUniqueViolation(err) {
+			if subject != "" && identityLinked(ctx, tx, issuer, subject) {
+				return ErrIdentityLinked
+			}
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	if _, err := txExec(ctx, tx, `
+		INSERT INTO households (id, name, created_at, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, user.ID, user.Name, now, now); err != nil {
+		return err
+	}
+	if _, err := txExec(ctx, tx, `
+		INSERT INTO household_members (household_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+	`, user.ID, user.ID, models.RoleOwner, now); err != nil {
+		return err
+	}
+
+	if userCount == 0 {
+		if _, err := txExec(ctx, tx, `
+			UPDATE loans SET owner_id = ?, household_id = ? WHERE owner_id IS NULL
+		`, user.ID, user.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	// Force WAL checkpoint to ensure data is persisted
+	if err := forceCheckpoint(ctx); err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	return nil
+}
+
+// identityLinked reports whether an OpenID Connect identity belongs to a user
+func identityLinked(ctx context.Context, tx *sql.Tx, issuer, subject string) bool {
+	var id string
+	return txQueryRow(ctx, tx, "SELECT id FROM users WHERE oidc_issuer = ? AND oidc_subject = ?", issuer, subject).Scan(&id) == nil
+}
+
+// HasUsers reports whether at least one account exists
+func HasUsers(ctx context.Context) (bool, error) {
+	var count int
+	if err := queryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetUserByEmail retrieves a user and the password hash by email address.
+// The hash is empty for accounts without password.
+func GetUserByEmail(ctx context.Context, email string) (*models.User, string, error) {
+	var user models.User
+	var passwordHash *string
+
+	row := queryRow(ctx, `
+		SELECT id, email, name, password_hash, created_at, updated_at
+		FROM users
+		WHERE email = ?
+	`, email)
+
+	if err := row.Scan(&user.ID, &user.Email, &user.Name, &passwordHash,
+		&user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, "", notFound(err, ErrUserNotFound)
+	}
+
+	if passwordHash == nil {
+		return &user, "", nil
+	}
+	return &user, *passwordHash, nil
+}
+
+// GetUserByOIDCSubject retrieves the user linked to an OpenID Connect identity
+func GetUserByOIDCSubject(ctx context.Context, issuer, subject string) (*models.User, error) {
+	var user models.User
+
+	row := queryRow(ctx, `
+		SELECT id, email, name, created_at, updated_at
+		FROM users
+		WHERE oidc_issuer = ? AND oidc_subject = ?
+	`, issuer, subject)
+
+	if err := row.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+
+	return &user, nil
+}
+
+// LinkOIDCSubject links an OpenID Connect identity to a user. A user that is
+// linked to another identity keeps it.
+func LinkOIDCSubject(ctx context.Context, userID, issuer, subject string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := execQuery(ctx, `
+		UPDATE users
+		SET oidc_issuer = ?, oidc_subject = ?, updated_at = ?
+		WHERE id = ? AND (oidc_subject IS NULL OR (oidc_issuer = ? AND oidc_subject = ?))
+	`, issuer, subject, now, userID, issuer, subject)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrIdentityLinked
+		}
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		// Either the user does not exist or has another identity
+		var id string
+		if err := queryRow(ctx, "SELECT id FROM users WHERE id = ?", userID).Scan(&id); err != nil {
+			return notFound(err, ErrUserNotFound)
+		}
+		return ErrAccountLinked
+	}
+
+	return nil
+}
+
+// CreateSession stores a session for a user under the hash of its token
+func CreateSession(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := execQuery(ctx, `
+		INSERT INTO sessions (token_hash, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+	`, masked(tokenHash), userID, expiresAt.UTC().Format(time.RFC3339), now)
+	return err
+}
+
+// GetSessionUser retrieves the user of a session that has not expired yet
+func GetSessionUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+
+	row := queryRow(ctx, `
+		SELECT u.id, u.email, u.name, u.created_at, u.updated_at
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ?
+	`, masked(tokenHash), time.Now().UTC().Format(time.RFC3339))
+
+	if err := row.Scan(&user.ID, &user.Email, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return nil, notFound(err, ErrSessionNotFound)
+	}
+
+	return &user, nil
+}
+
+// DeleteSession removes a session (logout)
+func DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := execQuery(ctx, "DELETE FROM sessions WHERE token_hash = ?", masked(tokenHash))
+	return err
+}
+
+// DeleteExpiredSessions removes all sessions that have expired
+func DeleteExpiredSessions(ctx context.Context) error {
+	_, err := execQuery(ctx, "DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/models"
+)
+
+func TestLinkOIDCSubject(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	anna := createTestUser(t, "anna")
+	ben := createTestUser(t, "ben")
+	const issuer = "https://idp.example.com"
+
+	if err := LinkOIDCSubject(ctx, anna.ID, issuer, "anna"); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkOIDCSubject(ctx, anna.ID, issuer, "anna"); err != nil {
+		t.Errorf("linking the same identity again: %v", err)
+	}
+	if err := LinkOIDCSubject(ctx, anna.ID, issuer, "mallory"); !errors.Is(err, ErrAccountLinked) {
+		t.Errorf("linking another identity: err = %v, want ErrAccountLinked", err)
+	}
+	if err := LinkOIDCSubject(ctx, ben.ID, issuer, "anna"); !errors.Is(err, ErrIdentityLinked) {
+		t.Errorf("linking a linked identity: err = %v, want ErrIdentityLinked", err)
+	}
+	if err := LinkOIDCSubject(ctx, uuid.New().String(), issuer, "carl"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+
+	user, err := GetUserByOIDCSubject(ctx, issuer, "anna")
+	if err != nil || user.ID != anna.ID {
+		t.Errorf("GetUserByOIDCSubject() = %v, %v, want anna", user, err)
+	}
+}
+
+func TestCreateOIDCUser(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	const issuer = "https://idp.example.com"
+
+	carl := &models.User{ID: uuid.New().String(), Email: "carl@example.com", Name: "Carl"}
+	if err := CreateOIDCUser(ctx, carl, issuer, "carl"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserByOIDCSubject(ctx, issuer, "carl")
+	if err != nil || user.ID != carl.ID {
+		t.Errorf("GetUserByOIDCSubject() = %v, %v, want carl", user, err)
+	}
+
+	// Neither the identity nor the email may be taken; a failed attempt leaves no account behind
+	tests := []struct {
+		name    string
+		email   string
+		subject string
+		want    error
+	}{
+		{"identity taken", "dora@example.com", "carl", ErrIdentityLinked},
+		{"email taken", "carl@example.com", "carl2", ErrEmailTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{ID: uuid.New().String(), Email: tt.email, Name: "Dora"}
+			if err := CreateOIDCUser(ctx, user, issuer, tt.subject); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if n := countTestRows(t, "users", "id = ?", user.ID); n != 0 {
+				t.Errorf("%d users left behind", n)
+			}
+			if n := countTestRows(t, "households", "id = ?", user.ID); n != 0 {
+				t.Errorf("%d households left behind", n)
+			}
+		})
+	}
+}
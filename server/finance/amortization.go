@@ -0,0 +1,150 @@
+package finance
+
+import (
+	"fmt"
+	"time"
+
+	"baufi-optimierer/server/models"
+)
+
+// maxMonths is the safety limit of the schedule (60 years)
+const maxMonths = 720
+
+// MonthRecord is one month of an amortization schedule
+type MonthRecord struct {
+	Date             time.Time `json:"date"`
+	MonthIndex       int       `json:"monthIndex"`
+	Interest         float64   `json:"interest"`
+	Principal        float64   `json:"principal"` // Regular principal payment (Tilgung)
+	SpecialPayment   float64   `json:"specialPayment"`
+	TotalPayment     float64   `json:"totalPayment"`
+	RemainingBalance float64   `json:"remainingBalance"`
+	IsFixedPeriodEnd bool      `json:"isFixedPeriodEnd"`
+}
+
+// Result is the outcome of an amortization calculation
+type Result struct {
+	Schedule            []MonthRecord `json:"schedule"`
+	TotalInterest       float64       `json:"totalInterest"`
+	PayoffDate          time.Time     `json:"payoffDate"`
+	FixedPeriodEndDate  time.Time     `json:"fixedPeriodEndDate"`
+	RemainingAtFixedEnd float64       `json:"remainingAtFixedEnd"`
+}
+
+// YearSummary aggregates the schedule of one calendar year
+type YearSummary struct {
+	Year             int     `json:"year"`
+	Interest         float64 `json:"interest"`
+	Principal        float64 `json:"principal"`
+	SpecialPayment   float64 `json:"specialPayment"`
+	TotalPayment     float64 `json:"totalPayment"`
+	RemainingBalance float64 `json:"remainingBalance"` // Balance at the end of the year
+	FixedPeriodEnd   bool    `json:"fixedPeriodEnd"`   // The fixed period ends in this year
+}
+
+// Calculate computes the monthly amortization schedule of a loan.
+// It mirrors calculateAmortization in ui/utils/finance.ts so that
+// server-side exports match what the UI shows.
+func Calculate(loan *models.Loan) (*Result, error) {
+	start, err := time.Parse("2006-01-02", loan.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date %q: %w", loan.StartDate, err)
+	}
+
+	// Normalize to first of month, the schedule has monthly resolution
+	currentDate := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	fixedPeriodEndDate := time.Date(start.Year()+loan.FixedInterestYears, start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Calculate monthly payment (Annuität)
+	var monthlyPayment float64
+	if loan.RepaymentType == models.RepaymentTypeAbsolute {
+		monthlyPayment = loan.RepaymentValue
+	} else {
+		// Initial repayment % + interest rate % = annuity %
+		monthlyPayment = loan.Amount * (loan.InterestRate + loan.RepaymentValue) / 100 / 12
+	}
+	monthlyInterestRate := loan.InterestRate / 100 / 12
+
+	// Sum special payments per month (YYYY-MM)
+	specials := make(map[string]float64)
+	for _, sp := range loan.SpecialPayments {
+		if len(sp.Date) >= 7 {
+			specials[sp.Date[:7]] += sp.Amount
+		}
+	}
+
+	result := &Result{FixedPeriodEndDate: fixedPeriodEndDate}
+	currentBalance := loan.Amount
+	fixedPeriodEndRecorded := false
+
+	for monthIndex := 0; monthIndex < maxMonths; monthIndex++ {
+		interest := currentBalance * monthlyInterestRate
+		principal := monthlyPayment - interest
+		specialPaymentTotal := specials[currentDate.Format("2006-01")]
+
+		// Adjust principal if it exceeds remaining balance
+		if principal+specialPaymentTotal > currentBalance {
+			principal = currentBalance - specialPaymentTotal
+		}
+
+		totalDeduction := principal + specialPaymentTotal
+		// Handle case where total payment exceeds balance (last month)
+		payForMonth := totalDeduction + interest
+		if currentBalance+interest < payForMonth {
+			payForMonth = currentBalance + interest
+		}
+
+		currentBalance -= totalDeduction
+		// Floating point correction
+		if currentBalance < 0.01 {
+			currentBalance = 0
+		}
+
+		result.TotalInterest += interest
+
+		isFixedEnd := !fixedPeriodEndRecorded && !currentDate.Before(fixedPeriodEndDate)
+		if isFixedEnd {
+			result.RemainingAtFixedEnd = currentBalance
+			fixedPeriodEndRecorded = true
+		}
+
+		result.Schedule = append(result.Schedule, MonthRecord{
+			Date:             currentDate,
+			MonthIndex:       monthIndex,
+			Interest:         interest,
+			Principal:        principal,
+			SpecialPayment:   specialPaymentTotal,
+			TotalPayment:     payForMonth,
+			RemainingBalance: currentBalance,
+			IsFixedPeriodEnd: isFixedEnd,
+		})
+
+		if currentBalance <= 0 {
+			break
+		}
+		currentDate = currentDate.AddDate(0, 1, 0)
+	}
+
+	result.PayoffDate = result.Schedule[len(result.Schedule)-1].Date
+	return result, nil
+}
+
+// YearlySummary aggregates a schedule into calendar years
+func YearlySummary(schedule []MonthRecord) []YearSummary {
+	var years []YearSummary
+	for _, rec := range schedule {
+		if len(years) == 0 || years[len(years)-1].Year != rec.Date.Year() {
+			years = append(years, YearSummary{Year: rec.Date.Year()})
+		}
+		y := &years[len(years)-1]
+		y.Interest += rec.Interest
+		y.Principal += rec.Principal
+		y.SpecialPayment += rec.SpecialPayment
+		y.TotalPayment += rec.TotalPayment
+		y.RemainingBalance = rec.RemainingBalance
+		if rec.IsFixedPeriodEnd {
+			y.FixedPeriodEnd = true
+		}
+	}
+	return years
+}
@@ -0,0 +1,230 @@
+package finance
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"baufi-optimierer/server/models"
+)
+
+// testLoan returns a loan without interest, so the schedule is easy to check by hand
+func testLoan(amount, monthlyPayment float64) *models.Loan {
+	return &models.Loan{
+		Amount:             amount,
+		InterestRate:       0,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      models.RepaymentTypeAbsolute,
+		RepaymentValue:     monthlyPayment,
+	}
+}
+
+func date(year int, month time.Month) time.Time {
+	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.005
+}
+
+func TestCalculate(t *testing.T) {
+	withSpecials := testLoan(10000, 1000)
+	withSpecials.SpecialPayments = []models.SpecialPayment{
+		{ID: "a", Date: "2024-02-10", Amount: 1500},
+		{ID: "b", Date: "2024-02-20", Amount: 1000},
+	}
+	shortFixed := testLoan(10000, 100)
+	shortFixed.FixedInterestYears = 1
+	midMonth := testLoan(10000, 100)
+	midMonth.StartDate = "2024-03-15"
+	midMonth.FixedInterestYears = 1
+
+	tests := []struct {
+		name       string
+		loan       *models.Loan
+		months     int
+		payoff     time.Time
+		balances   []float64 // Remaining balance after the first months
+		last       MonthRecord
+		fixedIndex int // Month of the fixed period end, -1 if paid off before
+		fixedRest  float64
+	}{
+		{
+			name:       "absolute repayment",
+			loan:       testLoan(10000, 3000),
+			months:     4,
+			payoff:     date(2024, time.April),
+			balances:   []float64{7000, 4000, 1000, 0},
+			last:       MonthRecord{Principal: 1000, TotalPayment: 1000},
+			fixedIndex: -1,
+		},
+		{
+			name:       "special payments in one month add up",
+			loan:       withSpecials,
+			months:     8,
+			payoff:     date(2024, time.August),
+			balances:   []float64{9000, 5500, 4500},
+			last:       MonthRecord{Principal: 500, TotalPayment: 500},
+			fixedIndex: -1,
+		},
+		{
+			name:       "end of the fixed period",
+			loan:       shortFixed,
+			months:     100,
+			payoff:     date(2032, time.April),
+			balances:   []float64{9900, 9800},
+			last:       MonthRecord{Principal: 100, TotalPayment: 100},
+			fixedIndex: 12,
+			fixedRest:  8700,
+		},
+		{
+			name:       "fixed period starting mid-month ends with the first full month after it",
+			loan:       midMonth,
+			months:     100,
+			payoff:     date(2032, time.June),
+			balances:   []float64{9900},
+			last:       MonthRecord{Principal: 100, TotalPayment: 100},
+			fixedIndex: 13,
+			fixedRest:  8600,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Calculate(tt.loan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Schedule) != tt.months || !result.PayoffDate.Equal(tt.payoff) {
+				t.Fatalf("%d months until %s, want %d until %s", len(result.Schedule), result.PayoffDate.Format("2006-01"),
+					tt.months, tt.payoff.Format("2006-01"))
+			}
+			for i, want := range tt.balances {
+				if got := result.Schedule[i].RemainingBalance; !near(got, want) {
+					t.Errorf("balance after month %d = %.2f, want %.2f", i, got, want)
+				}
+			}
+			last := result.Schedule[len(result.Schedule)-1]
+			if !near(last.Principal, tt.last.Principal) || !near(last.TotalPayment, tt.last.TotalPayment) || last.RemainingBalance != 0 {
+				t.Errorf("last month = %+v, want principal %.2f, payment %.2f and nothing left", last, tt.last.Principal, tt.last.TotalPayment)
+			}
+
+			fixedIndex := -1
+			for i, rec := range result.Schedule {
+				if rec.IsFixedPeriodEnd {
+					if fixedIndex >= 0 {
+						t.Errorf("fixed period ends in months %d and %d", fixedIndex, i)
+					}
+					fixedIndex = i
+				}
+			}
+			if fixedIndex != tt.fixedIndex || !near(result.RemainingAtFixedEnd, tt.fixedRest) {
+				t.Errorf("fixed period ends in month %d with %.2f left, want %d with %.2f",
+					fixedIndex, result.RemainingAtFixedEnd, tt.fixedIndex, tt.fixedRest)
+			}
+		})
+	}
+}
+
+// A percentage repayment pays interest and the initial repayment rate on the
+// amount as a constant annuity
+func TestCalculatePercentage(t *testing.T) {
+	loan := &models.Loan{
+		Amount:             120000,
+		InterestRate:       3,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      models.RepaymentTypePercentage,
+		RepaymentValue:     2,
+		SpecialPayments:    []models.SpecialPayment{{ID: "a", Date: "2025-06-01", Amount: 10000}},
+	}
+	result, err := Calculate(loan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 120000 * 5% / 12 = 500 a month, at first 300 of it interest
+	first, second := result.Schedule[0], result.Schedule[1]
+	if !near(first.TotalPayment, 500) || !near(first.Interest, 300) || !near(first.Principal, 200) || !near(first.RemainingBalance, 119800) {
+		t.Errorf("first month = %+v", first)
+	}
+	if !near(second.Interest, 299.5) || !near(second.Principal, 200.5) {
+		t.Errorf("second month = %+v", second)
+	}
+	if special := result.Schedule[17]; special.SpecialPayment != 10000 || !near(special.TotalPayment, 10500) {
+		t.Errorf("month of the special payment = %+v", special)
+	}
+
+	var interest, repaid float64
+	for _, rec := range result.Schedule {
+		interest += rec.Interest
+		repaid += rec.Principal + rec.SpecialPayment
+	}
+	if !near(interest, result.TotalInterest) || !near(repaid, loan.Amount) {
+		t.Errorf("interest %.2f, repaid %.2f, want %.2f and %.2f", interest, repaid, result.TotalInterest, loan.Amount)
+	}
+	if !result.FixedPeriodEndDate.Equal(date(2034, time.January)) || !result.Schedule[120].IsFixedPeriodEnd {
+		t.Errorf("fixed period ends %s", result.FixedPeriodEndDate)
+	}
+}
+
+func TestCalculateInvalidStartDate(t *testing.T) {
+	loan := testLoan(10000, 1000)
+	loan.StartDate = "01.01.2024"
+	if _, err := Calculate(loan); err == nil {
+		t.Error("invalid start date accepted")
+	}
+}
+
+func TestYearlySummary(t *testing.T) {
+	loan := testLoan(3500, 1000)
+	loan.StartDate = "2024-11-01"
+	loan.FixedInterestYears = 0
+	loan.SpecialPayments = []models.SpecialPayment{{ID: "a", Date: "2025-01-01", Amount: 500}}
+	result, err := Calculate(loan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	years := YearlySummary(result.Schedule)
+	want := []YearSummary{
+		{Year: 2024, Principal: 2000, TotalPayment: 2000, RemainingBalance: 1500, FixedPeriodEnd: true},
+		{Year: 2025, Principal: 1000, SpecialPayment: 500, TotalPayment: 1500},
+	}
+	if len(years) != len(want) {
+		t.Fatalf("%d years, want %d", len(years), len(want))
+	}
+	for i, y := range years {
+		if y != want[i] {
+			t.Errorf("year %d = %+v, want %+v", i, y, want[i])
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	loan := testLoan(10000, 1000)
+	loan.InterestRate = 6
+	loan.SpecialPayments = []models.SpecialPayment{
+		{ID: "a", Date: "2024-02-01", Amount: 2000},
+		{ID: "b", Date: "2024-04-01", Amount: 1000},
+	}
+
+	c, err := Compare(loan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Base.Schedule) != 11 || len(c.Actual.Schedule) != 8 || c.MonthsSaved != 3 {
+		t.Errorf("%d months without and %d with special payments, %d saved", len(c.Base.Schedule), len(c.Actual.Schedule), c.MonthsSaved)
+	}
+	if !near(c.InterestSaved, c.Base.TotalInterest-c.Actual.TotalInterest) || c.InterestSaved <= 0 {
+		t.Errorf("interest saved = %.2f", c.InterestSaved)
+	}
+
+	impact, err := PaymentImpact(loan, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if impact.MonthsSaved != 2 || impact.InterestSaved <= 0 || impact.InterestSaved >= c.InterestSaved {
+		t.Errorf("impact of a = %+v, want 2 months and part of %.2f", impact, c.InterestSaved)
+	}
+}
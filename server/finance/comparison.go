@@ -0,0 +1,72 @@
+package finance
+
+import (
+	"math"
+
+	"baufi-optimierer/server/models"
+)
+
+// Comparison compares a loan with and without its special payments
+type Comparison struct {
+	Base           *Result `json:"base"`   // Without special payments
+	Actual         *Result `json:"actual"` // With all special payments
+	InterestSaved  float64 `json:"interestSaved"`
+	MonthsSaved    int     `json:"monthsSaved"`
+	CapitalAtFixed float64 `json:"capitalDifferenceAtFixedEnd"`
+}
+
+// Impact is the effect of a single special payment
+type Impact struct {
+	InterestSaved float64 `json:"interestSaved"`
+	MonthsSaved   int     `json:"monthsSaved"`
+}
+
+// Compare calculates the loan with and without special payments.
+// It mirrors calculateComparison in ui/utils/finance.ts.
+func Compare(loan *models.Loan) (*Comparison, error) {
+	baseLoan := *loan
+	baseLoan.SpecialPayments = nil
+
+	base, err := Calculate(&baseLoan)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := Calculate(loan)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Comparison{
+		Base:           base,
+		Actual:         actual,
+		InterestSaved:  base.TotalInterest - actual.TotalInterest,
+		MonthsSaved:    max(0, len(base.Schedule)-len(actual.Schedule)),
+		CapitalAtFixed: math.Max(0, base.RemainingAtFixedEnd-actual.RemainingAtFixedEnd),
+	}, nil
+}
+
+// PaymentImpact calculates what a single special payment saves compared to
+// the same loan without it. It mirrors calculatePaymentImpact in ui/utils/finance.ts.
+func PaymentImpact(loan *models.Loan, paymentID string) (*Impact, error) {
+	current, err := Calculate(loan)
+	if err != nil {
+		return nil, err
+	}
+
+	without := *loan
+	without.SpecialPayments = nil
+	for _, sp := range loan.SpecialPayments {
+		if sp.ID != paymentID {
+			without.SpecialPayments = append(without.SpecialPayments, sp)
+		}
+	}
+	withoutResult, err := Calculate(&without)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Impact{
+		InterestSaved: math.Max(0, withoutResult.TotalInterest-current.TotalInterest),
+		MonthsSaved:   max(0, len(withoutResult.Schedule)-len(current.Schedule)),
+	}, nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/proxy"
+)
+
+// RegistrationEnabled controls whether new accounts can sign up.
+// The first account can always be created.
+var RegistrationEnabled = true
+
+// dummyHash is compared against when a login email is unknown, so that
+// unknown and known accounts take the same time to reject
+var dummyHash, _ = auth.HashPassword("baufi-optimierer-dummy-password")
+
+// HandleRegister creates a new account and logs it in
+func HandleRegister(w http.ResponseWriter, r *http.Request) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	creds.Normalize()
+
+	if err := creds.ValidateRegister(); err != nil {
+		respondWithValidationError(w, r, err)
+		return
+	}
+
+	if !RegistrationEnabled {
+		hasUsers, err := db.HasUsers(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error counting users", "error", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to create account")
+			return
+		}
+		if hasUsers {
+			respondWithError(w, r, http.StatusForbidden, "registration is disabled")
+			return
+		}
+	}
+
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error hashing password", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create account")
+		return
+	}
+
+	user := models.User{
+		ID:    generateID(),
+		Email: creds.Email,
+		Name:  creds.Name,
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+
+	if err := db.CreateUser(r.Context(), &user, hash); err != nil {
+		respondWithDBError(w, r, err, "Failed to create account")
+		return
+	}
+
+	if err := startSession(w, r, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating session", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, user)
+}
+
+// HandleLogin checks email and password and starts a session
+func HandleLogin(w http.ResponseWriter, r *http.Request) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	creds.Normalize()
+
+	user, hash, err := db.GetUserByEmail(r.Context(), creds.Email)
+	if err != nil && !errors.Is(err, db.ErrUserNotFound) {
+		slog.ErrorContext(r.Context(), "Error fetching user", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	if user == nil || hash == "" {
+		auth.CheckPassword(dummyHash, creds.Password)
+		respondWithError(w, r, http.StatusUnauthorized, "invalid email or password")
+		return
+	}
+	if !auth.CheckPassword(hash, creds.Password) {
+		respondWithError(w, r, http.StatusUnauthorized, "invalid email or password")
+		return
+	}
+
+	if err := startSession(w, r, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating session", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// HandleLogout ends the current session
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(auth.SessionCookie); err == nil && cookie.Value != "" {
+		if err := db.DeleteSession(r.Context(), auth.HashToken(cookie.Value)); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting session", "error", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   proxy.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetCurrentUser returns the logged in user
+func HandleGetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, auth.UserFromContext(r.Context()))
+}
+
+// startSession creates a session for a user and sets the session cookie
+func startSession(w http.ResponseWriter, r *http.Request, userID string) error {
+	token := auth.GenerateToken()
+	expiresAt := time.Now().Add(auth.SessionDuration)
+
+	if err := db.CreateSession(r.Context(), auth.HashToken(token), userID, expiresAt); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   proxy.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// currentUserID returns the ID of the authenticated user.
+// Routes using it are wrapped in middleware.RequireAuth.
+func currentUserID(r *http.Request) string {
+	if user := auth.UserFromContext(r.Context()); user != nil {
+		return user.ID
+	}
+	return ""
+}
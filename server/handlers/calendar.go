@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/report"
+)
+
+// HandleGetCalendarTokens lists the calendar feed tokens of the user
+func HandleGetCalendarTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := db.GetCalendarTokens(r.Context(), currentUserID(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching calendar tokens", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch calendar tokens")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// HandleCreateCalendarToken creates a token for subscribing to the calendar
+// feed of one loan, or of all loans if no loanId is given.
+// The secret is only returned in this response.
+func HandleCreateCalendarToken(w http.ResponseWriter, r *http.Request) {
+	var input models.CalendarToken
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	token := models.CalendarToken{
+		ID:     generateID(),
+		LoanID: input.LoanID,
+		Token:  auth.GenerateToken(),
+	}
+
+	if err := db.CreateCalendarToken(r.Context(), currentUserID(r), &token); err != nil {
+		respondWithDBError(w, r, err, "Failed to create calendar token")
+		return
+	}
+
+	feedPath := "/api/calendar.ics"
+	if token.LoanID != "" {
+		feedPath = "/api/loans/" + token.LoanID + "/calendar.ics"
+	}
+	token.URL = requestBaseURL(r) + feedPath + "?token=" + url.QueryEscape(token.Token)
+
+	respondWithJSON(w, http.StatusCreated, token)
+}
+
+// HandleDeleteCalendarToken revokes a calendar token
+func HandleDeleteCalendarToken(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/calendar-tokens/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid calendar token ID")
+		return
+	}
+
+	err := db.DeleteCalendarToken(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to delete calendar token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleCalendar returns the iCalendar feed of all loans of the token's user.
+// It requires a token that is not bound to a single loan. The token replaces
+// the session, so calendar apps can subscribe without logging in.
+func HandleCalendar(w http.ResponseWriter, r *http.Request) {
+	token, ok := checkCalendarToken(w, r)
+	if !ok {
+		return
+	}
+	if token.LoanID != "" {
+		respondWithError(w, r, http.StatusForbidden, "calendar token is restricted to a single loan")
+		return
+	}
+
+	loans, err := db.GetAllLoans(r.Context(), token.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching loans", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch loans")
+		return
+	}
+
+	writeCalendar(w, r, loans)
+}
+
+// HandleLoanCalendar returns the iCalendar feed of one loan
+func HandleLoanCalendar(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	token, ok := checkCalendarToken(w, r)
+	if !ok {
+		return
+	}
+	if token.LoanID != "" && token.LoanID != id {
+		respondWithError(w, r, http.StatusForbidden, "calendar token is not valid for this loan")
+		return
+	}
+
+	loan, err := db.GetLoan(r.Context(), token.UserID, id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return
+	}
+
+	writeCalendar(w, r, []models.Loan{*loan})
+}
+
+// checkCalendarToken validates the token query parameter.
+// It writes an error response and returns false if the token is invalid.
+func checkCalendarToken(w http.ResponseWriter, r *http.Request) (*models.CalendarToken, bool) {
+	secret := r.URL.Query().Get("token")
+	if secret == "" {
+		respondWithError(w, r, http.StatusUnauthorized, "calendar token required")
+		return nil, false
+	}
+
+	token, err := db.UseCalendarToken(r.Context(), secret)
+	if err != nil {
+		if errors.Is(err, db.ErrCalendarTokenNotFound) {
+			respondWithError(w, r, http.StatusUnauthorized, "invalid calendar token")
+			return nil, false
+		}
+		slog.ErrorContext(r.Context(), "Error checking calendar token", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to check calendar token")
+		return nil, false
+	}
+
+	return token, true
+}
+
+// writeCalendar renders the feed in the language given by the lang query parameter
+func writeCalendar(w http.ResponseWriter, r *http.Request, loans []models.Loan) {
+	labels, ok := report.LabelsFor(r.URL.Query().Get("lang"))
+	if !ok {
+		respondWithError(w, r, http.StatusBadRequest, "lang must be de or en")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCalendar(&buf, loans, labels, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing calendar", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to generate calendar")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// RequireIfMatch makes If-Match mandatory for changing and deleting loans.
+// Otherwise the header is honoured when present.
+var RequireIfMatch = false
+
+// loanETag returns the entity tag of a loan, derived from its version. The
+// version also changes with the special payments the representation contains.
+func loanETag(loan *models.Loan) string {
+	return `"` + strconv.Itoa(loan.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match header value lists the entity tag.
+// Weak tags never match, as If-Match requires the strong comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagMatchesWeak reports whether an If-None-Match header value lists the
+// entity tag. If-None-Match uses the weak comparison (RFC 9110 13.1.2), so
+// W/"3" matches "3".
+func etagMatchesWeak(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondWithLoan sends a loan together with its ETag
+func respondWithLoan(w http.ResponseWriter, code int, loan *models.Loan) {
+	w.Header().Set("ETag", loanETag(loan))
+	respondWithJSON(w, code, loan)
+}
+
+// checkIfMatch evaluates the If-Match header against the current loan. On a
+// mismatch it responds with 412 and the current representation, so the
+// client can merge its changes. It returns false if the request must not proceed.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, loan *models.Loan) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if RequireIfMatch {
+			respondWithError(w, r, http.StatusPreconditionRequired, "If-Match header required")
+			return false
+		}
+		return true
+	}
+
+	if !etagMatches(header, loanETag(loan)) {
+		respondWithLoan(w, http.StatusPreconditionFailed, loan)
+		return false
+	}
+	return true
+}
+
+// respondWithLoanConflict answers a write that lost a race against another
+// change with the current representation of the loan: 412 if the client
+// sent If-Match, 409 otherwise.
+func respondWithLoanConflict(w http.ResponseWriter, r *http.Request, id string) {
+	loan, err := db.GetLoan(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return
+	}
+
+	status := http.StatusConflict
+	if r.Header.Get("If-Match") != "" {
+		status = http.StatusPreconditionFailed
+	}
+	respondWithLoan(w, status, loan)
+}
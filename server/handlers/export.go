@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// HandleExport returns all loans and special payments of a household as a
+// versioned JSON document. The householdId query parameter selects the
+// household, by default the user's default household is exported.
+func HandleExport(w http.ResponseWriter, r *http.Request) {
+	householdID, _, ok := targetHousehold(w, r, r.URL.Query().Get("householdId"), models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	doc, err := db.ExportData(r.Context(), currentUserID(r), householdID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error exporting data", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to export data")
+		return
+	}
+
+	filename := fmt.Sprintf("baufi-export-%s.json", time.Now().UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	respondWithJSON(w, http.StatusOK, doc)
+}
+
+// HandleImport restores loans and special payments from an export document.
+// Requires the editor role in the target household.
+// Query parameters:
+//   - householdId: target household, by default the user's default household
+//   - mode: "merge" (default) or "replace"
+//   - onConflict: "skip" (default) or "overwrite", only used in merge mode
+func HandleImport(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.ImportModeMerge
+	}
+	if mode != models.ImportModeMerge && mode != models.ImportModeReplace {
+		respondWithError(w, r, http.StatusBadRequest, "mode must be merge or replace")
+		return
+	}
+
+	onConflict := r.URL.Query().Get("onConflict")
+	if onConflict == "" {
+		onConflict = models.ConflictSkip
+	}
+	if onConflict != models.ConflictSkip && onConflict != models.ConflictOverwrite {
+		respondWithError(w, r, http.StatusBadRequest, "onConflict must be skip or overwrite")
+		return
+	}
+
+	var doc models.ExportDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := doc.Validate(); err != nil {
+		respondWithValidationError(w, r, err)
+		return
+	}
+
+	householdID, _, ok := targetHousehold(w, r, r.URL.Query().Get("householdId"), models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	result, err := db.ImportData(r.Context(), currentUserID(r), householdID, &doc, mode, onConflict)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to import data")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// openTestDB initializes a fresh database in a temporary directory
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := db.InitDB(filepath.Join(t.TempDir(), "test.db"), 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		db.DB = nil
+	})
+}
+
+// createTestUser creates a user with a password-less account
+func createTestUser(t *testing.T, name string) *models.User {
+	t.Helper()
+	user := &models.User{ID: generateID(), Email: name + "@example.com", Name: name}
+	if err := db.CreateUser(context.Background(), user, ""); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
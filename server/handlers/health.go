@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"baufi-optimierer/server/certs"
+	"baufi-optimierer/server/db"
+)
+
+// DataDir is the directory of the database. The server is not ready if it
+// cannot write there, e.g. because the volume is full or mounted read-only.
+var DataDir string
+
+// TLSCertificate is the certificate the server is serving, if it serves HTTPS.
+// Readiness fails once it has expired and reports which one is loaded.
+var TLSCertificate *certs.Reloader
+
+// shuttingDown is set when the server stops accepting requests
+var shuttingDown atomic.Bool
+
+// BeginShutdown makes readiness fail, so load balancers stop sending
+// requests while the server drains the ones in flight
+func BeginShutdown() {
+	shuttingDown.Store(true)
+}
+
+// readinessTimeout bounds the time all readiness checks may take together
+const readinessTimeout = 2 * time.Second
+
+// healthStatus is the response of the health endpoints
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"` // Check name -> "ok" or the error
+	TLS    *certs.Info       `json:"tls,omitempty"`
+}
+
+// readinessChecks are the checks of HandleReadyz by name
+var readinessChecks = []struct {
+	name  string
+	check func(ctx context.Context) error
+}{
+	{"shutdown", checkShutdown},
+	{"database", db.Ping},
+	{"schema", db.CheckSchema},
+	{"dataDir", checkDataDir},
+	{"tls", checkTLS},
+}
+
+// HandleHealthz reports that the process is up and serving requests. It
+// does not check dependencies, so a failing database does not restart it.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// HandleReadyz reports whether the server can handle requests: it is not
+// shutting down, the database answers, its schema is current and the data
+// directory is writable. It responds 503 with the failed checks otherwise.
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	response := healthStatus{Status: "ok", Checks: make(map[string]string)}
+	code := http.StatusOK
+	for _, c := range readinessChecks {
+		if err := c.check(ctx); err != nil {
+			slog.WarnContext(ctx, "Readiness check failed", "check", c.name, "error", err)
+			response.Checks[c.name] = err.Error()
+			response.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		response.Checks[c.name] = "ok"
+	}
+	if TLSCertificate != nil {
+		info := TLSCertificate.Info()
+		response.TLS = &info
+	}
+	respondWithJSON(w, code, response)
+}
+
+// checkShutdown fails once the server is shutting down
+func checkShutdown(ctx context.Context) error {
+	if shuttingDown.Load() {
+		return errors.New("server is shutting down")
+	}
+	return nil
+}
+
+// checkTLS fails if the certificate is expired or not yet valid
+func checkTLS(ctx context.Context) error {
+	if TLSCertificate == nil {
+		return nil
+	}
+	return TLSCertificate.Check(ctx)
+}
+
+// checkDataDir creates and removes a file in the data directory
+func checkDataDir(ctx context.Context) error {
+	if DataDir == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(DataDir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write([]byte("ok")); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
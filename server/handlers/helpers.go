@@ -2,22 +2,66 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/google/uuid"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/problem"
+	"baufi-optimierer/server/proxy"
 )
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error"`
+// respondWithError sends an RFC 7807 problem response with the default
+// error code of the status
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	problem.Error(w, r, code, message)
 }
 
-// respondWithError sends a JSON error response
-func respondWithError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+// respondWithValidationError sends all violations of a failed validation,
+// or a 500 response for any other error
+func respondWithValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs models.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		problem.WriteValidation(w, r, validationErrs)
+		return
+	}
+	respondWithError(w, r, http.StatusInternalServerError, "Validation error")
+}
+
+// statusForError maps the errors of the db package to HTTP status codes.
+// Errors it does not know are internal errors.
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrQuotaExceeded), errors.Is(err, db.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondWithDBError sends the response for an error of the db package.
+// Internal errors are logged and answered with message, so their details
+// are not exposed to the client.
+func respondWithDBError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	status := statusForError(err)
+	if status == http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Error handling request", "method", r.Method, "path", r.URL.Path, "error", err)
+		respondWithError(w, r, status, message)
+		return
+	}
+	if errors.Is(err, db.ErrQuotaExceeded) {
+		problem.Write(w, r, status, problem.CodeQuotaExceeded, err.Error())
+		return
+	}
+	respondWithError(w, r, status, err.Error())
 }
 
 // respondWithJSON sends a JSON response
@@ -32,6 +76,15 @@ func generateID() string {
 	return uuid.New().String()
 }
 
+// requestBaseURL returns scheme and host the client used to reach the server
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if proxy.IsHTTPS(r) {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
 // extractIDFromPath extracts the first ID from a path
 // e.g., "/api/loans/abc123" with prefix "/api/loans/" returns "abc123"
 func extractIDFromPath(path string, prefix string) string {
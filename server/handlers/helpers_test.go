@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/problem"
+)
+
+func TestRespondWithDBError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{db.ErrLoanNotFound, http.StatusNotFound, problem.CodeNotFound},
+		{db.ErrHouseholdNotFound, http.StatusNotFound, problem.CodeNotFound},
+		{db.ErrSessionNotFound, http.StatusNotFound, problem.CodeNotFound},
+		{db.ErrConflict, http.StatusConflict, problem.CodeConflict},
+		{db.ErrVersionConflict, http.StatusConflict, problem.CodeConflict},
+		{db.ErrEmailTaken, http.StatusConflict, problem.CodeConflict},
+		{db.ErrIdentityLinked, http.StatusConflict, problem.CodeConflict},
+		{db.ErrLastOwner, http.StatusConflict, problem.CodeConflict},
+		{db.ErrLoanQuotaExceeded, http.StatusForbidden, problem.CodeQuotaExceeded},
+		{db.ErrPaymentQuotaExceeded, http.StatusForbidden, problem.CodeQuotaExceeded},
+		{db.ErrPersonalHousehold, http.StatusForbidden, problem.CodeForbidden},
+		{sql.ErrNoRows, http.StatusInternalServerError, problem.CodeInternal},
+		{errors.New("disk I/O error"), http.StatusInternalServerError, problem.CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			err := fmt.Errorf("handling request: %w", tt.err)
+			if status := statusForError(err); status != tt.status {
+				t.Errorf("statusForError() = %d, want %d", status, tt.status)
+			}
+
+			r := httptest.NewRequest("GET", "/api/loans/1", nil)
+			w := httptest.NewRecorder()
+			respondWithDBError(w, r, err, "Failed to fetch loan")
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != tt.code || p.Status != tt.status {
+				t.Errorf("problem code %q status %d, want %q %d", p.Code, p.Status, tt.code, tt.status)
+			}
+			// Internal errors are not shown to the client
+			if tt.status == http.StatusInternalServerError && p.Detail != "Failed to fetch loan" {
+				t.Errorf("detail = %q, want the generic message", p.Detail)
+			}
+			if tt.status != http.StatusInternalServerError && !strings.Contains(p.Detail, tt.err.Error()) {
+				t.Errorf("detail = %q, want it to contain %q", p.Detail, tt.err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// HandleGetLoanHistory returns the audit trail of a loan and its special
+// payments, newest first. Requires the viewer role.
+func HandleGetLoanHistory(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if loanID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleViewer) {
+		return
+	}
+
+	entries, err := db.GetLoanHistory(r.Context(), loanID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching history of loan", "loan_id", loanID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch history")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
+// HandleRestoreLoanVersion resets a loan and its special payments to the
+// version right after a history entry and returns the restored loan.
+// Requires the editor role.
+func HandleRestoreLoanVersion(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	entryID, err := strconv.ParseInt(extractIDFromPath(r.URL.Path, "/api/loans/"+loanID+"/history/"), 10, 64)
+	if loanID == "" || err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan or history entry ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	if err := db.RestoreLoanVersion(r.Context(), currentUserID(r), loanID, entryID); err != nil {
+		respondWithDBError(w, r, err, "Failed to restore loan")
+		return
+	}
+
+	loan, err := db.GetLoan(r.Context(), currentUserID(r), loanID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching restored loan", "loan_id", loanID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch loan")
+		return
+	}
+
+	respondWithLoan(w, http.StatusOK, loan)
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// HandleGetHouseholds lists the households of the user with the user's role
+func HandleGetHouseholds(w http.ResponseWriter, r *http.Request) {
+	households, err := db.GetHouseholds(r.Context(), currentUserID(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching households", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch households")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, households)
+}
+
+// HandleCreateHousehold creates a household owned by the user
+func HandleCreateHousehold(w http.ResponseWriter, r *http.Request) {
+	var household models.Household
+	if err := json.NewDecoder(r.Body).Decode(&household); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !validateHousehold(w, r, &household) {
+		return
+	}
+
+	household.ID = generateID()
+
+	if err := db.CreateHousehold(r.Context(), currentUserID(r), &household); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating household", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create household")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, household)
+}
+
+// HandleGetHousehold returns a household of the user
+func HandleGetHousehold(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	household, err := db.GetHousehold(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch household")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, household)
+}
+
+// HandleUpdateHousehold renames a household. Requires the owner role.
+func HandleUpdateHousehold(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	var household models.Household
+	if err := json.NewDecoder(r.Body).Decode(&household); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !validateHousehold(w, r, &household) {
+		return
+	}
+
+	household.ID = id
+	if err := db.UpdateHousehold(r.Context(), &household); err != nil {
+		respondWithDBError(w, r, err, "Failed to update household")
+		return
+	}
+
+	updated, err := db.GetHousehold(r.Context(), currentUserID(r), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching updated household", "household_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch updated household")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeleteHousehold deletes a household with all its loans. Requires the owner role.
+func HandleDeleteHousehold(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	if err := db.DeleteHousehold(r.Context(), currentUserID(r), id); err != nil {
+		respondWithDBError(w, r, err, "Failed to delete household")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetHouseholdMembers lists the members of a household
+func HandleGetHouseholdMembers(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleViewer); !ok {
+		return
+	}
+
+	members, err := db.GetHouseholdMembers(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching members of household", "household_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch members")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+// HandleUpdateHouseholdMember changes the role of a member. Requires the owner role.
+func HandleUpdateHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	userID := extractIDFromPath(r.URL.Path, "/api/households/"+id+"/members/")
+	if id == "" || userID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household or user ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := models.ValidateRole(input.Role); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := db.UpdateHouseholdMemberRole(r.Context(), id, userID, input.Role); err != nil {
+		respondWithDBError(w, r, err, "Failed to update member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRemoveHouseholdMember removes a member from a household. Owners can
+// remove anyone, other members can only remove themselves (leave).
+func HandleRemoveHouseholdMember(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	userID := extractIDFromPath(r.URL.Path, "/api/households/"+id+"/members/")
+	if id == "" || userID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household or user ID")
+		return
+	}
+
+	required := models.RoleOwner
+	if userID == currentUserID(r) {
+		required = models.RoleViewer
+	}
+	if _, ok := authorizeHousehold(w, r, id, required); !ok {
+		return
+	}
+
+	if err := db.RemoveHouseholdMember(r.Context(), id, userID); err != nil {
+		respondWithDBError(w, r, err, "Failed to remove member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetHouseholdInvites lists the open invites of a household. Requires the owner role.
+func HandleGetHouseholdInvites(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	invites, err := db.GetHouseholdInvites(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching invites of household", "household_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch invites")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, invites)
+}
+
+// HandleCreateHouseholdInvite creates an invite link for a household.
+// The role defaults to viewer. The secret is only returned in this response.
+// Requires the owner role.
+func HandleCreateHouseholdInvite(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	var input models.HouseholdInvite
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if input.Role == "" {
+		input.Role = models.RoleViewer
+	}
+	if err := models.ValidateRole(input.Role); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invite := models.HouseholdInvite{
+		ID:          generateID(),
+		HouseholdID: id,
+		Role:        input.Role,
+		Token:       auth.GenerateToken(),
+	}
+
+	if err := db.CreateHouseholdInvite(r.Context(), currentUserID(r), &invite); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating invite for household", "household_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create invite")
+		return
+	}
+
+	invite.URL = requestBaseURL(r) + "/?invite=" + url.QueryEscape(invite.Token)
+
+	respondWithJSON(w, http.StatusCreated, invite)
+}
+
+// HandleDeleteHouseholdInvite revokes an invite. Requires the owner role.
+func HandleDeleteHouseholdInvite(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/households/")
+	inviteID := extractIDFromPath(r.URL.Path, "/api/households/"+id+"/invites/")
+	if id == "" || inviteID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid household or invite ID")
+		return
+	}
+
+	if _, ok := authorizeHousehold(w, r, id, models.RoleOwner); !ok {
+		return
+	}
+
+	if err := db.DeleteHouseholdInvite(r.Context(), id, inviteID); err != nil {
+		respondWithDBError(w, r, err, "Failed to delete invite")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAcceptInvite adds the user to the household of an invite.
+// The token is sent in the body so it does not end up in access logs.
+func HandleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		respondWithError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	household, err := db.AcceptHouseholdInvite(r.Context(), currentUserID(r), input.Token)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to accept invite")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, household)
+}
+
+// authorizeHousehold checks that the user has at least the required role in
+// a household. It writes an error response and returns false otherwise.
+func authorizeHousehold(w http.ResponseWriter, r *http.Request, householdID, required string) (string, bool) {
+	role, err := db.GetHouseholdRole(r.Context(), currentUserID(r), householdID)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to check permissions")
+		return "", false
+	}
+
+	if !models.RoleAllows(role, required) {
+		respondWithError(w, r, http.StatusForbidden, "this requires the "+required+" role in the household")
+		return "", false
+	}
+
+	return role, true
+}
+
+// authorizeLoan checks that the user has at least the required role in the
+// household of a loan. It writes an error response and returns false otherwise.
+func authorizeLoan(w http.ResponseWriter, r *http.Request, loanID, required string) bool {
+	role, err := db.GetLoanRole(r.Context(), currentUserID(r), loanID)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to check permissions")
+		return false
+	}
+
+	if !models.RoleAllows(role, required) {
+		respondWithError(w, r, http.StatusForbidden, "this requires the "+required+" role in the household")
+		return false
+	}
+
+	return true
+}
+
+// targetHousehold resolves the household a request writes to or reads from:
+// the given ID, or the user's default household if empty. It checks the
+// required role and returns the user's role. It writes an error response if
+// the household is not usable.
+func targetHousehold(w http.ResponseWriter, r *http.Request, householdID, required string) (string, string, bool) {
+	if householdID == "" {
+		id, err := db.GetDefaultHouseholdID(r.Context(), currentUserID(r))
+		if err != nil {
+			if errors.Is(err, db.ErrHouseholdNotFound) {
+				respondWithError(w, r, http.StatusBadRequest, "householdId is required")
+				return "", "", false
+			}
+			slog.ErrorContext(r.Context(), "Error fetching default household", "error", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch household")
+			return "", "", false
+		}
+		householdID = id
+	}
+
+	role, ok := authorizeHousehold(w, r, householdID, required)
+	if !ok {
+		return "", "", false
+	}
+	return householdID, role, true
+}
+
+// validateHousehold validates a household and writes an error response if invalid
+func validateHousehold(w http.ResponseWriter, r *http.Request, household *models.Household) bool {
+	if err := household.Validate(); err != nil {
+		respondWithValidationError(w, r, err)
+		return false
+	}
+	return true
+}
@@ -3,192 +3,244 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
-	"strings"
 
 	"baufi-optimierer/server/db"
 	"baufi-optimierer/server/models"
 )
 
-// HandleGetAllLoans returns all loans with their special payment details
+// HandleGetAllLoans returns the loans of all households of the user with
+// their special payment details. The householdId query parameter restricts
+// the list to one household.
 func HandleGetAllLoans(w http.ResponseWriter, r *http.Request) {
-	loans, err := db.GetAllLoans()
+	all, err := db.GetAllLoans(r.Context(), currentUserID(r))
 	if err != nil {
-		log.Printf("Error fetching loans: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loans")
+		slog.ErrorContext(r.Context(), "Error fetching loans", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch loans")
 		return
 	}
 
-	if loans == nil {
-		loans = []models.Loan{}
+	householdID := r.URL.Query().Get("householdId")
+	loans := []models.Loan{}
+	for _, loan := range all {
+		if householdID == "" || loan.HouseholdID == householdID {
+			loans = append(loans, loan)
+		}
 	}
 
 	respondWithJSON(w, http.StatusOK, loans)
 }
 
-// HandleGetLoan returns a single loan with all special payments
+// HandleGetLoan returns a single loan with all special payments and its
+// ETag. A matching If-None-Match yields 304 Not Modified.
 func HandleGetLoan(w http.ResponseWriter, r *http.Request) {
 	id := extractIDFromPath(r.URL.Path, "/api/loans/")
 	if id == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
 		return
 	}
 
-	loan, err := db.GetLoan(id)
+	loan, err := db.GetLoan(r.Context(), currentUserID(r), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			respondWithError(w, http.StatusNotFound, "loan not found")
-			return
-		}
-		log.Printf("Error fetching loan %s: %v", id, err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loan")
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatchesWeak(match, loanETag(loan)) {
+		w.Header().Set("ETag", loanETag(loan))
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, loan)
+	respondWithLoan(w, http.StatusOK, loan)
 }
 
-// HandleCreateLoan creates a new loan
+// HandleCreateLoan creates a new loan in the given household, or in the
+// user's default household. Requires the editor role.
 func HandleCreateLoan(w http.ResponseWriter, r *http.Request) {
 	var loanInput models.Loan
 	if err := json.NewDecoder(r.Body).Decode(&loanInput); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if err := loanInput.ValidateCreate(); err != nil {
-		var validationErr models.ValidationError
-		if errors.As(err, &validationErr) {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Validation error")
-		}
+		respondWithValidationError(w, r, err)
+		return
+	}
+
+	householdID, role, ok := targetHousehold(w, r, loanInput.HouseholdID, models.RoleEditor)
+	if !ok {
 		return
 	}
 
 	// Generate ID
 	loanInput.ID = generateID()
+	loanInput.HouseholdID = householdID
+	loanInput.Role = role
 
-	if err := db.CreateLoan(&loanInput); err != nil {
-		log.Printf("Error creating loan: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to create loan")
+	if err := db.CreateLoan(r.Context(), currentUserID(r), &loanInput); err != nil {
+		respondWithDBError(w, r, err, "Failed to create loan")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, loanInput)
+	respondWithLoan(w, http.StatusCreated, &loanInput)
 }
 
-// HandleUpdateLoan updates an existing loan
+// HandleUpdateLoan updates the fields of an existing loan that the body
+// contains. Members are type checked strictly and unknown ones are rejected.
+// An If-Match header must match the current ETag. Requires the editor role.
 func HandleUpdateLoan(w http.ResponseWriter, r *http.Request) {
 	id := extractIDFromPath(r.URL.Path, "/api/loans/")
 	if id == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, id, models.RoleEditor) {
 		return
 	}
 
 	// Get existing loan first
-	existingLoan, err := db.GetLoan(id)
+	existingLoan, err := db.GetLoan(r.Context(), currentUserID(r), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "no rows") {
-			respondWithError(w, http.StatusNotFound, "loan not found")
-			return
-		}
-		log.Printf("Error fetching loan %s: %v", id, err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch loan")
+		respondWithDBError(w, r, err, "Failed to fetch loan")
 		return
 	}
 
-	// Decode update request (partial update)
-	var updateData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+	if !checkIfMatch(w, r, existingLoan) {
+		return
+	}
+
+	// Fields that are left out keep their value
+	var update map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil || update == nil {
+		respondWithError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
 		return
 	}
 
-	// Apply updates to existing loan
 	loanToUpdate := *existingLoan
+	if err := loanToUpdate.ApplyUpdate(update); err != nil {
+		respondWithValidationError(w, r, err)
+		return
+	}
 
-	// Update only provided fields
-	if name, ok := updateData["name"]; ok {
-		if str, ok := name.(string); ok {
-			loanToUpdate.Name = str
-		}
+	saveLoan(w, r, &loanToUpdate)
+}
+
+// HandlePatchLoan applies a JSON Merge Patch (RFC 7396) to a loan. Members
+// are type checked strictly, null clears a field, and the merged loan must
+// pass the same validation as a new loan. An If-Match header must match the
+// current ETag. Requires the editor role.
+func HandlePatchLoan(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
 	}
-	if amount, ok := updateData["amount"]; ok {
-		if num, ok := amount.(float64); ok {
-			loanToUpdate.Amount = num
-		}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != models.MergePatchContentType && mediaType != "application/json" {
+		w.Header().Set("Accept-Patch", models.MergePatchContentType)
+		respondWithError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be "+models.MergePatchContentType)
+		return
 	}
-	if rate, ok := updateData["interestRate"]; ok {
-		if num, ok := rate.(float64); ok {
-			loanToUpdate.InterestRate = num
-		}
+
+	if !authorizeLoan(w, r, id, models.RoleEditor) {
+		return
 	}
-	if date, ok := updateData["startDate"]; ok {
-		if str, ok := date.(string); ok {
-			loanToUpdate.StartDate = str
-		}
+
+	existingLoan, err := db.GetLoan(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return
 	}
-	if years, ok := updateData["fixedInterestYears"]; ok {
-		if num, ok := years.(float64); ok {
-			loanToUpdate.FixedInterestYears = int(num)
-		}
+
+	if !checkIfMatch(w, r, existingLoan) {
+		return
 	}
-	if repaymentType, ok := updateData["repaymentType"]; ok {
-		if str, ok := repaymentType.(string); ok {
-			loanToUpdate.RepaymentType = str
-		}
+
+	// A patch that is not an object would replace the whole loan
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		respondWithError(w, r, http.StatusBadRequest, "Request body must be a JSON object")
+		return
 	}
-	if repaymentValue, ok := updateData["repaymentValue"]; ok {
-		if num, ok := repaymentValue.(float64); ok {
-			loanToUpdate.RepaymentValue = num
-		}
+
+	loanToUpdate := *existingLoan
+	if err := loanToUpdate.ApplyMergePatch(patch); err != nil {
+		respondWithValidationError(w, r, err)
+		return
 	}
 
-	if err := loanToUpdate.ValidateUpdate(); err != nil {
-		var validationErr models.ValidationError
-		if errors.As(err, &validationErr) {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Validation error")
-		}
+	saveLoan(w, r, &loanToUpdate)
+}
+
+// saveLoan validates a changed loan like a new one, stores it and responds
+// with the updated loan. A concurrent change of the loan is answered with
+// its current representation.
+func saveLoan(w http.ResponseWriter, r *http.Request, loan *models.Loan) {
+	if err := loan.ValidateCreate(); err != nil {
+		respondWithValidationError(w, r, err)
 		return
 	}
 
-	if err := db.UpdateLoan(&loanToUpdate); err != nil {
-		log.Printf("Error updating loan %s: %v", id, err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to update loan")
+	if err := db.UpdateLoan(r.Context(), currentUserID(r), loan); err != nil {
+		if errors.Is(err, db.ErrVersionConflict) {
+			respondWithLoanConflict(w, r, loan.ID)
+			return
+		}
+		respondWithDBError(w, r, err, "Failed to update loan")
 		return
 	}
 
 	// Fetch and return updated loan with special payments
-	updated, err := db.GetLoan(id)
+	updated, err := db.GetLoan(r.Context(), currentUserID(r), loan.ID)
 	if err != nil {
-		log.Printf("Error fetching updated loan %s: %v", id, err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to fetch updated loan")
+		slog.ErrorContext(r.Context(), "Error fetching updated loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch updated loan")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, updated)
+	respondWithLoan(w, http.StatusOK, updated)
 }
 
-// HandleDeleteLoan deletes a loan and its special payments
+// HandleDeleteLoan moves a loan and its special payments to the trash. An
+// If-Match header must match the current ETag. Requires the editor role.
 func HandleDeleteLoan(w http.ResponseWriter, r *http.Request) {
 	id := extractIDFromPath(r.URL.Path, "/api/loans/")
 	if id == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
 		return
 	}
 
-	err := db.DeleteLoan(id)
+	if !authorizeLoan(w, r, id, models.RoleEditor) {
+		return
+	}
+
+	// The version is only checked when the client sends a precondition
+	version := 0
+	if r.Header.Get("If-Match") != "" || RequireIfMatch {
+		loan, err := db.GetLoan(r.Context(), currentUserID(r), id)
+		if err != nil {
+			respondWithDBError(w, r, err, "Failed to fetch loan")
+			return
+		}
+		if !checkIfMatch(w, r, loan) {
+			return
+		}
+		version = loan.Version
+	}
+
+	err := db.DeleteLoan(r.Context(), currentUserID(r), id, version)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			respondWithError(w, http.StatusNotFound, err.Error())
+		if errors.Is(err, db.ErrVersionConflict) {
+			respondWithLoanConflict(w, r, id)
 			return
 		}
-		log.Printf("Error deleting loan %s: %v", id, err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to delete loan")
+		respondWithDBError(w, r, err, "Failed to delete loan")
 		return
 	}
 
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/problem"
+)
+
+func TestUpdateLoanBody(t *testing.T) {
+	openTestDB(t)
+	user := createTestUser(t, "anna")
+	loan := &models.Loan{
+		ID:                 generateID(),
+		Name:               "Haus",
+		Amount:             300000,
+		InterestRate:       3.5,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      models.RepaymentTypePercentage,
+		RepaymentValue:     2,
+		HouseholdID:        user.ID,
+	}
+	if err := db.CreateLoan(context.Background(), user.ID, loan); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		body        string
+		status      int
+		pointer     string // Of the expected violation
+		code        string
+		wantName    string
+		contentType string
+	}{
+		{name: "PUT wrong type", method: "PUT", body: `{"amount": "300000"}`, status: http.StatusBadRequest, pointer: "/amount", code: models.ViolationMustBeNumber},
+		{name: "PUT unknown field", method: "PUT", body: `{"nmae": "Wohnung"}`, status: http.StatusBadRequest, pointer: "/nmae", code: models.ViolationUnknownField},
+		{name: "PUT not an object", method: "PUT", body: `["Wohnung"]`, status: http.StatusBadRequest},
+		{name: "PATCH wrong type", method: "PATCH", body: `{"amount": "300000"}`, status: http.StatusBadRequest, pointer: "/amount", code: models.ViolationMustBeNumber},
+		{name: "PATCH unknown field", method: "PATCH", body: `{"nmae": "Wohnung"}`, status: http.StatusBadRequest, pointer: "/nmae", code: models.ViolationUnknownField},
+		{name: "PATCH read-only id", method: "PATCH", body: `{"id": "other"}`, status: http.StatusBadRequest, pointer: "/id", code: models.ViolationReadOnly},
+		{name: "PATCH null of a required field", method: "PATCH", body: `{"name": null}`, status: http.StatusBadRequest, pointer: "/name", code: models.ViolationRequired},
+		{name: "PUT the loan as returned", method: "PUT", body: `{"id": "other", "version": 1, "name": "Wohnung"}`, status: http.StatusOK, wantName: "Wohnung"},
+		{name: "PATCH", method: "PATCH", body: `{"name": "Garage"}`, status: http.StatusOK, wantName: "Garage", contentType: models.MergePatchContentType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/loans/"+loan.ID, strings.NewReader(tt.body))
+			r = r.WithContext(auth.WithUser(r.Context(), user))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			if tt.method == "PUT" {
+				HandleUpdateLoan(w, r)
+			} else {
+				HandlePatchLoan(w, r)
+			}
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				var updated models.Loan
+				if err := json.NewDecoder(w.Body).Decode(&updated); err != nil {
+					t.Fatal(err)
+				}
+				if updated.ID != loan.ID || updated.Name != tt.wantName {
+					t.Errorf("updated loan %s is named %q, want %s named %q", updated.ID, updated.Name, loan.ID, tt.wantName)
+				}
+				return
+			}
+			if tt.pointer == "" {
+				return
+			}
+
+			var p problem.Problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != problem.CodeValidationFailed || len(p.Errors) != 1 ||
+				p.Errors[0].Pointer != tt.pointer || p.Errors[0].Code != tt.code {
+				t.Errorf("problem = %+v, want %s %s", p, tt.pointer, tt.code)
+			}
+		})
+	}
+}
+
+func TestGetLoanConditional(t *testing.T) {
+	openTestDB(t)
+	user := createTestUser(t, "anna")
+	loan := &models.Loan{
+		ID:                 generateID(),
+		Name:               "Haus",
+		Amount:             300000,
+		InterestRate:       3.5,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      models.RepaymentTypePercentage,
+		RepaymentValue:     2,
+		HouseholdID:        user.ID,
+	}
+	if err := db.CreateLoan(context.Background(), user.ID, loan); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/loans/"+loan.ID, nil)
+		r = r.WithContext(auth.WithUser(r.Context(), user))
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		HandleGetLoan(w, r)
+		return w
+	}
+
+	etag := get("").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+	if w := get("W/" + etag); w.Code != http.StatusNotModified {
+		t.Fatalf("weak tag: status = %d, want 304", w.Code)
+	}
+
+	// A new special payment changes the representation and thus the ETag
+	r := httptest.NewRequest("POST", "/api/loans/"+loan.ID+"/special-payments",
+		strings.NewReader(`{"date": "2025-01-01", "amount": 5000}`))
+	r = r.WithContext(auth.WithUser(r.Context(), user))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	HandleCreateSpecialPayment(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create payment: status = %d: %s", w.Code, w.Body)
+	}
+
+	w = get(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status after payment = %d, want 200", w.Code)
+	}
+	var got models.Loan
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.SpecialPayments) != 1 || w.Header().Get("ETag") == etag {
+		t.Errorf("got %d payments with ETag %s, want 1 with a new ETag", len(got.SpecialPayments), w.Header().Get("ETag"))
+	}
+}
+
+// Exceeded quotas are answered with 403 and the quota_exceeded code
+func TestCreateQuotaExceeded(t *testing.T) {
+	openTestDB(t)
+	db.MaxLoansPerUser, db.MaxPaymentsPerLoan = 1, 1
+	defer func() { db.MaxLoansPerUser, db.MaxPaymentsPerLoan = 0, 0 }()
+	user := createTestUser(t, "anna")
+
+	post := func(target, body string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		r = r.WithContext(auth.WithUser(r.Context(), user))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	const loanBody = `{"name": "Haus", "amount": 300000, "interestRate": 3.5, "startDate": "2024-01-01",
+		"fixedInterestYears": 10, "repaymentType": "PERCENTAGE", "repaymentValue": 2}`
+	const paymentBody = `{"date": "2025-01-01", "amount": 5000}`
+
+	w := post("/api/loans", loanBody, HandleCreateLoan)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("first loan: status = %d: %s", w.Code, w.Body)
+	}
+	var loan models.Loan
+	if err := json.NewDecoder(w.Body).Decode(&loan); err != nil {
+		t.Fatal(err)
+	}
+	if w := post("/api/loans/"+loan.ID+"/special-payments", paymentBody, HandleCreateSpecialPayment); w.Code != http.StatusCreated {
+		t.Fatalf("first payment: status = %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name string
+		w    *httptest.ResponseRecorder
+	}{
+		{"loan", post("/api/loans", loanBody, HandleCreateLoan)},
+		{"special payment", post("/api/loans/"+loan.ID+"/special-payments", paymentBody, HandleCreateSpecialPayment)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403: %s", tt.w.Code, tt.w.Body)
+			}
+			var p problem.Problem
+			if err := json.NewDecoder(tt.w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != problem.CodeQuotaExceeded {
+				t.Errorf("code = %q, want %q", p.Code, problem.CodeQuotaExceeded)
+			}
+		})
+	}
+}
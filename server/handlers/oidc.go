@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/proxy"
+)
+
+// OIDCProvider enables single sign-on when set
+var OIDCProvider *auth.OIDCProvider
+
+// oidcStateCookie holds the state of a login in progress
+const oidcStateCookie = "baufi_oidc"
+
+// oidcState is stored in a short-lived cookie between login and callback
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	ReturnTo string `json:"returnTo"`
+}
+
+// HandleAuthProviders tells the UI which login methods are available
+func HandleAuthProviders(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]bool{
+		"password": true,
+		"oidc":     OIDCProvider != nil,
+	})
+}
+
+// HandleOIDCLogin redirects to the OpenID Connect provider.
+// The optional returnTo query parameter is a local path to return to afterwards.
+func HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if OIDCProvider == nil {
+		respondWithError(w, r, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	state := oidcState{
+		State:    auth.GenerateToken(),
+		Nonce:    auth.GenerateToken(),
+		Verifier: auth.GenerateToken(),
+		ReturnTo: r.URL.Query().Get("returnTo"),
+	}
+	// Only allow local paths to avoid open redirects
+	if !strings.HasPrefix(state.ReturnTo, "/") || strings.HasPrefix(state.ReturnTo, "//") {
+		state.ReturnTo = "/"
+	}
+
+	target, err := OIDCProvider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier, oidcRedirectURL(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error starting OIDC login", "error", err)
+		respondWithError(w, r, http.StatusBadGateway, "Identity provider unavailable")
+		return
+	}
+
+	value, _ := json.Marshal(state)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     "/api/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   proxy.IsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// HandleOIDCCallback completes the login: it exchanges the code, maps the
+// ID token claims to a local user and starts a session
+func HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if OIDCProvider == nil {
+		respondWithError(w, r, http.StatusNotFound, "single sign-on is not configured")
+		return
+	}
+
+	if errCode := r.URL.Query().Get("error"); errCode != "" {
+		respondWithError(w, r, http.StatusUnauthorized, "login failed: "+errCode)
+		return
+	}
+
+	state, ok := readOIDCState(r)
+	if !ok || state.State != r.URL.Query().Get("state") {
+		respondWithError(w, r, http.StatusBadRequest, "invalid login state")
+		return
+	}
+
+	// The state is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/auth/oidc",
+		MaxAge: -1,
+	})
+
+	claims, err := OIDCProvider.Exchange(r.Context(), r.URL.Query().Get("code"), state.Verifier, state.Nonce, oidcRedirectURL(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error completing OIDC login", "error", err)
+		respondWithError(w, r, http.StatusUnauthorized, "login failed")
+		return
+	}
+
+	user, status, message := oidcUser(r.Context(), claims)
+	if user == nil {
+		respondWithError(w, r, status, message)
+		return
+	}
+
+	if err := startSession(w, r, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating session", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	http.Redirect(w, r, state.ReturnTo, http.StatusFound)
+}
+
+// oidcUser maps ID token claims to a local user. An identity seen before
+// logs into its linked account. Otherwise an account with the same verified
+// email is linked, or a new account is created. On failure it returns the
+// HTTP status and message to respond with.
+func oidcUser(ctx context.Context, claims *auth.OIDCClaims) (*models.User, int, string) {
+	user, err := db.GetUserByOIDCSubject(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, 0, ""
+	}
+	if !errors.Is(err, db.ErrUserNotFound) {
+		slog.ErrorContext(ctx, "Error fetching OIDC user", "error", err)
+		return nil, http.StatusInternalServerError, "Failed to log in"
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" {
+		return nil, http.StatusForbidden, "identity provider did not return an email address"
+	}
+
+	if claims.EmailVerified {
+		user, _, err := db.GetUserByEmail(ctx, email)
+		if err == nil {
+			if err := db.LinkOIDCSubject(ctx, user.ID, claims.Issuer, claims.Subject); err != nil {
+				return linkFailure(ctx, err)
+			}
+			return user, 0, ""
+		}
+		if !errors.Is(err, db.ErrUserNotFound) {
+			slog.ErrorContext(ctx, "Error fetching user", "error", err)
+			return nil, http.StatusInternalServerError, "Failed to log in"
+		}
+	}
+
+	if !RegistrationEnabled {
+		hasUsers, err := db.HasUsers(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error counting users", "error", err)
+			return nil, http.StatusInternalServerError, "Failed to log in"
+		}
+		if hasUsers {
+			return nil, http.StatusForbidden, "registration is disabled"
+		}
+	}
+
+	user = &models.User{
+		ID:    generateID(),
+		Email: email,
+		Name:  strings.TrimSpace(claims.Name),
+	}
+	if user.Name == "" {
+		user.Name = user.Email
+	}
+
+	if err := db.CreateOIDCUser(ctx, user, claims.Issuer, claims.Subject); err != nil {
+		switch {
+		case errors.Is(err, db.ErrEmailTaken):
+			// The email belongs to an account but the provider did not verify it
+			return nil, http.StatusConflict, "email already registered"
+		case errors.Is(err, db.ErrIdentityLinked):
+			// A concurrent login with the same identity created the account
+			return nil, http.StatusConflict, "identity is linked to another account"
+		}
+		slog.ErrorContext(ctx, "Error creating OIDC user", "error", err)
+		return nil, http.StatusInternalServerError, "Failed to log in"
+	}
+
+	return user, 0, ""
+}
+
+// linkFailure returns the status and message for an identity that could not
+// be linked. An account with another identity is not taken over.
+func linkFailure(ctx context.Context, err error) (*models.User, int, string) {
+	if errors.Is(err, db.ErrConflict) {
+		return nil, http.StatusConflict, "account is linked to another identity"
+	}
+	slog.ErrorContext(ctx, "Error linking OIDC identity", "error", err)
+	return nil, http.StatusInternalServerError, "Failed to log in"
+}
+
+// readOIDCState decodes the state cookie of a login in progress
+func readOIDCState(r *http.Request) (*oidcState, bool) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, false
+	}
+	var state oidcState
+	if err := json.Unmarshal(value, &state); err != nil || state.State == "" {
+		return nil, false
+	}
+	return &state, true
+}
+
+// oidcRedirectURL returns the callback URL registered at the provider
+func oidcRedirectURL(r *http.Request) string {
+	return OIDCProvider.RedirectURL(requestBaseURL(r) + "/api/auth/oidc/callback")
+}
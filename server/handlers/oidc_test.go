@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+)
+
+func TestOIDCUser(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	anna := createTestUser(t, "anna")
+	const issuer = "https://idp.example.com"
+	if err := db.LinkOIDCSubject(ctx, anna.ID, issuer, "anna"); err != nil {
+		t.Fatal(err)
+	}
+	ben := createTestUser(t, "ben")
+
+	tests := []struct {
+		name   string
+		claims auth.OIDCClaims
+		userID string
+		status int
+	}{
+		{"linked identity", auth.OIDCClaims{Issuer: issuer, Subject: "anna"}, anna.ID, 0},
+		{"verified email links", auth.OIDCClaims{Issuer: issuer, Subject: "ben", Email: "ben@example.com", EmailVerified: true}, ben.ID, 0},
+		{"account linked to another identity", auth.OIDCClaims{Issuer: issuer, Subject: "mallory", Email: "anna@example.com", EmailVerified: true}, "", http.StatusConflict},
+		{"unverified email", auth.OIDCClaims{Issuer: issuer, Subject: "eve", Email: "anna@example.com"}, "", http.StatusConflict},
+		{"new identity creates a linked account", auth.OIDCClaims{Issuer: issuer, Subject: "carl", Email: "carl@example.com"}, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, status, message := oidcUser(ctx, &tt.claims)
+			if status != tt.status {
+				t.Fatalf("status = %d (%s), want %d", status, message, tt.status)
+			}
+			if tt.userID != "" && (user == nil || user.ID != tt.userID) {
+				t.Errorf("user = %+v, want %s", user, tt.userID)
+			}
+			if status == 0 {
+				linked, err := db.GetUserByOIDCSubject(ctx, tt.claims.Issuer, tt.claims.Subject)
+				if err != nil || linked.ID != user.ID {
+					t.Errorf("identity is linked to %v (%v), want %s", linked, err, user.ID)
+				}
+			}
+		})
+	}
+}
@@ -2,8 +2,6 @@ package handlers
 
 import (
 	"encoding/json"
-	"errors"
-	"log"
 	"net/http"
 	"strings"
 
@@ -11,43 +9,37 @@ import (
 	"baufi-optimierer/server/models"
 )
 
-// HandleCreateSpecialPayment creates a new special payment for a loan
+// HandleCreateSpecialPayment creates a new special payment for a loan. Requires the editor role.
 func HandleCreateSpecialPayment(w http.ResponseWriter, r *http.Request) {
 	// Extract loan ID from path: /api/loans/{loanId}/special-payments
 	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
 	if loanID == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid loan ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
 		return
 	}
 	// Remove /special-payments from the loan ID
 	loanID = strings.TrimSuffix(loanID, "/special-payments")
 
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
 	var paymentInput models.SpecialPayment
 	if err := json.NewDecoder(r.Body).Decode(&paymentInput); err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
 	if err := paymentInput.Validate(); err != nil {
-		var validationErr models.ValidationError
-		if errors.As(err, &validationErr) {
-			respondWithError(w, http.StatusBadRequest, err.Error())
-		} else {
-			respondWithError(w, http.StatusInternalServerError, "Validation error")
-		}
+		respondWithValidationError(w, r, err)
 		return
 	}
 
 	paymentInput.ID = generateID()
 	paymentInput.LoanID = loanID
 
-	if err := db.CreateSpecialPayment(&paymentInput); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			respondWithError(w, http.StatusNotFound, err.Error())
-			return
-		}
-		log.Printf("Error creating special payment: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to create special payment")
+	if err := db.CreateSpecialPayment(r.Context(), currentUserID(r), &paymentInput); err != nil {
+		respondWithDBError(w, r, err, "Failed to create special payment")
 		return
 	}
 
@@ -56,7 +48,7 @@ func HandleCreateSpecialPayment(w http.ResponseWriter, r *http.Request) {
 	respondWithJSON(w, http.StatusCreated, paymentInput)
 }
 
-// HandleDeleteSpecialPayment deletes a special payment
+// HandleDeleteSpecialPayment moves a special payment to the trash. Requires the editor role.
 func HandleDeleteSpecialPayment(w http.ResponseWriter, r *http.Request) {
 	// Extract IDs from path: /api/loans/{loanId}/special-payments/{paymentId}
 	pathParts := strings.Split(r.URL.Path, "/")
@@ -72,18 +64,17 @@ func HandleDeleteSpecialPayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if loanID == "" || paymentID == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid loan or payment ID")
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan or payment ID")
 		return
 	}
 
-	err := db.DeleteSpecialPayment(loanID, paymentID)
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	err := db.DeleteSpecialPayment(r.Context(), currentUserID(r), loanID, paymentID)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			respondWithError(w, http.StatusNotFound, err.Error())
-			return
-		}
-		log.Printf("Error deleting special payment: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to delete special payment")
+		respondWithDBError(w, r, err, "Failed to delete special payment")
 		return
 	}
 
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/finance"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/report"
+)
+
+// HandleScheduleCSV returns the amortization schedule of a loan as CSV.
+// The lang query parameter ("de" or "en") selects headers and number formats.
+func HandleScheduleCSV(w http.ResponseWriter, r *http.Request) {
+	loan, result, labels, ok := loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteScheduleCSV(&buf, result, labels); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing CSV schedule for loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to generate schedule")
+		return
+	}
+
+	respondWithFile(w, "text/csv; charset=utf-8", attachmentName(loan, labels.Schedule, "csv"), buf.Bytes())
+}
+
+// HandleScheduleXLSX returns the amortization schedule of a loan as Excel workbook.
+// The lang query parameter ("de" or "en") selects headers and number formats.
+func HandleScheduleXLSX(w http.ResponseWriter, r *http.Request) {
+	loan, result, labels, ok := loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteScheduleXLSX(&buf, result, labels); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing XLSX schedule for loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to generate schedule")
+		return
+	}
+
+	respondWithFile(w, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		attachmentName(loan, labels.Schedule, "xlsx"), buf.Bytes())
+}
+
+// HandleLoanReport returns a printable PDF report of a loan.
+// The lang query parameter ("de" or "en") selects the report language.
+func HandleLoanReport(w http.ResponseWriter, r *http.Request) {
+	loan, _, labels, ok := loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteLoanPDF(&buf, loan, labels, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing PDF report for loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to generate report")
+		return
+	}
+
+	respondWithFile(w, "application/pdf", attachmentName(loan, labels.ReportTitle, "pdf"), buf.Bytes())
+}
+
+// loadSchedule fetches the loan from the path and calculates its schedule.
+// It writes an error response and returns false on failure.
+func loadSchedule(w http.ResponseWriter, r *http.Request) (*models.Loan, *finance.Result, report.Labels, bool) {
+	id := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return nil, nil, report.Labels{}, false
+	}
+
+	labels, ok := report.LabelsFor(r.URL.Query().Get("lang"))
+	if !ok {
+		respondWithError(w, r, http.StatusBadRequest, "lang must be de or en")
+		return nil, nil, report.Labels{}, false
+	}
+
+	loan, err := db.GetLoan(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return nil, nil, report.Labels{}, false
+	}
+
+	result, err := finance.Calculate(loan)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error calculating schedule for loan", "loan_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to calculate schedule")
+		return nil, nil, report.Labels{}, false
+	}
+
+	return loan, result, labels, true
+}
+
+// respondWithFile sends a generated file as download
+func respondWithFile(w http.ResponseWriter, contentType, filename string, content []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// umlautReplacer transliterates German characters for file names
+var umlautReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss")
+
+// attachmentName builds a download file name from a title and the loan name
+func attachmentName(loan *models.Loan, title, ext string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return unicode.ToLower(r)
+		case r == ' ' || r == '-' || r == '_':
+			return '-'
+		}
+		return -1
+	}, umlautReplacer.Replace(loan.Name))
+	if slug == "" {
+		slug = loan.ID
+	}
+	prefix := strings.ToLower(strings.ReplaceAll(title, " ", "-"))
+	return fmt.Sprintf("%s-%s.%s", prefix, slug, ext)
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/finance"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/proxy"
+	"baufi-optimierer/server/report"
+)
+
+// sharedLoanResponse is returned by the public share endpoint
+type sharedLoanResponse struct {
+	Loan      *models.Loan    `json:"loan"`
+	Schedule  *finance.Result `json:"schedule"`
+	ExpiresAt string          `json:"expiresAt"`
+}
+
+// HandleGetShareLinks lists the share links of a loan. Requires the editor role.
+func HandleGetShareLinks(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if loanID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	links, err := db.GetShareLinks(r.Context(), loanID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching share links of loan", "loan_id", loanID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch share links")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, links)
+}
+
+// HandleCreateShareLink creates a read-only share link for a loan. The link
+// expires after expiresInDays (default 30) and can be protected by a
+// password. The secret is only returned in this response. Requires the editor role.
+func HandleCreateShareLink(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	if loanID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	var input models.ShareLinkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && err != io.EOF {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		respondWithValidationError(w, r, err)
+		return
+	}
+
+	var passwordHash string
+	if input.Password != "" {
+		hash, err := auth.HashPassword(input.Password)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error hashing share link password", "error", err)
+			respondWithError(w, r, http.StatusInternalServerError, "Failed to create share link")
+			return
+		}
+		passwordHash = hash
+	}
+
+	link := models.ShareLink{
+		ID:     generateID(),
+		LoanID: loanID,
+		Token:  auth.GenerateToken(),
+	}
+	expiresAt := time.Now().Add(time.Duration(input.ExpiresInDays) * 24 * time.Hour)
+
+	if err := db.CreateShareLink(r.Context(), currentUserID(r), &link, expiresAt, passwordHash); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating share link for loan", "loan_id", loanID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	query := "?token=" + url.QueryEscape(link.Token)
+	link.URL = requestBaseURL(r) + "/api/shared" + query
+	link.ReportURL = requestBaseURL(r) + "/api/shared/report.pdf" + query
+
+	respondWithJSON(w, http.StatusCreated, link)
+}
+
+// HandleRevokeShareLink revokes a share link. Requires the editor role.
+func HandleRevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	linkID := extractIDFromPath(r.URL.Path, "/api/loans/"+loanID+"/shares/")
+	if loanID == "" || linkID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan or share link ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	if err := db.RevokeShareLink(r.Context(), loanID, linkID); err != nil {
+		respondWithDBError(w, r, err, "Failed to revoke share link")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetShareAccesses returns the access log of a share link. Requires the editor role.
+func HandleGetShareAccesses(w http.ResponseWriter, r *http.Request) {
+	loanID := extractIDFromPath(r.URL.Path, "/api/loans/")
+	linkID := extractIDFromPath(r.URL.Path, "/api/loans/"+loanID+"/shares/")
+	if loanID == "" || linkID == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan or share link ID")
+		return
+	}
+
+	if !authorizeLoan(w, r, loanID, models.RoleEditor) {
+		return
+	}
+
+	accesses, err := db.GetShareAccesses(r.Context(), loanID, linkID)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch access log")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, accesses)
+}
+
+// HandleSharedLoan returns the loan and its schedule for a share link.
+// The token replaces the session; a password is sent via HTTP Basic auth.
+// Only GET is routed, so a share link can never change the loan.
+func HandleSharedLoan(w http.ResponseWriter, r *http.Request) {
+	link, ok := checkShareLink(w, r)
+	if !ok {
+		return
+	}
+
+	loan, result, ok := loadSharedLoan(w, r, link)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, sharedLoanResponse{
+		Loan:      loan,
+		Schedule:  result,
+		ExpiresAt: link.ExpiresAt,
+	})
+}
+
+// HandleSharedReport returns the PDF report of a shared loan, so a share
+// link can be opened directly in a browser
+func HandleSharedReport(w http.ResponseWriter, r *http.Request) {
+	labels, ok := report.LabelsFor(r.URL.Query().Get("lang"))
+	if !ok {
+		respondWithError(w, r, http.StatusBadRequest, "lang must be de or en")
+		return
+	}
+
+	link, ok := checkShareLink(w, r)
+	if !ok {
+		return
+	}
+
+	loan, _, ok := loadSharedLoan(w, r, link)
+	if !ok {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteLoanPDF(&buf, loan, labels, time.Now()); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing PDF report for loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to generate report")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachmentName(loan, labels.ReportTitle, "pdf")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleSharedReadOnly rejects every method but GET on the shared views.
+// Without it those requests would fall through to the static file handler.
+func HandleSharedReadOnly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, HEAD")
+	respondWithError(w, r, http.StatusMethodNotAllowed, "share links are read-only")
+}
+
+// checkShareLink validates the token query parameter and the password and
+// records the attempt in the access log of the link. It writes an error
+// response and returns false if access is denied.
+func checkShareLink(w http.ResponseWriter, r *http.Request) (*models.ShareLink, bool) {
+	secret := r.URL.Query().Get("token")
+	if secret == "" {
+		respondWithError(w, r, http.StatusUnauthorized, "share token required")
+		return nil, false
+	}
+
+	link, passwordHash, err := db.FindShareLink(r.Context(), secret)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to check share link")
+		return nil, false
+	}
+
+	outcome := models.ShareAccessGranted
+	expiresAt, _ := time.Parse(time.RFC3339, link.ExpiresAt)
+	switch {
+	case link.RevokedAt != "":
+		outcome = models.ShareAccessRevoked
+	case !time.Now().Before(expiresAt):
+		outcome = models.ShareAccessExpired
+	case passwordHash != "":
+		_, password, ok := r.BasicAuth()
+		if !ok {
+			outcome = models.ShareAccessNoPassword
+		} else if !auth.CheckPassword(passwordHash, password) {
+			outcome = models.ShareAccessWrongPassword
+		}
+	}
+
+	if err := db.LogShareAccess(r.Context(), link.ID, outcome, proxy.ClientIP(r), r.UserAgent()); err != nil {
+		slog.ErrorContext(r.Context(), "Error logging access to share link", "share_link_id", link.ID, "error", err)
+	}
+
+	switch outcome {
+	case models.ShareAccessRevoked:
+		respondWithError(w, r, http.StatusGone, "share link has been revoked")
+		return nil, false
+	case models.ShareAccessExpired:
+		respondWithError(w, r, http.StatusGone, "share link has expired")
+		return nil, false
+	case models.ShareAccessNoPassword, models.ShareAccessWrongPassword:
+		// Lets browsers prompt for the password
+		w.Header().Set("WWW-Authenticate", `Basic realm="Shared loan", charset="UTF-8"`)
+		respondWithError(w, r, http.StatusUnauthorized, "valid password required")
+		return nil, false
+	}
+
+	return link, true
+}
+
+// loadSharedLoan fetches the loan of a share link and calculates its schedule.
+// It writes an error response and returns false on failure.
+func loadSharedLoan(w http.ResponseWriter, r *http.Request, link *models.ShareLink) (*models.Loan, *finance.Result, bool) {
+	loan, err := db.GetSharedLoan(r.Context(), link.LoanID)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to fetch loan")
+		return nil, nil, false
+	}
+
+	result, err := finance.Calculate(loan)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error calculating schedule for loan", "loan_id", loan.ID, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to calculate schedule")
+		return nil, nil, false
+	}
+
+	return loan, result, true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+)
+
+// HandleGetAPITokens lists the API tokens of the user
+func HandleGetAPITokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := db.GetAPITokens(r.Context(), currentUserID(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching API tokens", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch API tokens")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// HandleCreateAPIToken creates a personal API token with the given scopes
+// (default read). The secret is only returned in this response.
+func HandleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var input models.APIToken
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		respondWithValidationError(w, r, err)
+		return
+	}
+
+	token := models.APIToken{
+		ID:     generateID(),
+		Name:   input.Name,
+		Scopes: input.Scopes,
+		Token:  auth.APITokenPrefix + auth.GenerateToken(),
+	}
+
+	if err := db.CreateAPIToken(r.Context(), currentUserID(r), &token); err != nil {
+		slog.ErrorContext(r.Context(), "Error creating API token", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to create API token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, token)
+}
+
+// HandleDeleteAPIToken revokes an API token
+func HandleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/tokens/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid API token ID")
+		return
+	}
+
+	err := db.DeleteAPIToken(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to delete API token")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"baufi-optimierer/server/db"
+)
+
+// TrashRetention is how long deleted loans and special payments stay in the
+// trash before they are purged
+var TrashRetention = 30 * 24 * time.Hour
+
+// HandleGetTrash lists the deleted loans and special payments of the
+// user's households
+func HandleGetTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := db.GetTrash(r.Context(), currentUserID(r))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching trash", "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch trash")
+		return
+	}
+	trash.RetentionDays = int(TrashRetention / (24 * time.Hour))
+
+	respondWithJSON(w, http.StatusOK, trash)
+}
+
+// HandleRestoreLoan takes a loan out of the trash and returns it.
+// Requires the editor role.
+func HandleRestoreLoan(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/trash/loans/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid loan ID")
+		return
+	}
+
+	if err := db.RestoreLoan(r.Context(), currentUserID(r), id); err != nil {
+		respondWithDBError(w, r, err, "Failed to restore loan")
+		return
+	}
+
+	loan, err := db.GetLoan(r.Context(), currentUserID(r), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching restored loan", "loan_id", id, "error", err)
+		respondWithError(w, r, http.StatusInternalServerError, "Failed to fetch loan")
+		return
+	}
+
+	respondWithLoan(w, http.StatusOK, loan)
+}
+
+// HandleRestoreSpecialPayment takes a special payment out of the trash and
+// returns it. Requires the editor role.
+func HandleRestoreSpecialPayment(w http.ResponseWriter, r *http.Request) {
+	id := extractIDFromPath(r.URL.Path, "/api/trash/special-payments/")
+	if id == "" {
+		respondWithError(w, r, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+
+	payment, err := db.RestoreSpecialPayment(r.Context(), currentUserID(r), id)
+	if err != nil {
+		respondWithDBError(w, r, err, "Failed to restore special payment")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, payment)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"baufi-optimierer/server/config"
+)
+
+// runHealthCheck implements the health subcommand: it requests the
+// readiness endpoint of the server running in the same container and
+// returns the exit code for the container runtime, 0 if ready, 1 otherwise.
+// The address is taken from the configuration like the server does; flags of
+// a server started with e.g. -config or -server.address follow after --:
+//
+//	baufi-opt health -- -config /etc/baufi-opt.toml
+func runHealthCheck(args []string) int {
+	flags := flag.NewFlagSet("health", flag.ContinueOnError)
+	url := flags.String("url", "", "endpoint to check (default: /readyz of the configured address)")
+	timeout := flags.Duration("timeout", 3*time.Second, "request timeout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *url == "" {
+		cfg, err := config.Load(flags.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+			return 1
+		}
+		*url = localURL(cfg) + "/readyz"
+	}
+
+	client := &http.Client{
+		Timeout: *timeout,
+		// The certificate is issued for the public name, not for localhost
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(*url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "health check failed: %s %s\n", resp.Status, body)
+		return 1
+	}
+	fmt.Printf("%s", body)
+	return 0
+}
+
+// localURL returns the base URL to reach the server from the same host
+func localURL(cfg *config.Config) string {
+	host, port, _ := net.SplitHostPort(cfg.Server.Address)
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	scheme := "http"
+	if cfg.TLS.CertFile != "" {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"baufi-optimierer/server/config"
+)
+
+func TestLocalURL(t *testing.T) {
+	tests := []struct {
+		address string
+		tls     bool
+		want    string
+	}{
+		{":8080", false, "http://127.0.0.1:8080"},
+		{"0.0.0.0:8080", false, "http://127.0.0.1:8080"},
+		{"[::]:8443", true, "https://127.0.0.1:8443"},
+		{"10.1.2.3:8080", false, "http://10.1.2.3:8080"},
+		{"[2001:db8::1]:8080", false, "http://[2001:db8::1]:8080"},
+		{"localhost:8443", true, "https://localhost:8443"},
+	}
+	for _, tt := range tests {
+		cfg := &config.Config{}
+		cfg.Server.Address = tt.address
+		if tt.tls {
+			cfg.TLS.CertFile = "server.crt"
+		}
+		if got := localURL(cfg); got != tt.want {
+			t.Errorf("localURL(%s, tls %v) = %s, want %s", tt.address, tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	var ready atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readyz" || !ready.Load() {
+			http.Error(w, `{"status":"unavailable"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+	address := srv.Listener.Addr().String()
+
+	// A port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	tests := []struct {
+		name  string
+		args  []string
+		ready bool
+		want  int
+	}{
+		{"ready", []string{"-url", srv.URL + "/readyz"}, true, 0},
+		{"not ready", []string{"-url", srv.URL + "/readyz"}, false, 1},
+		{"unreachable", []string{"-url", "http://" + closed + "/readyz"}, true, 1},
+		{"server flags after --", []string{"--", "-server.address", address}, true, 0},
+		{"server flags without --", []string{"-server.address", address}, true, 2},
+		{"invalid server flags", []string{"--", "-server.address", "8080"}, true, 1},
+		{"unknown flag", []string{"-verbose"}, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready.Store(tt.ready)
+			if got := runHealthCheck(tt.args); got != tt.want {
+				t.Errorf("runHealthCheck(%q) = %d, want %d", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,83 +1,235 @@
 package main
 
 import (
+	"context"
 	"embed"
-	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/certs"
+	"baufi-optimierer/server/config"
+	"baufi-optimierer/server/csp"
 	"baufi-optimierer/server/db"
 	"baufi-optimierer/server/handlers"
+	"baufi-optimierer/server/logging"
+	"baufi-optimierer/server/metrics"
 	"baufi-optimierer/server/middleware"
+	"baufi-optimierer/server/openapi"
+	"baufi-optimierer/server/proxy"
+	"baufi-optimierer/server/ratelimit"
 )
 
 //go:embed static/*
 var staticFS embed.FS
 
 func main() {
-	// Initialize logging
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "health":
+			// The container health check runs the binary as a client of the server
+			os.Exit(runHealthCheck(os.Args[2:]))
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		}
+	}
 
-	// Get configuration from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		exitWithConfigError(err)
 	}
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		// Use absolute path relative to the binary location
-		// This ensures the database file is always in the same location regardless of cwd
-		exePath, err := os.Executable()
-		if err != nil {
-			log.Fatalf("Failed to get executable path: %v", err)
-		}
-		exeDir := filepath.Dir(exePath)
-		dbPath = filepath.Join(exeDir, "data", "loans.db")
+	// Initialize logging
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+
+	// Forwarded headers are only believed from the reverse proxies in front
+	proxy.Trusted, err = proxy.ParsePrefixes(cfg.Server.TrustedProxies)
+	if err != nil {
+		fatal("Invalid trusted proxies", "error", err)
 	}
 
 	// Ensure data directory exists
-	dataDir := filepath.Dir(dbPath)
+	dataDir := filepath.Dir(cfg.Database.Path)
 	if err := os.MkdirAll(dataDir, 0755); err != nil && !os.IsExist(err) {
-		log.Fatalf("Failed to create data directory: %v", err)
+		fatal("Failed to create data directory", "error", err)
 	}
+	handlers.DataDir = dataDir
 
 	// Initialize database
-	if err := db.InitDB(dbPath); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	if err := db.InitDB(cfg.Database.Path, cfg.Database.MaxOpenConns, cfg.Database.MaxIdleConns); err != nil {
+		fatal("Failed to initialize database", "error", err)
+	}
+
+	if err := db.DeleteExpiredSessions(context.Background()); err != nil {
+		slog.Error("Failed to delete expired sessions", "error", err)
+	}
+
+	// New accounts can sign up unless disabled; the first account is always allowed
+	handlers.RegistrationEnabled = cfg.Auth.RegistrationEnabled
+
+	// Single sign-on is enabled by configuring an OpenID Connect issuer
+	if oidc := cfg.Auth.OIDC; oidc.IssuerURL != "" {
+		handlers.OIDCProvider = auth.NewOIDCProvider(auth.OIDCConfig{
+			IssuerURL:    oidc.IssuerURL,
+			ClientID:     oidc.ClientID,
+			ClientSecret: oidc.ClientSecret,
+			RedirectURL:  oidc.RedirectURL,
+			Scopes:       oidc.Scopes,
+		}, nil)
+		slog.Info("Single sign-on enabled", "issuer", oidc.IssuerURL)
 	}
-	defer db.Close()
 
-	log.Println("Starting Baufinanzierungs-Optimierer server...")
+	// Clients must send If-Match when changing loans if required
+	handlers.RequireIfMatch = cfg.Features.RequireIfMatch
+
+	// Quotas bound the loans and special payments a single user can store
+	db.MaxLoansPerUser = cfg.Limits.MaxLoansPerUser
+	db.MaxPaymentsPerLoan = cfg.Limits.MaxPaymentsPerLoan
+
+	// Deleted loans and special payments are purged after the retention period
+	handlers.TrashRetention = time.Duration(cfg.Features.TrashRetentionDays) * 24 * time.Hour
+
+	background, stopBackground := context.WithCancel(context.Background())
+	go purgeTrash(background, handlers.TrashRetention)
+
+	slog.Info("Starting Baufinanzierungs-Optimierer server")
 
 	// Create HTTP mux
-	mux := http.NewServeMux()
+	mux := &routeMux{ServeMux: http.NewServeMux()}
 
 	// Register API routes
 	registerRoutes(mux)
 
+	// Metrics are unauthenticated; a separate listener keeps them off the
+	// public one
+	var metricsServer *http.Server
+	if cfg.Features.Metrics && cfg.Metrics.Address != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:         cfg.Metrics.Address,
+			Handler:      metricsMux,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			IdleTimeout:  cfg.Server.IdleTimeout,
+		}
+		go func() {
+			slog.Info("Metrics listening", "address", cfg.Metrics.Address)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Metrics server error", "error", err)
+			}
+		}()
+	} else if cfg.Features.Metrics {
+		mux.Handle("GET /metrics", metrics.Handler())
+	}
+
+	// Every API route must be documented
+	if err := openapi.CheckRoutes(mux.patterns); err != nil {
+		fatal("Routes do not match the API documentation", "error", err)
+	}
+
 	// Serve static files from embedded FS
-	serveStatic(mux)
+	serveStatic(mux.ServeMux)
+
+	// Clients are rate limited and request bodies are bounded before they
+	// are read; imports may be larger than other bodies
+	var reads, writes *ratelimit.Limiter
+	if cfg.Limits.ReadsPerMinute > 0 {
+		reads = ratelimit.New(cfg.Limits.ReadsPerMinute)
+	}
+	if cfg.Limits.WritesPerMinute > 0 {
+		writes = ratelimit.New(cfg.Limits.WritesPerMinute)
+	}
+	bodyLimit := middleware.BodyLimit(mux.ServeMux, int64(cfg.Limits.MaxBodyBytes), map[string]int64{
+		"POST /api/import": int64(cfg.Limits.MaxImportBytes),
+	})
+	handler := middleware.RateLimit(reads, writes)(bodyLimit(middleware.ValidationMiddleware(mux.ServeMux)))
+
+	handler = middleware.SessionMiddleware(middleware.TokenMiddleware(handler))
+
+	// Machine clients authenticate with a certificate if required
+	if cfg.TLS.ClientAuth == certs.ClientAuthRequire {
+		handler = middleware.RequireClientCertificate(handler)
+	}
+
+	// Browsers may only call the API from this site and the allowed origins
+	crossOrigin, err := middleware.CrossOriginProtection(cfg.Security.CORSOrigins)
+	if err != nil {
+		fatal("Invalid CORS origins", "error", err)
+	}
+	policy := cfg.Security.CSP
+	if policy == "" {
+		policy = appPolicy()
+	}
+	handler = middleware.SecurityHeaders(middleware.SecurityConfig{
+		CSP:            policy,
+		HSTSMaxAge:     cfg.Security.HSTSMaxAge,
+		ReferrerPolicy: cfg.Security.ReferrerPolicy,
+	})(middleware.CORS(cfg.Security.CORSOrigins)(crossOrigin(handler)))
 
 	// Create server with middleware
 	server := &http.Server{
-		Addr:         ":" + port,
-		Handler:      middleware.LoggingMiddleware(middleware.RecoveryMiddleware(mux)),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         cfg.Server.Address,
+		Handler:      middleware.RequestIDMiddleware(middleware.LoggingMiddleware(middleware.MetricsMiddleware(mux.ServeMux)(middleware.RecoveryMiddleware(handler)))),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	// Serve HTTPS with a certificate that is reloaded when its files change
+	var redirectServer *http.Server
+	if cfg.TLS.CertFile != "" {
+		reloader, err := certs.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			fatal("Failed to load TLS certificate", "error", err)
+		}
+		server.TLSConfig, err = tlsConfig(cfg, reloader)
+		if err != nil {
+			fatal("Invalid TLS configuration", "error", err)
+		}
+		handlers.TLSCertificate = reloader
+		go reloader.Watch(background, cfg.TLS.ReloadInterval)
+
+		info := reloader.Info()
+		slog.Info("Loaded TLS certificate", "subject", info.Subject, "not_after", info.NotAfter, "client_auth", cfg.TLS.ClientAuth)
+
+		if cfg.TLS.RedirectAddress != "" {
+			redirectServer = &http.Server{
+				Addr:         cfg.TLS.RedirectAddress,
+				Handler:      redirectToHTTPS(cfg.Server.Address),
+				ReadTimeout:  cfg.Server.ReadTimeout,
+				WriteTimeout: cfg.Server.WriteTimeout,
+				IdleTimeout:  cfg.Server.IdleTimeout,
+			}
+			go func() {
+				slog.Info("Redirecting HTTP to HTTPS", "address", cfg.TLS.RedirectAddress)
+				if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fatal("Redirect server error", "error", err)
+				}
+			}()
+		}
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server listening on http://0.0.0.0:%s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server error: %v", err)
+		var err error
+		if server.TLSConfig != nil {
+			slog.Info("Server listening", "address", cfg.Server.Address, "tls", true)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("Server listening", "address", cfg.Server.Address, "tls", false)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Server error", "error", err)
 		}
 	}()
 
@@ -86,66 +238,188 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
-	log.Println("Shutting down server...")
-	if err := server.Close(); err != nil {
-		log.Printf("Error closing server: %v", err)
+	// Readiness fails at once; the delay keeps the server serving while load
+	// balancers notice. Then it stops accepting connections and waits up to
+	// the drain timeout for requests in flight.
+	slog.Info("Shutting down server", "delay", cfg.Server.ShutdownDelay, "timeout", cfg.Server.ShutdownTimeout)
+	handlers.BeginShutdown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Requests did not finish in time, closing connections", "error", err)
+		server.Close()
 	}
-	log.Println("Server stopped")
-}
+	if redirectServer != nil {
+		redirectServer.Close()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	stopBackground()
 
-// registerRoutes registers all API routes
-func registerRoutes(mux *http.ServeMux) {
-	// Loans endpoints
-	mux.HandleFunc("GET /api/loans", handlers.HandleGetAllLoans)
-	mux.HandleFunc("POST /api/loans", handlers.HandleCreateLoan)
-	mux.HandleFunc("GET /api/loans/{id}", handlers.HandleGetLoan)
-	mux.HandleFunc("PUT /api/loans/{id}", handlers.HandleUpdateLoan)
-	mux.HandleFunc("DELETE /api/loans/{id}", handlers.HandleDeleteLoan)
+	// Close the database after the last request, with a final checkpoint
+	if err := db.Close(); err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+	slog.Info("Server stopped")
+}
 
-	// Special payments endpoints
-	mux.HandleFunc("POST /api/loans/{id}/special-payments", handlers.HandleCreateSpecialPayment)
-	mux.HandleFunc("DELETE /api/loans/{id}/special-payments/{paymentId}", handlers.HandleDeleteSpecialPayment)
+// fatal logs an error and exits
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
 
-// serveStatic serves the embedded static files
-func serveStatic(mux *http.ServeMux) {
-	// Get the static directory from the embedded FS
-	staticDir, err := fs.Sub(staticFS, "static")
-	if err != nil {
-		log.Printf("Warning: Could not load static files: %v", err)
-		// If no static files exist, just continue without serving them
-		return
-	}
+// purgeTrash permanently deletes loans and special payments that have been
+// in the trash longer than the retention period. It runs at startup and then
+// hourly until the context is cancelled.
+func purgeTrash(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
 
-	// Serve static files with fallback to index.html for React routing
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Don't serve /api/* through static file handler
-		if len(r.URL.Path) >= 4 && r.URL.Path[:4] == "/api" {
+	for {
+		loans, payments, err := db.PurgeTrash(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("Failed to purge trash", "error", err)
+		} else if loans > 0 || payments > 0 {
+			slog.Info("Purged trash", "loans", loans, "special_payments", payments)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
 			return
 		}
+	}
+}
 
-		// Try to serve the requested file
-		fs := http.FileServer(http.FS(staticDir))
+// routeMux records the patterns registered on a ServeMux, so they can be
+// checked against the OpenAPI document
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
 
-		// For React SPA, if file doesn't exist, serve index.html
-		path := r.URL.Path
-		if path == "/" {
-			path = "index.html"
-		} else if path != "" && path[0] == '/' {
-			// Remove leading slash for fs.FS.Open()
-			path = path[1:]
-		}
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
 
-		// Try to open the file
-		file, err := staticDir.Open(path)
-		if err == nil {
-			file.Close()
-			fs.ServeHTTP(w, r)
-			return
-		}
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+// registerRoutes registers all API routes
+func registerRoutes(mux *routeMux) {
+	protected := middleware.RequireAuth
+	sessionOnly := middleware.RequireSession
+
+	// Health checks for the container runtime and Kubernetes probes
+	mux.HandleFunc("GET /healthz", handlers.HandleHealthz)
+	mux.HandleFunc("GET /readyz", handlers.HandleReadyz)
+
+	// API documentation
+	mux.HandleFunc("GET /api/openapi.json", openapi.HandleSpec)
+	mux.HandleFunc("GET /api/docs", openapi.HandleDocs)
+
+	// Account endpoints
+	mux.HandleFunc("POST /api/auth/register", handlers.HandleRegister)
+	mux.HandleFunc("POST /api/auth/login", handlers.HandleLogin)
+	mux.HandleFunc("POST /api/auth/logout", handlers.HandleLogout)
+	mux.Handle("GET /api/auth/me", protected(handlers.HandleGetCurrentUser))
+	mux.HandleFunc("GET /api/auth/providers", handlers.HandleAuthProviders)
+	mux.HandleFunc("GET /api/auth/oidc/login", handlers.HandleOIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/callback", handlers.HandleOIDCCallback)
+
+	// Loans endpoints
+	mux.Handle("GET /api/loans", protected(handlers.HandleGetAllLoans))
+	mux.Handle("POST /api/loans", protected(handlers.HandleCreateLoan))
+	mux.Handle("GET /api/loans/{id}", protected(handlers.HandleGetLoan))
+	mux.Handle("PUT /api/loans/{id}", protected(handlers.HandleUpdateLoan))
+	mux.Handle("PATCH /api/loans/{id}", protected(handlers.HandlePatchLoan))
+	mux.Handle("DELETE /api/loans/{id}", protected(handlers.HandleDeleteLoan))
+
+	// Schedule and report download endpoints
+	mux.Handle("GET /api/loans/{id}/schedule.csv", protected(handlers.HandleScheduleCSV))
+	mux.Handle("GET /api/loans/{id}/schedule.xlsx", protected(handlers.HandleScheduleXLSX))
+	mux.Handle("GET /api/loans/{id}/report.pdf", protected(handlers.HandleLoanReport))
+
+	// Calendar feed endpoints. The feeds authenticate with their token.
+	mux.HandleFunc("GET /api/calendar.ics", handlers.HandleCalendar)
+	mux.HandleFunc("GET /api/loans/{id}/calendar.ics", handlers.HandleLoanCalendar)
+	mux.Handle("GET /api/calendar-tokens", protected(handlers.HandleGetCalendarTokens))
+	mux.Handle("POST /api/calendar-tokens", protected(handlers.HandleCreateCalendarToken))
+	mux.Handle("DELETE /api/calendar-tokens/{id}", protected(handlers.HandleDeleteCalendarToken))
+
+	// Share link endpoints. The shared views authenticate with their token
+	// and are read-only, no other methods are routed to them.
+	mux.Handle("GET /api/loans/{id}/shares", protected(handlers.HandleGetShareLinks))
+	mux.Handle("POST /api/loans/{id}/shares", protected(handlers.HandleCreateShareLink))
+	mux.Handle("DELETE /api/loans/{id}/shares/{shareId}", protected(handlers.HandleRevokeShareLink))
+	mux.Handle("GET /api/loans/{id}/shares/{shareId}/accesses", protected(handlers.HandleGetShareAccesses))
+	mux.HandleFunc("GET /api/shared", handlers.HandleSharedLoan)
+	mux.HandleFunc("GET /api/shared/report.pdf", handlers.HandleSharedReport)
+	mux.HandleFunc("/api/shared", handlers.HandleSharedReadOnly)
+	mux.HandleFunc("/api/shared/", handlers.HandleSharedReadOnly)
 
-		// File not found, try index.html for client-side routing
-		r.URL.Path = "/"
-		fs.ServeHTTP(w, r)
-	}))
+	// Trash endpoints
+	mux.Handle("GET /api/trash", protected(handlers.HandleGetTrash))
+	mux.Handle("POST /api/trash/loans/{id}/restore", protected(handlers.HandleRestoreLoan))
+	mux.Handle("POST /api/trash/special-payments/{id}/restore", protected(handlers.HandleRestoreSpecialPayment))
+
+	// Audit trail endpoints
+	mux.Handle("GET /api/loans/{id}/history", protected(handlers.HandleGetLoanHistory))
+	mux.Handle("POST /api/loans/{id}/history/{entryId}/restore", protected(handlers.HandleRestoreLoanVersion))
+
+	// Special payments endpoints
+	mux.Handle("POST /api/loans/{id}/special-payments", protected(handlers.HandleCreateSpecialPayment))
+	mux.Handle("DELETE /api/loans/{id}/special-payments/{paymentId}", protected(handlers.HandleDeleteSpecialPayment))
+
+	// Household endpoints
+	mux.Handle("GET /api/households", protected(handlers.HandleGetHouseholds))
+	mux.Handle("POST /api/households", protected(handlers.HandleCreateHousehold))
+	mux.Handle("GET /api/households/{id}", protected(handlers.HandleGetHousehold))
+	mux.Handle("PUT /api/households/{id}", protected(handlers.HandleUpdateHousehold))
+	mux.Handle("DELETE /api/households/{id}", protected(handlers.HandleDeleteHousehold))
+	mux.Handle("GET /api/households/{id}/members", protected(handlers.HandleGetHouseholdMembers))
+	mux.Handle("PUT /api/households/{id}/members/{userId}", protected(handlers.HandleUpdateHouseholdMember))
+	mux.Handle("DELETE /api/households/{id}/members/{userId}", protected(handlers.HandleRemoveHouseholdMember))
+	mux.Handle("GET /api/households/{id}/invites", protected(handlers.HandleGetHouseholdInvites))
+	mux.Handle("POST /api/households/{id}/invites", protected(handlers.HandleCreateHouseholdInvite))
+	mux.Handle("DELETE /api/households/{id}/invites/{inviteId}", protected(handlers.HandleDeleteHouseholdInvite))
+	mux.Handle("POST /api/invites/accept", protected(handlers.HandleAcceptInvite))
+
+	// Personal API token endpoints. Tokens cannot manage tokens.
+	mux.Handle("GET /api/tokens", sessionOnly(handlers.HandleGetAPITokens))
+	mux.Handle("POST /api/tokens", sessionOnly(handlers.HandleCreateAPIToken))
+	mux.Handle("DELETE /api/tokens/{id}", sessionOnly(handlers.HandleDeleteAPIToken))
+
+	// Export / import endpoints
+	mux.Handle("GET /api/export", protected(handlers.HandleExport))
+	mux.Handle("POST /api/import", protected(handlers.HandleImport))
+}
+
+// appPolicy returns the Content-Security-Policy of the UI. Scripts may only
+// come from the server and the sites index.html loads them from, and inline
+// scripts only with their hash. Inline styles are allowed, because the
+// Tailwind CDN script injects them at runtime.
+func appPolicy() string {
+	index, err := staticFS.ReadFile("static/index.html")
+	if err != nil {
+		slog.Warn("Could not read index.html for the content security policy", "error", err)
+	}
+	return csp.Policy(
+		"default-src 'self'",
+		"script-src 'self' "+strings.Join(csp.Sources(index, "script"), " "),
+		"style-src 'self' 'unsafe-inline'",
+		"img-src 'self' data:",
+		"font-src 'self' data:",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	)
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"baufi-optimierer/server/openapi"
+)
+
+// Every registered API route, with or without method, must be documented
+// and every documented operation routed
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	mux := &routeMux{ServeMux: http.NewServeMux()}
+	registerRoutes(mux)
+	if err := openapi.CheckRoutes(mux.patterns); err != nil {
+		t.Fatal(err)
+	}
+
+	methodless := 0
+	for _, pattern := range mux.patterns {
+		if pattern[0] == '/' {
+			methodless++
+		}
+	}
+	if methodless == 0 {
+		t.Error("no route without method was checked")
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1, 10}, "route")
+	for _, value := range []float64{0.05, 0.1, 0.5, 2, 20} {
+		h.Observe(value, "/a")
+	}
+
+	var out bytes.Buffer
+	h.write(&out)
+	want := `# HELP test_duration_seconds Test durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.1"} 2
+test_duration_seconds_bucket{route="/a",le="1"} 3
+test_duration_seconds_bucket{route="/a",le="10"} 4
+test_duration_seconds_bucket{route="/a",le="+Inf"} 5
+test_duration_seconds_sum{route="/a"} 22.65
+test_duration_seconds_count{route="/a"} 5
+`
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestCounterLabels(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.\nWith a \\ in the help.", "path", "status")
+	c.Inc(`/a"b`, "200")
+	c.Inc("/line\nbreak", "500")
+	c.Inc(`/back\slash`, "200")
+	c.Inc(`/a"b`, "200")
+
+	var out bytes.Buffer
+	c.write(&out)
+	want := `# HELP test_requests_total Requests.\nWith a \\ in the help.
+# TYPE test_requests_total counter
+test_requests_total{path="/a\"b",status="200"} 2
+test_requests_total{path="/back\\slash",status="200"} 1
+test_requests_total{path="/line\nbreak",status="500"} 1
+`
+	if out.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// A gauge that cannot be read is left out without breaking the scrape
+func TestHandlerSkipsFailingGauge(t *testing.T) {
+	NewGaugeFunc("test_before", "Registered before.", func() (float64, error) { return 1, nil })
+	NewGaugeFunc("test_failing", "Cannot be read.", func() (float64, error) { return 0, errors.New("database locked") })
+	NewGaugeFunc("test_after", "Registered after.", func() (float64, error) { return math.Inf(1), nil })
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	for _, line := range []string{"test_before 1\n", "# TYPE test_after gauge\n", "test_after +Inf\n", "go_goroutines "} {
+		if !strings.Contains(body, line) {
+			t.Errorf("output does not contain %q", line)
+		}
+	}
+	if strings.Contains(body, "test_failing") {
+		t.Errorf("failing gauge is in the output:\n%s", body)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.0005, "0.0005"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+var startTime = time.Now()
+
+var threadProfile = pprof.Lookup("threadcreate")
+
+// writeRuntime writes the Go runtime and process statistics
+func writeRuntime(w io.Writer) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	writeHeader(w, "go_info", "Information about the Go environment.", "gauge")
+	fmt.Fprintf(w, "go_info%s 1\n", labelString([]string{"version"}, []string{runtime.Version()}, "", ""))
+
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())},
+		{"go_threads", "Number of OS threads created.", float64(threadProfile.Count())},
+		{"go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(stats.Alloc)},
+		{"go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(stats.Sys)},
+		{"go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.", float64(stats.HeapAlloc)},
+		{"go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(stats.HeapInuse)},
+		{"go_memstats_heap_objects", "Number of allocated objects.", float64(stats.HeapObjects)},
+		{"process_start_time_seconds", "Start time of the process since unix epoch in seconds.", float64(startTime.UnixNano()) / 1e9},
+	}
+	for _, g := range gauges {
+		writeHeader(w, g.name, g.help, "gauge")
+		fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.value))
+	}
+
+	writeHeader(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+	fmt.Fprintf(w, "go_gc_cycles_total %d\n", stats.NumGC)
+	writeHeader(w, "go_gc_pause_seconds_total", "Total time the program was paused by the GC.", "counter")
+	fmt.Fprintf(w, "go_gc_pause_seconds_total %s\n", formatValue(float64(stats.PauseTotalNs)/1e9))
+}
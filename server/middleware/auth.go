@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/db"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/problem"
+)
+
+// SessionMiddleware attaches the user of a valid session cookie to the request
+// context. Requests without a valid session pass through anonymously.
+func SessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(auth.SessionCookie)
+		if err != nil || cookie.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := db.GetSessionUser(r.Context(), auth.HashToken(cookie.Value))
+		if err != nil {
+			if !errors.Is(err, db.ErrSessionNotFound) {
+				slog.ErrorContext(r.Context(), "Error loading session", "error", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
+}
+
+// TokenMiddleware authenticates requests with a personal API token sent as
+// "Authorization: Bearer <token>". The token's scopes are checked against
+// the method: read allows GET and HEAD, write all other methods. An invalid
+// token is rejected instead of falling back to the session.
+func TokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, secret, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(secret, auth.APITokenPrefix) {
+			// Other schemes, such as Basic auth for share links, are handled elsewhere
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, scopes, err := db.UseAPIToken(r.Context(), strings.TrimSpace(secret))
+		if err != nil {
+			if !errors.Is(err, db.ErrAPITokenNotFound) {
+				slog.ErrorContext(r.Context(), "Error loading API token", "error", err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, r, http.StatusUnauthorized, "invalid API token")
+			return
+		}
+
+		required := models.ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			required = models.ScopeRead
+		}
+		if !models.HasScope(scopes, required) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+required+`"`)
+			writeError(w, r, http.StatusForbidden, "API token lacks the "+required+" scope")
+			return
+		}
+
+		ctx := auth.WithScopes(auth.WithUser(r.Context(), user), scopes)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireAuth rejects requests without an authenticated user with 401
+func RequireAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.UserFromContext(r.Context()) == nil {
+			writeError(w, r, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession rejects requests that are not authenticated with a session
+// cookie, so API tokens cannot be used to manage credentials
+func RequireSession(next http.HandlerFunc) http.Handler {
+	return RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.ScopesFromContext(r.Context()); ok {
+			writeError(w, r, http.StatusForbidden, "this endpoint cannot be used with an API token")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// writeError sends an RFC 7807 problem response
+func writeError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	problem.Error(w, r, code, message)
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// BodyLimit limits the size of request bodies to the limit of the route of
+// the mux that matches the request, or to the default limit. Bodies that
+// announce a larger size are rejected with 413 at once; longer bodies fail
+// while they are read.
+func BodyLimit(mux *http.ServeMux, limit int64, routes map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := mux.Handler(r)
+			maxBytes := limit
+			if routeLimit, ok := routes[pattern]; ok {
+				maxBytes = routeLimit
+			}
+
+			if r.ContentLength > maxBytes {
+				writeError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
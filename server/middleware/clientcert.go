@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// RequireClientCertificate rejects requests over connections without a
+// verified client certificate. The TLS handshake only verifies certificates
+// that are sent, so health checks without one still reach the probe paths.
+func RequireClientCertificate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !probePaths[r.URL.Path] && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			writeError(w, r, http.StatusUnauthorized, "Client certificate required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
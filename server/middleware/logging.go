@@ -1,12 +1,12 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 )
 
-// LoggingMiddleware logs HTTP requests with timestamp and response time
+// LoggingMiddleware logs HTTP requests with status and response time
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -19,11 +19,26 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the request
 		duration := time.Since(start)
-		log.Printf("[%s] %s %s - Status: %d - Duration: %v",
-			r.Method, r.URL.Path, r.RemoteAddr, wrapped.statusCode, duration)
+		level := slog.LevelInfo
+		if probePaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		attrs := []interface{}{
+			"method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr,
+			"status", wrapped.statusCode, "duration", duration,
+		}
+		// Machine clients are identified by their certificate
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			attrs = append(attrs, "client_cert", r.TLS.VerifiedChains[0][0].Subject.String())
+		}
+		slog.Log(r.Context(), level, "Request", attrs...)
 	})
 }
 
+// probePaths are requested every few seconds by health checks and only
+// logged at debug level
+var probePaths = map[string]bool{"/healthz": true, "/readyz": true}
+
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
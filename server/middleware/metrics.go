@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("baufi_http_requests_total",
+		"Number of HTTP requests by method, route pattern and status.",
+		"method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("baufi_http_request_duration_seconds",
+		"Duration of HTTP requests by method, route pattern and status.",
+		metrics.DefaultBuckets, "method", "route", "status")
+)
+
+// knownMethods keeps arbitrary methods sent by clients out of the labels
+var knownMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// MetricsMiddleware counts requests and records their duration per route.
+// Routes are labelled with the pattern of the mux that matches the request,
+// e.g. "/api/loans/{id}", so the number of series does not grow with IDs.
+// Requests no route matches are labelled "unmatched".
+func MetricsMiddleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(wrapped, r)
+
+			_, pattern := mux.Handler(r)
+			route := "unmatched"
+			if pattern != "" {
+				// Drop the method, it has a label of its own
+				if _, path, ok := strings.Cut(pattern, " "); ok {
+					pattern = path
+				}
+				route = pattern
+			}
+			method := r.Method
+			if !knownMethods[method] {
+				method = "OTHER"
+			}
+			status := strconv.Itoa(wrapped.statusCode)
+
+			httpRequests.Inc(method, route, status)
+			httpDuration.Observe(time.Since(start).Seconds(), method, route, status)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/metrics"
+	"baufi-optimierer/server/proxy"
+	"baufi-optimierer/server/ratelimit"
+)
+
+var rateLimited = metrics.NewCounterVec("baufi_rate_limited_requests_total",
+	"Number of requests rejected by the rate limit by budget (read or write).",
+	"budget")
+
+// RateLimit limits the /api requests of each client with separate budgets
+// for reads (GET and HEAD) and writes (all other methods). Clients are
+// identified by their API token, or else by their IP address as seen by
+// the trusted proxies. A nil limiter
+// leaves its budget unlimited. Rejected requests get 429 with Retry-After.
+func RateLimit(reads, writes *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limiter, budget := writes, "write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				limiter, budget = reads, "read"
+			}
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ok, wait := limiter.Allow(clientKey(r)); !ok {
+				rateLimited.Inc(budget)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, r, http.StatusTooManyRequests, "Too many requests, retry later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client of a request for the rate limit. It runs
+// after TokenMiddleware, so only valid API tokens get a budget of their own.
+func clientKey(r *http.Request) string {
+	if _, ok := auth.ScopesFromContext(r.Context()); ok {
+		_, secret, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		return "token:" + auth.HashToken(strings.TrimSpace(secret))
+	}
+	return "ip:" + proxy.ClientIP(r)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"baufi-optimierer/server/ratelimit"
+)
+
+func TestRateLimit(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(ratelimit.New(2), ratelimit.New(1))(ok)
+
+	send := func(method, path, remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	const client = "203.0.113.5:1234"
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		remote     string
+		status     int
+		retryAfter string
+	}{
+		{"first write", "POST", "/api/loans", client, http.StatusOK, ""},
+		{"write budget spent", "DELETE", "/api/loans/1", client, http.StatusTooManyRequests, "60"},
+		{"reads have their own budget", "GET", "/api/loans", client, http.StatusOK, ""},
+		{"second read", "HEAD", "/api/loans", client, http.StatusOK, ""},
+		{"read budget spent", "GET", "/api/loans", client, http.StatusTooManyRequests, "30"},
+		{"other client", "POST", "/api/loans", "203.0.113.6:1234", http.StatusOK, ""},
+		{"outside /api", "GET", "/index.html", client, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		w := send(tt.method, tt.path, tt.remote)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%s: Retry-After = %q, want %q", tt.name, got, tt.retryAfter)
+		}
+	}
+}
+
+func TestRateLimitIgnoresUntrustedForwardedFor(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(nil, ratelimit.New(1))(ok)
+
+	for i, forwarded := range []string{"198.51.100.1", "198.51.100.2"} {
+		r := httptest.NewRequest("POST", "/api/loans", nil)
+		r.RemoteAddr = "203.0.113.5:1234"
+		r.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if want := []int{http.StatusOK, http.StatusTooManyRequests}[i]; w.Code != want {
+			t.Errorf("request %d with X-Forwarded-For %s: status = %d, want %d", i+1, forwarded, w.Code, want)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package middleware
 
 import (
-	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+
+	"baufi-optimierer/server/problem"
 )
 
 // RecoveryMiddleware recovers from panics and returns a 500 error
@@ -11,12 +13,8 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("PANIC: %v", err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]string{
-					"error": "Internal server error",
-				})
+				slog.ErrorContext(r.Context(), "Panic while handling request", "panic", err, "stack", string(debug.Stack()))
+				problem.Error(w, r, http.StatusInternalServerError, "Internal server error")
 			}
 		}()
 		next.ServeHTTP(w, r)
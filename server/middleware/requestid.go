@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"baufi-optimierer/server/logging"
+)
+
+// RequestIDHeader carries the ID of a request from the client or proxy and
+// back in the response
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware gives every request an ID for its log lines. An ID
+// sent by the client or a proxy is kept if it is reasonable, otherwise a new
+// one is generated. The ID is returned in the response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts up to 128 printable ASCII characters without
+// spaces, so IDs cannot forge log lines or bloat them
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
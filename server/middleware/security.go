@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/proxy"
+)
+
+// SecurityConfig configures SecurityHeaders
+type SecurityConfig struct {
+	CSP            string        // Default Content-Security-Policy; handlers may set their own
+	HSTSMaxAge     time.Duration // Strict-Transport-Security over HTTPS, disabled if 0
+	ReferrerPolicy string
+}
+
+// SecurityHeaders sets headers that restrict what browsers do with the
+// responses: the content security policy, no framing, no MIME sniffing, the
+// referrer policy and, over HTTPS, HSTS
+func SecurityHeaders(cfg SecurityConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds())) + "; includeSubDomains"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			if cfg.CSP != "" {
+				h.Set("Content-Security-Policy", cfg.CSP)
+			}
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+			if hsts != "" && proxy.IsHTTPS(r) {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORS headers of allowed cross-origin requests
+const (
+	corsMethods = "GET, POST, PUT, PATCH, DELETE"
+	corsHeaders = "Authorization, Content-Type, If-Match, If-None-Match, X-Request-ID"
+	corsExposed = "ETag, Location, Retry-After, X-Request-ID"
+	corsMaxAge  = 10 * time.Minute // How long browsers may cache a preflight response
+)
+
+// CORS lets browser pages on the allowed origins call /api, with cookies
+// or API tokens. Preflight requests are answered here; those from other
+// origins are rejected. Requests outside /api get no CORS headers.
+func CORS(origins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[origin] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed[origin] {
+				if preflight {
+					writeError(w, r, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				// Same-origin requests also send Origin and need no headers
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+			if preflight {
+				h.Set("Access-Control-Allow-Methods", corsMethods)
+				h.Set("Access-Control-Allow-Headers", corsHeaders)
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			h.Set("Access-Control-Expose-Headers", corsExposed)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CrossOriginProtection rejects state-changing requests that browsers send
+// from other sites, so a page elsewhere cannot act with the session cookie
+// of a logged-in user. The session cookie is SameSite=Lax as well, but that
+// does not cover sibling subdomains. Requests from the trusted origins, the
+// CORS allowlist, and non-browser clients, which send neither Origin nor
+// Sec-Fetch-Site, are allowed.
+func CrossOriginProtection(trusted []string) (func(http.Handler) http.Handler, error) {
+	protection := http.NewCrossOriginProtection()
+	for _, origin := range trusted {
+		if err := protection.AddTrustedOrigin(origin); err != nil {
+			return nil, err
+		}
+	}
+	protection.SetDenyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusForbidden, "cross-origin request rejected")
+	}))
+	return protection.Handler, nil
+}
@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"baufi-optimierer/server/proxy"
+)
+
+// okHandler answers 200 and records that the request got through
+func okHandler(called *bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	trusted, err := proxy.ParsePrefixes([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy.Trusted = trusted
+	defer func() { proxy.Trusted = nil }()
+
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		tls    bool
+		remote string
+		proto  string
+		hsts   string
+	}{
+		{name: "plain HTTP", maxAge: time.Hour, remote: "203.0.113.5:1234"},
+		{name: "HTTPS", maxAge: time.Hour, tls: true, remote: "203.0.113.5:1234", hsts: "max-age=3600; includeSubDomains"},
+		{name: "HTTPS with HSTS disabled", tls: true, remote: "203.0.113.5:1234"},
+		{name: "TLS terminated by a trusted proxy", maxAge: time.Hour, remote: "10.0.0.2:1234", proto: "https", hsts: "max-age=3600; includeSubDomains"},
+		{name: "X-Forwarded-Proto from a client", maxAge: time.Hour, remote: "203.0.113.5:1234", proto: "https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := SecurityHeaders(SecurityConfig{CSP: "default-src 'self'", HSTSMaxAge: tt.maxAge, ReferrerPolicy: "same-origin"})(okHandler(&called))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			want := map[string]string{
+				"Content-Security-Policy":   "default-src 'self'",
+				"X-Frame-Options":           "DENY",
+				"X-Content-Type-Options":    "nosniff",
+				"Referrer-Policy":           "same-origin",
+				"Strict-Transport-Security": tt.hsts,
+			}
+			for name, value := range want {
+				if got := w.Header().Get(name); got != value {
+					t.Errorf("%s = %q, want %q", name, got, value)
+				}
+			}
+			if !called {
+				t.Error("request did not reach the handler")
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	const allowed = "https://dashboard.example.com"
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		origin    string
+		preflight bool
+		status    int
+		passed    bool   // Whether the request reaches the handler
+		allow     string // Expected Access-Control-Allow-Origin
+	}{
+		{name: "preflight from an allowed origin", method: "OPTIONS", path: "/api/loans/1", origin: allowed, preflight: true,
+			status: http.StatusNoContent, allow: allowed},
+		{name: "preflight from another origin", method: "OPTIONS", path: "/api/loans/1", origin: "https://evil.example.com", preflight: true,
+			status: http.StatusForbidden},
+		{name: "request from an allowed origin", method: "PUT", path: "/api/loans/1", origin: allowed,
+			status: http.StatusOK, passed: true, allow: allowed},
+		{name: "request from another origin", method: "GET", path: "/api/loans", origin: "https://evil.example.com",
+			status: http.StatusOK, passed: true},
+		{name: "request without origin", method: "GET", path: "/api/loans",
+			status: http.StatusOK, passed: true},
+		{name: "allowed origin outside the API", method: "GET", path: "/index.html", origin: allowed,
+			status: http.StatusOK, passed: true},
+		{name: "OPTIONS without preflight", method: "OPTIONS", path: "/api/loans", origin: allowed,
+			status: http.StatusOK, passed: true, allow: allowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			handler := CORS([]string{allowed})(okHandler(&called))
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", "PUT")
+				r.Header.Set("Access-Control-Request-Headers", "content-type, if-match")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status || called != tt.passed {
+				t.Fatalf("status = %d, handler called %v, want %d and %v", w.Code, called, tt.status, tt.passed)
+			}
+			h := w.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+			if tt.origin != "" && strings.HasPrefix(tt.path, "/api/") && h.Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", h.Get("Vary"))
+			}
+			if tt.allow == "" {
+				return
+			}
+			if h.Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("credentials not allowed")
+			}
+			if tt.preflight {
+				for _, header := range []string{"If-Match", "If-None-Match", "Content-Type", "Authorization"} {
+					if !strings.Contains(h.Get("Access-Control-Allow-Headers"), header) {
+						t.Errorf("Access-Control-Allow-Headers = %q, want %s", h.Get("Access-Control-Allow-Headers"), header)
+					}
+				}
+				if !strings.Contains(h.Get("Access-Control-Allow-Methods"), "PATCH") || h.Get("Access-Control-Max-Age") != "600" {
+					t.Errorf("Access-Control-Allow-Methods = %q, Max-Age = %q", h.Get("Access-Control-Allow-Methods"), h.Get("Access-Control-Max-Age"))
+				}
+			} else if !strings.Contains(h.Get("Access-Control-Expose-Headers"), "ETag") {
+				t.Errorf("Access-Control-Expose-Headers = %q, want ETag", h.Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
+
+func TestCrossOriginProtection(t *testing.T) {
+	const trusted = "https://dashboard.example.com"
+	protect, err := CrossOriginProtection([]string{trusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CrossOriginProtection([]string{"dashboard.example.com"}); err == nil {
+		t.Error("origin without scheme accepted")
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		site    string // Sec-Fetch-Site
+		origin  string
+		allowed bool
+	}{
+		{name: "same origin", method: "POST", site: "same-origin", origin: "https://app.example.com", allowed: true},
+		{name: "cross-site", method: "POST", site: "cross-site", origin: "https://evil.example.com"},
+		{name: "sibling subdomain", method: "DELETE", site: "same-site", origin: "https://evil.example.com"},
+		{name: "trusted origin", method: "PUT", site: "cross-site", origin: trusted, allowed: true},
+		{name: "cross-site GET", method: "GET", site: "cross-site", origin: "https://evil.example.com", allowed: true},
+		{name: "non-browser client", method: "POST", allowed: true},
+		{name: "Origin of the host without Sec-Fetch-Site", method: "POST", origin: "https://app.example.com", allowed: true},
+		{name: "other Origin without Sec-Fetch-Site", method: "POST", origin: "https://evil.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			r := httptest.NewRequest(tt.method, "https://app.example.com/api/loans", nil)
+			if tt.site != "" {
+				r.Header.Set("Sec-Fetch-Site", tt.site)
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			protect(okHandler(&called)).ServeHTTP(w, r)
+
+			if called != tt.allowed {
+				t.Fatalf("handler called = %v, want %v (status %d)", called, tt.allowed, w.Code)
+			}
+			if !tt.allowed && w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", w.Code)
+			}
+		})
+	}
+}
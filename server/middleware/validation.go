@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/openapi"
+	"baufi-optimierer/server/problem"
+)
+
+// ValidationMiddleware checks request bodies against the OpenAPI document
+// before they reach the route of the mux that matches the request. Invalid
+// bodies are rejected with all violations at once, so the documented
+// schemas are what the server enforces.
+func ValidationMiddleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+
+		// Anonymous requests to protected routes are rejected by the route
+		if auth.UserFromContext(r.Context()) == nil && !openapi.IsPublic(pattern) {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		violations, err := openapi.ValidateBody(pattern, r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, "Request body too large")
+			return
+		}
+		if err != nil {
+			if err != openapi.ErrInvalidBody {
+				slog.ErrorContext(r.Context(), "Error reading request body", "error", err)
+			}
+			writeError(w, r, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if len(violations) > 0 {
+			problem.WriteValidation(w, r, violations)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
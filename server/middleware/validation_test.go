@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"baufi-optimierer/server/auth"
+	"baufi-optimierer/server/models"
+	"baufi-optimierer/server/problem"
+)
+
+func TestValidationMiddleware(t *testing.T) {
+	const valid = `{"name": "Haus", "amount": 300000, "interestRate": 3.5, "startDate": "2024-01-01",
+		"fixedInterestYears": 10, "repaymentType": "PERCENTAGE", "repaymentValue": 2}`
+
+	var received string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/loans", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := ValidationMiddleware(mux)
+	user := &models.User{ID: "user-1"}
+
+	tests := []struct {
+		name      string
+		body      string
+		anonymous bool
+		status    int
+		pointers  []string // Of the expected violations
+	}{
+		{name: "accepted", body: valid, status: http.StatusCreated},
+		{name: "wrong type and range", body: strings.Replace(strings.Replace(valid, `300000`, `"300000"`, 1), `"interestRate": 3.5`, `"interestRate": 25`, 1),
+			status: http.StatusBadRequest, pointers: []string{"/amount", "/interestRate"}},
+		{name: "missing field", body: `{"name": "Haus"}`, status: http.StatusBadRequest,
+			pointers: []string{"/amount", "/interestRate", "/startDate", "/fixedInterestYears", "/repaymentType", "/repaymentValue"}},
+		{name: "not JSON", body: `{"name":`, status: http.StatusBadRequest},
+		{name: "anonymous requests reach the route", body: `{"name":`, anonymous: true, status: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			r := httptest.NewRequest("POST", "/api/loans", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			if !tt.anonymous {
+				r = r.WithContext(auth.WithUser(r.Context(), user))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusCreated {
+				if received != tt.body {
+					t.Errorf("route received %q, want the original body", received)
+				}
+				return
+			}
+			if received != "" {
+				t.Error("rejected body reached the route")
+			}
+
+			var p problem.Problem
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			var pointers []string
+			for _, v := range p.Errors {
+				pointers = append(pointers, v.Pointer)
+			}
+			if strings.Join(pointers, " ") != strings.Join(tt.pointers, " ") {
+				t.Errorf("violations at %v, want %v", pointers, tt.pointers)
+			}
+			if len(tt.pointers) > 0 && p.Code != problem.CodeValidationFailed {
+				t.Errorf("code = %q, want %q", p.Code, problem.CodeValidationFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+// AuditEntry records one change of a loan or special payment.
+// Entries are append-only; a loan's entries form its history.
+type AuditEntry struct {
+	ID           int64                  `json:"id"`
+	LoanID       string                 `json:"loanId"`
+	EntityType   string                 `json:"entityType"`
+	EntityID     string                 `json:"entityId"`
+	Operation    string                 `json:"operation"`
+	ActorID      string                 `json:"actorId,omitempty"`
+	ActorName    string                 `json:"actorName,omitempty"`
+	Changes      map[string]FieldChange `json:"changes"`
+	RestoredFrom int64                  `json:"restoredFrom,omitempty"` // Entry whose version was restored
+	CreatedAt    string                 `json:"createdAt"`
+}
+
+// FieldChange holds the value of a field before and after a change.
+// Before is null for creates, After is null for deletes.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Audit entity type constants
+const (
+	AuditEntityLoan           = "loan"
+	AuditEntitySpecialPayment = "special_payment"
+)
+
+// Audit operation constants
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore" // Restored from the trash
+)
@@ -0,0 +1,13 @@
+package models
+
+// CalendarToken grants read access to an iCalendar feed.
+// A token without LoanID covers the feed of all loans.
+type CalendarToken struct {
+	ID         string `json:"id"`
+	UserID     string `json:"-"`
+	LoanID     string `json:"loanId,omitempty"`
+	Token      string `json:"token,omitempty"` // Only returned once on creation
+	URL        string `json:"url,omitempty"`   // Only returned once on creation
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import "fmt"
+
+// ExportVersion is the version of the export document format.
+// Bump it whenever the document layout changes incompatibly.
+const ExportVersion = 1
+
+// Import modes
+const (
+	ImportModeMerge   = "merge"
+	ImportModeReplace = "replace"
+)
+
+// Conflict strategies for merge imports
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+)
+
+// ExportDocument is a full snapshot of all loans and their special payments
+type ExportDocument struct {
+	Version    int    `json:"version"`
+	ExportedAt string `json:"exportedAt"`
+	Loans      []Loan `json:"loans"`
+}
+
+// ImportResult summarizes what an import changed
+type ImportResult struct {
+	Mode            string `json:"mode"`
+	LoansCreated    int    `json:"loansCreated"`
+	LoansUpdated    int    `json:"loansUpdated"`
+	LoansSkipped    int    `json:"loansSkipped"`
+	PaymentsCreated int    `json:"paymentsCreated"`
+	PaymentsUpdated int    `json:"paymentsUpdated"`
+	PaymentsSkipped int    `json:"paymentsSkipped"`
+}
+
+// Validate validates an export document before it is imported and reports
+// all problems with JSON pointers into the document
+func (d *ExportDocument) Validate() error {
+	var errs ValidationErrors
+	if d.Version != ExportVersion {
+		errs.Add("/version", ViolationUnsupportedVersion, d.Version, ExportVersion)
+		return errs
+	}
+
+	loanIDs := make(map[string]bool, len(d.Loans))
+	paymentIDs := make(map[string]bool)
+	for i := range d.Loans {
+		loan := &d.Loans[i]
+		prefix := fmt.Sprintf("/loans/%d", i)
+		if loan.ID == "" {
+			errs.Add(prefix+"/id", ViolationRequired)
+		} else if loanIDs[loan.ID] {
+			errs.Add(prefix+"/id", ViolationDuplicateID, loan.ID)
+		}
+		loanIDs[loan.ID] = true
+
+		errs.Merge(prefix, loan.ValidateCreate())
+
+		for j := range loan.SpecialPayments {
+			payment := &loan.SpecialPayments[j]
+			paymentPrefix := fmt.Sprintf("%s/specialPayments/%d", prefix, j)
+			if payment.ID == "" {
+				errs.Add(paymentPrefix+"/id", ViolationRequired)
+			} else if paymentIDs[payment.ID] {
+				errs.Add(paymentPrefix+"/id", ViolationDuplicateID, payment.ID)
+			}
+			paymentIDs[payment.ID] = true
+
+			errs.Merge(paymentPrefix, payment.Validate())
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Household groups loans that are shared between its members
+type Household struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role,omitempty"` // Role of the current user
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// HouseholdMember is a user with a role in a household
+type HouseholdMember struct {
+	UserID   string `json:"userId"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+// HouseholdInvite lets the holder of its link join a household with a role
+type HouseholdInvite struct {
+	ID          string `json:"id"`
+	HouseholdID string `json:"householdId"`
+	Role        string `json:"role"`
+	Token       string `json:"token,omitempty"` // Only returned once on creation
+	URL         string `json:"url,omitempty"`   // Only returned once on creation
+	ExpiresAt   string `json:"expiresAt"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// Role constants. Owners manage the household and its members, editors
+// change loans and special payments, viewers only read them.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// InviteDuration is how long an invite link can be used
+const InviteDuration = 7 * 24 * time.Hour
+
+// roleRanks orders the roles by their permissions
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// IsValidRole checks if a role is one of the role constants
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows reports whether a role grants at least the permissions of the required role
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required] && IsValidRole(role)
+}
+
+// Validate validates a household for creation and updates
+func (h *Household) Validate() error {
+	var errs ValidationErrors
+	h.Name = strings.TrimSpace(h.Name)
+	if h.Name == "" {
+		errs.Add("/name", ViolationRequired)
+	} else if len(h.Name) > 100 {
+		errs.Add("/name", ViolationTooLong, 100)
+	}
+	return errs.Err()
+}
+
+// ValidateRole validates the role of a member or invite
+func ValidateRole(role string) error {
+	var errs ValidationErrors
+	if !IsValidRole(role) {
+		errs.Add("/role", ViolationInvalidChoice, "owner, editor, viewer")
+	}
+	return errs.Err()
+}
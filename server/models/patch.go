@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MergePatchContentType is the media type of JSON Merge Patch documents (RFC 7396)
+const MergePatchContentType = "application/merge-patch+json"
+
+// loanReadOnlyFields are part of the loan representation but cannot be changed
+var loanReadOnlyFields = map[string]bool{
+	"id":              true,
+	"specialPayments": true,
+	"version":         true,
+	"householdId":     true,
+	"role":            true,
+	"createdAt":       true,
+	"updatedAt":       true,
+	"deletedAt":       true,
+}
+
+// ApplyMergePatch applies a JSON Merge Patch to a loan. A null member clears
+// the field; required fields are reported as missing by ValidateCreate
+// afterwards. Every member is type checked strictly, and all problems are
+// returned together.
+func (l *Loan) ApplyMergePatch(patch map[string]json.RawMessage) error {
+	var errs ValidationErrors
+	for _, field := range sortedFields(patch) {
+		value := patch[field]
+		pointer := "/" + pointerEscaper.Replace(field)
+		if loanReadOnlyFields[field] {
+			errs.Add(pointer, ViolationReadOnly)
+			continue
+		}
+
+		target, code := l.field(field)
+		if target == nil {
+			errs.Add(pointer, ViolationUnknownField)
+			continue
+		}
+
+		if string(value) == "null" {
+			clearField(target)
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			errs.Add(pointer, code)
+		}
+	}
+	return errs.Err()
+}
+
+// ApplyUpdate applies the members of a PUT body to a loan; fields that are
+// left out keep their value. Read-only fields are ignored, so a client can
+// send back the loan it got. Members are type checked strictly like in
+// ApplyMergePatch, but null is a type error rather than clearing the field.
+func (l *Loan) ApplyUpdate(update map[string]json.RawMessage) error {
+	var errs ValidationErrors
+	for _, field := range sortedFields(update) {
+		value := update[field]
+		pointer := "/" + pointerEscaper.Replace(field)
+		if loanReadOnlyFields[field] {
+			continue
+		}
+
+		target, code := l.field(field)
+		if target == nil {
+			errs.Add(pointer, ViolationUnknownField)
+			continue
+		}
+
+		if string(value) == "null" {
+			errs.Add(pointer, code)
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			errs.Add(pointer, code)
+		}
+	}
+	return errs.Err()
+}
+
+// field returns a pointer to a writable field of the loan by its JSON name
+// and the violation of a value of the wrong type, or nil for other names
+func (l *Loan) field(name string) (interface{}, string) {
+	switch name {
+	case "name":
+		return &l.Name, ViolationMustBeString
+	case "amount":
+		return &l.Amount, ViolationMustBeNumber
+	case "interestRate":
+		return &l.InterestRate, ViolationMustBeNumber
+	case "startDate":
+		return &l.StartDate, ViolationMustBeString
+	case "fixedInterestYears":
+		return &l.FixedInterestYears, ViolationMustBeInteger
+	case "repaymentType":
+		return &l.RepaymentType, ViolationMustBeString
+	case "repaymentValue":
+		return &l.RepaymentValue, ViolationMustBeNumber
+	}
+	return nil, ""
+}
+
+// sortedFields returns the member names of a JSON object in order, so
+// violations are reported in a stable order
+func sortedFields(object map[string]json.RawMessage) []string {
+	fields := make([]string, 0, len(object))
+	for field := range object {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// pointerEscaper escapes a member name for use in a JSON pointer (RFC 6901)
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// clearField resets a patched field to its zero value
+func clearField(target interface{}) {
+	switch v := target.(type) {
+	case *string:
+		*v = ""
+	case *float64:
+		*v = 0
+	case *int:
+		*v = 0
+	}
+}
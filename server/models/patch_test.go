@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func testLoan() Loan {
+	return Loan{
+		ID:                 "loan-1",
+		Name:               "Haus",
+		Amount:             300000,
+		InterestRate:       3.5,
+		StartDate:          "2024-01-01",
+		FixedInterestYears: 10,
+		RepaymentType:      RepaymentTypePercentage,
+		RepaymentValue:     2,
+	}
+}
+
+// violations returns the pointer and code of every violation in err
+func violations(t *testing.T, err error) [][2]string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("err = %v, want ValidationErrors", err)
+	}
+	var result [][2]string
+	for _, v := range errs {
+		result = append(result, [2]string{v.Pointer, v.Code})
+	}
+	return result
+}
+
+func decodeObject(t *testing.T, body string) map[string]json.RawMessage {
+	t.Helper()
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		patch      string
+		want       func(*Loan)
+		violations [][2]string
+	}{
+		{"change", `{"amount": 250000, "name": "Wohnung"}`, func(l *Loan) { l.Amount, l.Name = 250000, "Wohnung" }, nil},
+		{"null clears", `{"name": null, "fixedInterestYears": null}`, func(l *Loan) { l.Name, l.FixedInterestYears = "", 0 }, nil},
+		{"wrong type", `{"amount": "300000"}`, nil, [][2]string{{"/amount", ViolationMustBeNumber}}},
+		{"fraction for an integer", `{"fixedInterestYears": 10.5}`, nil, [][2]string{{"/fixedInterestYears", ViolationMustBeInteger}}},
+		{"unknown field", `{"amout": 1}`, nil, [][2]string{{"/amout", ViolationUnknownField}}},
+		{"read-only id", `{"id": "other"}`, nil, [][2]string{{"/id", ViolationReadOnly}}},
+		{"all problems in order", `{"version": 3, "name": 1, "a/b": 1}`, nil, [][2]string{
+			{"/a~1b", ViolationUnknownField}, {"/name", ViolationMustBeString}, {"/version", ViolationReadOnly},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := testLoan()
+			got := violations(t, loan.ApplyMergePatch(decodeObject(t, tt.patch)))
+			if !reflect.DeepEqual(got, tt.violations) {
+				t.Errorf("violations = %v, want %v", got, tt.violations)
+			}
+			if tt.want != nil {
+				want := testLoan()
+				tt.want(&want)
+				if !reflect.DeepEqual(loan, want) {
+					t.Errorf("loan = %+v, want %+v", loan, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		update     string
+		want       func(*Loan)
+		violations [][2]string
+	}{
+		{"change", `{"amount": 250000}`, func(l *Loan) { l.Amount = 250000 }, nil},
+		{"read-only fields are ignored", `{"id": "other", "version": 7, "specialPayments": [], "interestRate": 4}`,
+			func(l *Loan) { l.InterestRate = 4 }, nil},
+		{"wrong type", `{"amount": "300000"}`, nil, [][2]string{{"/amount", ViolationMustBeNumber}}},
+		{"null", `{"name": null}`, nil, [][2]string{{"/name", ViolationMustBeString}}},
+		{"unknown field", `{"amout": 1}`, nil, [][2]string{{"/amout", ViolationUnknownField}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loan := testLoan()
+			got := violations(t, loan.ApplyUpdate(decodeObject(t, tt.update)))
+			if !reflect.DeepEqual(got, tt.violations) {
+				t.Errorf("violations = %v, want %v", got, tt.violations)
+			}
+			if tt.want != nil {
+				want := testLoan()
+				tt.want(&want)
+				if !reflect.DeepEqual(loan, want) {
+					t.Errorf("loan = %+v, want %+v", loan, want)
+				}
+			}
+		})
+	}
+}
@@ -9,18 +9,19 @@ type SpecialPayment struct {
 	Note      string  `json:"note,omitempty"`
 	CreatedAt string  `json:"createdAt"`
 	UpdatedAt string  `json:"updatedAt"`
+	DeletedAt string  `json:"deletedAt,omitempty"` // Set for payments in the trash
 }
 
 // Validate validates a special payment
 func (sp *SpecialPayment) Validate() error {
+	var errs ValidationErrors
 	if sp.Date == "" {
-		return ValidationError("date is required")
-	}
-	if !isValidDate(sp.Date) {
-		return ValidationError("date must be in YYYY-MM-DD format")
+		errs.Add("/date", ViolationRequired)
+	} else if !IsValidDate(sp.Date) {
+		errs.Add("/date", ViolationInvalidDate)
 	}
 	if sp.Amount <= 0 {
-		return ValidationError("amount must be > 0")
+		errs.Add("/amount", ViolationMustBePositive)
 	}
-	return nil
+	return errs.Err()
 }
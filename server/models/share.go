@@ -0,0 +1,60 @@
+package models
+
+// ShareLink grants read-only access to one loan without an account
+type ShareLink struct {
+	ID          string `json:"id"`
+	LoanID      string `json:"loanId"`
+	Token       string `json:"token,omitempty"`     // Only returned once on creation
+	URL         string `json:"url,omitempty"`       // Only returned once on creation
+	ReportURL   string `json:"reportUrl,omitempty"` // Only returned once on creation
+	HasPassword bool   `json:"hasPassword"`
+	ExpiresAt   string `json:"expiresAt"`
+	RevokedAt   string `json:"revokedAt,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	LastUsedAt  string `json:"lastUsedAt,omitempty"`
+	AccessCount int    `json:"accessCount"`
+}
+
+// ShareLinkInput is sent to create a share link
+type ShareLinkInput struct {
+	ExpiresInDays int    `json:"expiresInDays,omitempty"`
+	Password      string `json:"password,omitempty"`
+}
+
+// ShareAccess is an entry in the access log of a share link
+type ShareAccess struct {
+	AccessedAt string `json:"accessedAt"`
+	Outcome    string `json:"outcome"`
+	IPAddress  string `json:"ipAddress"`
+	UserAgent  string `json:"userAgent"`
+}
+
+// Share link limits
+const (
+	DefaultShareDays = 30
+	MaxShareDays     = 365
+)
+
+// ShareAccess outcome constants
+const (
+	ShareAccessGranted       = "granted"
+	ShareAccessNoPassword    = "password_required"
+	ShareAccessWrongPassword = "wrong_password"
+	ShareAccessExpired       = "expired"
+	ShareAccessRevoked       = "revoked"
+)
+
+// Validate validates the input for a new share link and applies defaults
+func (s *ShareLinkInput) Validate() error {
+	if s.ExpiresInDays == 0 {
+		s.ExpiresInDays = DefaultShareDays
+	}
+	var errs ValidationErrors
+	if s.ExpiresInDays < 1 || s.ExpiresInDays > MaxShareDays {
+		errs.Add("/expiresInDays", ViolationOutOfRange, 1, MaxShareDays)
+	}
+	if len(s.Password) > 72 {
+		errs.Add("/password", ViolationTooLong, 72)
+	}
+	return errs.Err()
+}
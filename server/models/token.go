@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// APIToken is a personal access token for scripts and other API clients
+type APIToken struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Token      string   `json:"token,omitempty"` // Only returned once on creation
+	CreatedAt  string   `json:"createdAt"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+}
+
+// Scope constants. The read scope allows GET requests, the write scope all
+// other methods.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// HasScope reports whether a list of scopes contains a scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate validates a token for creation. Scopes default to read only.
+func (t *APIToken) Validate() error {
+	var errs ValidationErrors
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		errs.Add("/name", ViolationRequired)
+	} else if len(t.Name) > 100 {
+		errs.Add("/name", ViolationTooLong, 100)
+	}
+	if len(t.Scopes) == 0 {
+		t.Scopes = []string{ScopeRead}
+	}
+	for i, scope := range t.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			errs.Add(fmt.Sprintf("/scopes/%d", i), ViolationInvalidChoice, "read, write")
+		}
+	}
+	return errs.Err()
+}
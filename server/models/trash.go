@@ -0,0 +1,10 @@
+package models
+
+// Trash lists deleted loans and special payments that can still be restored.
+// Special payments of a deleted loan are restored with the loan and are
+// not listed separately.
+type Trash struct {
+	Loans           []Loan           `json:"loans"`
+	SpecialPayments []SpecialPayment `json:"specialPayments"`
+	RetentionDays   int              `json:"retentionDays"` // Days after which deleted items are purged
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// User is an account that owns loans
+type User struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// Credentials are sent to register and log in
+type Credentials struct {
+	Email    string `json:"email"`
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+}
+
+// MinPasswordLength is the minimum length of a password
+const MinPasswordLength = 8
+
+// Normalize trims the credentials and lower-cases the email address
+func (c *Credentials) Normalize() {
+	c.Email = strings.ToLower(strings.TrimSpace(c.Email))
+	c.Name = strings.TrimSpace(c.Name)
+}
+
+// ValidateRegister validates credentials for creating an account
+func (c *Credentials) ValidateRegister() error {
+	var errs ValidationErrors
+	if _, err := mail.ParseAddress(c.Email); err != nil {
+		errs.Add("/email", ViolationInvalidEmail)
+	}
+	if len(c.Password) < MinPasswordLength {
+		errs.Add("/password", ViolationTooShort, MinPasswordLength)
+	} else if len(c.Password) > 72 {
+		errs.Add("/password", ViolationTooLong, 72)
+	}
+	return errs.Err()
+}
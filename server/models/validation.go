@@ -1,26 +1,139 @@
 package models
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 )
 
-// ValidationError represents a validation error
-type ValidationError string
+// Violation describes one invalid field. Pointer is a JSON pointer
+// (RFC 6901) to the field, Code a stable identifier of the problem and
+// Params the values filled into its message.
+type Violation struct {
+	Pointer string
+	Code    string
+	Params  []interface{}
+}
+
+// Violation codes
+const (
+	ViolationRequired           = "required"
+	ViolationMustBePositive     = "must_be_positive"
+	ViolationOutOfRange         = "out_of_range"
+	ViolationInvalidDate        = "invalid_date"
+	ViolationInvalidChoice      = "invalid_choice"
+	ViolationTooShort           = "too_short"
+	ViolationTooLong            = "too_long"
+	ViolationInvalidEmail       = "invalid_email"
+	ViolationDuplicateID        = "duplicate_id"
+	ViolationUnsupportedVersion = "unsupported_version"
+	ViolationMustBeString       = "must_be_string"
+	ViolationMustBeNumber       = "must_be_number"
+	ViolationMustBeInteger      = "must_be_integer"
+	ViolationMustBeBoolean      = "must_be_boolean"
+	ViolationMustBeObject       = "must_be_object"
+	ViolationMustBeArray        = "must_be_array"
+	ViolationReadOnly           = "read_only"
+	ViolationUnknownField       = "unknown_field"
+)
+
+// violationMessages holds the message of each violation code per language
+var violationMessages = map[string]map[string]string{
+	"en": {
+		ViolationRequired:           "is required",
+		ViolationMustBePositive:     "must be greater than 0",
+		ViolationOutOfRange:         "must be between %v and %v",
+		ViolationInvalidDate:        "must be a date in YYYY-MM-DD format",
+		ViolationInvalidChoice:      "must be one of %v",
+		ViolationTooShort:           "must be at least %v characters",
+		ViolationTooLong:            "must be at most %v characters",
+		ViolationInvalidEmail:       "must be a valid email address",
+		ViolationDuplicateID:        "must be unique, %v is used more than once",
+		ViolationUnsupportedVersion: "unsupported version %v (expected %v)",
+		ViolationMustBeString:       "must be a string",
+		ViolationMustBeNumber:       "must be a number",
+		ViolationMustBeInteger:      "must be an integer",
+		ViolationMustBeBoolean:      "must be true or false",
+		ViolationMustBeObject:       "must be an object",
+		ViolationMustBeArray:        "must be an array",
+		ViolationReadOnly:           "is read-only",
+		ViolationUnknownField:       "is not a known field",
+	},
+	"de": {
+		ViolationRequired:           "ist erforderlich",
+		ViolationMustBePositive:     "muss größer als 0 sein",
+		ViolationOutOfRange:         "muss zwischen %v und %v liegen",
+		ViolationInvalidDate:        "muss ein Datum im Format JJJJ-MM-TT sein",
+		ViolationInvalidChoice:      "muss einer der Werte %v sein",
+		ViolationTooShort:           "muss mindestens %v Zeichen lang sein",
+		ViolationTooLong:            "darf höchstens %v Zeichen lang sein",
+		ViolationInvalidEmail:       "muss eine gültige E-Mail-Adresse sein",
+		ViolationDuplicateID:        "muss eindeutig sein, %v kommt mehrfach vor",
+		ViolationUnsupportedVersion: "nicht unterstützte Version %v (erwartet %v)",
+		ViolationMustBeString:       "muss eine Zeichenkette sein",
+		ViolationMustBeNumber:       "muss eine Zahl sein",
+		ViolationMustBeInteger:      "muss eine ganze Zahl sein",
+		ViolationMustBeBoolean:      "muss true oder false sein",
+		ViolationMustBeObject:       "muss ein Objekt sein",
+		ViolationMustBeArray:        "muss eine Liste sein",
+		ViolationReadOnly:           "ist schreibgeschützt",
+		ViolationUnknownField:       "ist kein bekanntes Feld",
+	},
+}
+
+// Message returns the message of the violation in a language ("de" or
+// "en"), falling back to English
+func (v Violation) Message(lang string) string {
+	messages, ok := violationMessages[lang]
+	if !ok {
+		messages = violationMessages["en"]
+	}
+	return fmt.Sprintf(messages[v.Code], v.Params...)
+}
+
+// ValidationErrors collects all violations found while validating a value
+type ValidationErrors []Violation
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, v := range e {
+		messages[i] = strings.TrimPrefix(v.Pointer, "/") + " " + v.Message("en")
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add records a violation of the field at the JSON pointer
+func (e *ValidationErrors) Add(pointer, code string, params ...interface{}) {
+	*e = append(*e, Violation{Pointer: pointer, Code: code, Params: params})
+}
+
+// Merge records the violations of a nested value below a JSON pointer prefix
+func (e *ValidationErrors) Merge(prefix string, err error) {
+	if nested, ok := err.(ValidationErrors); ok {
+		for _, v := range nested {
+			e.Add(prefix+v.Pointer, v.Code, v.Params...)
+		}
+	}
+}
 
-func (e ValidationError) Error() string {
-	return string(e)
+// Err returns the collected violations as an error, or nil if there are none
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
 }
 
-// IsValidationError checks if an error is a ValidationError
+// IsValidationError checks if an error is a ValidationErrors
 func IsValidationError(err error) bool {
-	_, ok := err.(ValidationError)
+	_, ok := err.(ValidationErrors)
 	return ok
 }
 
 // dateRegex matches YYYY-MM-DD format
 var dateRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
 
-// isValidDate validates a date string in YYYY-MM-DD format
-func isValidDate(date string) bool {
+// IsValidDate validates a date string in YYYY-MM-DD format
+func IsValidDate(date string) bool {
 	return dateRegex.MatchString(date)
 }
@@ -0,0 +1,150 @@
+// Package openapi serves the OpenAPI document of the API and checks request
+// bodies against the schemas it defines, so the documented contract is the
+// one the server enforces.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"baufi-optimierer/server/csp"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+//go:embed docs.html
+var docsHTML []byte
+
+// docsPolicy allows only the inline script and style of the docs page and
+// fetching the document
+var docsPolicy = csp.Policy(
+	"default-src 'none'",
+	"script-src "+strings.Join(csp.Sources(docsHTML, "script"), " "),
+	"style-src "+strings.Join(csp.Sources(docsHTML, "style"), " "),
+	"connect-src 'self'",
+	"base-uri 'none'",
+	"form-action 'none'",
+	"frame-ancestors 'none'",
+)
+
+// document is the part of the OpenAPI document the server interprets
+type document struct {
+	Paths      map[string]map[string]*operation `json:"paths"` // Path template -> lower-case method -> operation
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// operation is a single API operation
+type operation struct {
+	Security    *[]map[string][]string `json:"security"` // An empty list overrides the default: no authentication
+	RequestBody *requestBody           `json:"requestBody"`
+}
+
+// requestBody describes the accepted bodies of an operation per media type
+type requestBody struct {
+	Required bool `json:"required"`
+	Content  map[string]struct {
+		Schema *Schema `json:"schema"`
+	} `json:"content"`
+}
+
+// spec is parsed once; the document is embedded, so a broken one is a build error
+var spec = mustParse(specJSON)
+
+func mustParse(data []byte) *document {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		panic("openapi: invalid document: " + err.Error())
+	}
+	return &doc
+}
+
+// operation looks up the operation of a method and path template
+func (d *document) operation(method, path string) *operation {
+	return d.Paths[path][strings.ToLower(method)]
+}
+
+// covers reports whether a path documented with any method matches a route
+// pattern without method. A pattern ending in a slash matches the paths below it.
+func (d *document) covers(pattern string) bool {
+	for path := range d.Paths {
+		if path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPublic reports whether the operation registered under the route pattern
+// can be used without authentication
+func IsPublic(pattern string) bool {
+	method, path, _ := strings.Cut(pattern, " ")
+	op := spec.operation(method, path)
+	return op != nil && op.Security != nil && len(*op.Security) == 0
+}
+
+// HandleSpec returns the OpenAPI document
+func HandleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(specJSON)
+}
+
+// HandleDocs returns a page that renders the OpenAPI document
+func HandleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", docsPolicy)
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsHTML)
+}
+
+// CheckRoutes compares the route patterns registered on the server, such as
+// "GET /api/loans/{id}", with the operations of the document. A pattern
+// without a method must cover a documented path: "/api/shared" the path
+// itself and "/api/shared/" a path below it. Patterns outside /api are not
+// part of the API and ignored. The error names every route missing from the
+// document and every documented operation without a route.
+func CheckRoutes(patterns []string) error {
+	registered := make(map[string]bool)
+	var problems []string
+	for _, pattern := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "", pattern
+		}
+		if !strings.HasPrefix(path, "/api/") {
+			continue
+		}
+		if method == "" {
+			if !spec.covers(path) {
+				problems = append(problems, "undocumented route "+pattern)
+			}
+			continue
+		}
+		registered[pattern] = true
+		if spec.operation(method, path) == nil {
+			problems = append(problems, "undocumented route "+pattern)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method := range item {
+			pattern := strings.ToUpper(method) + " " + path
+			if !registered[pattern] {
+				problems = append(problems, "documented operation without route "+pattern)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("OpenAPI document does not match the routes: %s", strings.Join(problems, ", "))
+}
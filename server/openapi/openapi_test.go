@@ -0,0 +1,49 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRoutes(t *testing.T) {
+	// All documented operations, so only the added patterns can fail
+	var documented []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	if err := CheckRoutes(documented); err != nil {
+		t.Fatalf("documented operations: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{"method-less documented path", "/api/shared", false},
+		{"method-less subtree with documented paths", "/api/shared/", false},
+		{"method-less undocumented path", "/api/secret", true},
+		{"method-less undocumented subtree", "/api/secret/", true},
+		{"undocumented method", "DELETE /api/shared", true},
+		{"undocumented path", "GET /api/secret", true},
+		{"outside /api", "GET /metrics", false},
+		{"method-less outside /api", "/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRoutes(append(documented, tt.pattern))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckRoutes() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "undocumented route "+tt.pattern) {
+				t.Errorf("error %q does not name the route", err)
+			}
+		})
+	}
+
+	if err := CheckRoutes(documented[1:]); err == nil || !strings.Contains(err.Error(), "documented operation without route "+documented[0]) {
+		t.Errorf("missing route: CheckRoutes() = %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"baufi-optimierer/server/models"
+)
+
+// ErrInvalidBody is returned for a request body that is missing or not JSON
+var ErrInvalidBody = errors.New("invalid request body")
+
+// Schema is the subset of JSON Schema used by the document. Minimum and
+// maximum are checked as a range, exclusiveMinimum is used as 0 for
+// positive numbers, and formats other than date and email are not checked.
+type Schema struct {
+	Ref              string             `json:"$ref"`
+	Type             schemaType         `json:"type"`
+	Properties       map[string]*Schema `json:"properties"`
+	Required         []string           `json:"required"`
+	Items            *Schema            `json:"items"`
+	Enum             []interface{}      `json:"enum"`
+	Format           string             `json:"format"`
+	MinLength        *int               `json:"minLength"`
+	MaxLength        *int               `json:"maxLength"`
+	Minimum          *float64           `json:"minimum"`
+	Maximum          *float64           `json:"maximum"`
+	ExclusiveMinimum *float64           `json:"exclusiveMinimum"`
+}
+
+// schemaType holds the allowed JSON types. JSON Schema allows a single type
+// or a list such as ["string", "null"].
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// allows reports whether a decoded JSON value has one of the types
+func (t schemaType) allows(value interface{}) bool {
+	for _, name := range t {
+		switch v := value.(type) {
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case float64:
+			if name == "number" || (name == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeViolations maps JSON types to the violation of a value of another type
+var typeViolations = map[string]string{
+	"string":  models.ViolationMustBeString,
+	"number":  models.ViolationMustBeNumber,
+	"integer": models.ViolationMustBeInteger,
+	"boolean": models.ViolationMustBeBoolean,
+	"object":  models.ViolationMustBeObject,
+	"array":   models.ViolationMustBeArray,
+}
+
+// violation returns the violation of a value that has none of the types
+func (t schemaType) violation() string {
+	for _, name := range t {
+		if code, ok := typeViolations[name]; ok {
+			return code
+		}
+	}
+	return models.ViolationRequired
+}
+
+// ValidateBody checks the body of a request against the schema of the
+// operation registered under the route pattern, e.g. "POST /api/loans".
+// It returns the violations, or ErrInvalidBody if a body is required but
+// missing or is not JSON. The body is buffered so the handler can read it again.
+func ValidateBody(pattern string, r *http.Request) (models.ValidationErrors, error) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return nil, nil
+	}
+	op := spec.operation(method, path)
+	if op == nil || op.RequestBody == nil {
+		return nil, nil
+	}
+	schema := op.RequestBody.schema(r.Header.Get("Content-Type"))
+	if schema == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			return nil, ErrInvalidBody
+		}
+		return nil, nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, ErrInvalidBody
+	}
+
+	var errs models.ValidationErrors
+	spec.validate(schema, value, "", &errs)
+	return errs, nil
+}
+
+// schema returns the schema for the media type of a request. Bodies of
+// other or missing media types are checked as JSON, which is what the
+// handlers decode them as.
+func (b *requestBody) schema(contentType string) *Schema {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if content, ok := b.Content[mediaType]; ok {
+		return content.Schema
+	}
+	if content, ok := b.Content["application/json"]; ok {
+		return content.Schema
+	}
+	return nil
+}
+
+// resolve follows a reference to a schema in the components
+func (d *document) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// validate records every violation of a value against a schema. Pointer is
+// the JSON pointer of the value in the request body.
+func (d *document) validate(s *Schema, value interface{}, pointer string, errs *models.ValidationErrors) {
+	s = d.resolve(s)
+	if s == nil {
+		return
+	}
+	if len(s.Type) > 0 && !s.Type.allows(value) {
+		errs.Add(pointer, s.Type.violation())
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs.Add(pointer+"/"+escapePointer(name), models.ViolationRequired)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				d.validate(property, v[name], pointer+"/"+escapePointer(name), errs)
+			}
+		}
+
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				d.validate(s.Items, item, pointer+"/"+strconv.Itoa(i), errs)
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		switch {
+		case len(s.Enum) > 0 && !inEnum(s.Enum, v):
+			errs.Add(pointer, models.ViolationInvalidChoice, enumList(s.Enum))
+		case s.MinLength != nil && length < *s.MinLength:
+			// An empty string counts as a missing value
+			if *s.MinLength == 1 {
+				errs.Add(pointer, models.ViolationRequired)
+			} else {
+				errs.Add(pointer, models.ViolationTooShort, *s.MinLength)
+			}
+		case s.MaxLength != nil && length > *s.MaxLength:
+			errs.Add(pointer, models.ViolationTooLong, *s.MaxLength)
+		case s.Format == "date" && !models.IsValidDate(v):
+			errs.Add(pointer, models.ViolationInvalidDate)
+		case s.Format == "email" && !isEmail(v):
+			errs.Add(pointer, models.ViolationInvalidEmail)
+		}
+
+	case float64:
+		switch {
+		case len(s.Enum) > 0 && !inEnum(s.Enum, v):
+			errs.Add(pointer, models.ViolationInvalidChoice, enumList(s.Enum))
+		case s.Minimum != nil && s.Maximum != nil && (v < *s.Minimum || v > *s.Maximum):
+			errs.Add(pointer, models.ViolationOutOfRange, *s.Minimum, *s.Maximum)
+		case s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum:
+			errs.Add(pointer, models.ViolationMustBePositive)
+		}
+	}
+}
+
+// inEnum reports whether a value is one of the allowed values
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// enumList formats the allowed values for a violation message
+func enumList(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, allowed := range enum {
+		values[i] = fmt.Sprint(allowed)
+	}
+	return strings.Join(values, ", ")
+}
+
+// isEmail checks an email address the way registration does
+func isEmail(value string) bool {
+	_, err := mail.ParseAddress(strings.TrimSpace(value))
+	return err == nil
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// escapePointer escapes a member name for use in a JSON pointer (RFC 6901)
+func escapePointer(name string) string {
+	return pointerEscaper.Replace(name)
+}
@@ -0,0 +1,223 @@
+// Package problem writes error responses as RFC 7807 problem details with
+// a stable error code and localised titles and messages.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"baufi-optimierer/server/models"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// typePrefix turns an error code into the problem type URI
+const typePrefix = "urn:baufi-optimierer:problem:"
+
+// Problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier; Title and the messages are localised.
+type Problem struct {
+	Type     string           `json:"type"`
+	Title    string           `json:"title"`
+	Status   int              `json:"status"`
+	Detail   string           `json:"detail,omitempty"`
+	Instance string           `json:"instance,omitempty"`
+	Code     string           `json:"code"`
+	Errors   []FieldViolation `json:"errors,omitempty"`
+}
+
+// FieldViolation is one invalid field of a request
+type FieldViolation struct {
+	Pointer string `json:"pointer"` // JSON pointer into the request body
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error codes
+const (
+	CodeBadRequest           = "bad_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodeGone                 = "gone"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePreconditionRequired = "precondition_required"
+	CodeTooLarge             = "too_large"
+	CodeRateLimited          = "rate_limited"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeInternal             = "internal_error"
+	CodeBadGateway           = "bad_gateway"
+)
+
+// codesByStatus maps HTTP status codes to their default error code
+var codesByStatus = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMediaType,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusBadGateway:            CodeBadGateway,
+}
+
+// titles holds the title of each error code per language
+var titles = map[string]map[string]string{
+	"en": {
+		CodeBadRequest:           "Bad request",
+		CodeValidationFailed:     "Validation failed",
+		CodeUnauthorized:         "Authentication required",
+		CodeForbidden:            "Access denied",
+		CodeNotFound:             "Not found",
+		CodeMethodNotAllowed:     "Method not allowed",
+		CodeConflict:             "Conflict",
+		CodeGone:                 "No longer available",
+		CodePreconditionFailed:   "Precondition failed",
+		CodeUnsupportedMediaType: "Unsupported media type",
+		CodePreconditionRequired: "Precondition required",
+		CodeTooLarge:             "Request too large",
+		CodeRateLimited:          "Too many requests",
+		CodeQuotaExceeded:        "Quota exceeded",
+		CodeInternal:             "Internal server error",
+		CodeBadGateway:           "Upstream service unavailable",
+	},
+	"de": {
+		CodeBadRequest:           "Ungültige Anfrage",
+		CodeValidationFailed:     "Validierung fehlgeschlagen",
+		CodeUnauthorized:         "Anmeldung erforderlich",
+		CodeForbidden:            "Zugriff verweigert",
+		CodeNotFound:             "Nicht gefunden",
+		CodeMethodNotAllowed:     "Methode nicht erlaubt",
+		CodeConflict:             "Konflikt",
+		CodeGone:                 "Nicht mehr verfügbar",
+		CodePreconditionFailed:   "Vorbedingung fehlgeschlagen",
+		CodeUnsupportedMediaType: "Nicht unterstützter Medientyp",
+		CodePreconditionRequired: "Vorbedingung erforderlich",
+		CodeTooLarge:             "Anfrage zu groß",
+		CodeRateLimited:          "Zu viele Anfragen",
+		CodeQuotaExceeded:        "Kontingent erschöpft",
+		CodeInternal:             "Interner Serverfehler",
+		CodeBadGateway:           "Vorgelagerter Dienst nicht erreichbar",
+	},
+}
+
+// CodeForStatus returns the default error code of an HTTP status
+func CodeForStatus(status int) string {
+	if code, ok := codesByStatus[status]; ok {
+		return code
+	}
+	return strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// Title returns the title of an error code in a language
+func Title(code, lang string) string {
+	if title, ok := titles[lang][code]; ok {
+		return title
+	}
+	if title, ok := titles["en"][code]; ok {
+		return title
+	}
+	return code
+}
+
+// Language picks the language of error messages: the lang query parameter
+// if it is de or en, otherwise the preferred supported language of the
+// Accept-Language header. English is the default.
+func Language(r *http.Request) string {
+	if lang := strings.ToLower(r.URL.Query().Get("lang")); lang == "de" || lang == "en" {
+		return lang
+	}
+
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if lang != "de" && lang != "en" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		candidates = append(candidates, candidate{lang, quality})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	if len(candidates) > 0 && candidates[0].quality > 0 {
+		return candidates[0].lang
+	}
+	return "en"
+}
+
+// Write sends a problem response with the given error code and detail
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	lang := Language(r)
+	send(w, lang, &Problem{
+		Type:     typePrefix + code,
+		Title:    Title(code, lang),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+// Error sends a problem response with the default error code of the status
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, status, CodeForStatus(status), detail)
+}
+
+// WriteValidation sends a 400 problem response that lists every violation
+// with a message in the language of the request
+func WriteValidation(w http.ResponseWriter, r *http.Request, errs models.ValidationErrors) {
+	lang := Language(r)
+	violations := make([]FieldViolation, len(errs))
+	details := make([]string, len(errs))
+	for i, v := range errs {
+		violations[i] = FieldViolation{
+			Pointer: v.Pointer,
+			Code:    v.Code,
+			Message: v.Message(lang),
+		}
+		details[i] = strings.TrimPrefix(v.Pointer, "/") + " " + violations[i].Message
+	}
+
+	send(w, lang, &Problem{
+		Type:     typePrefix + CodeValidationFailed,
+		Title:    Title(CodeValidationFailed, lang),
+		Status:   http.StatusBadRequest,
+		Detail:   strings.Join(details, "; "),
+		Instance: r.URL.Path,
+		Code:     CodeValidationFailed,
+		Errors:   violations,
+	})
+}
+
+// send writes a problem in a language as the response
+func send(w http.ResponseWriter, lang string, p *Problem) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Content-Language", lang)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
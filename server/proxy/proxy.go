@@ -0,0 +1,94 @@
+// Package proxy tells who sent a request when the server runs behind
+// reverse proxies. The X-Forwarded-* headers are only believed from the
+// trusted proxies; anyone else could set them to whatever they like.
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Trusted are the addresses of the reverse proxies in front of the server.
+// Empty means the server is reached directly and no header is trusted.
+var Trusted []netip.Prefix
+
+// ParsePrefixes parses IP addresses and CIDR ranges, e.g. "10.0.0.0/8"
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", value)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ClientIP returns the address of the client. Requests from a trusted proxy
+// are attributed to the last X-Forwarded-For entry that is not a trusted
+// proxy itself, the address the outermost proxy saw. Entries left of it were
+// sent by the client and are ignored.
+func ClientIP(r *http.Request) string {
+	remote := remoteHost(r)
+	if !isTrusted(remote) {
+		return remote
+	}
+
+	entries := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if entry == "" {
+			continue
+		}
+		if !isTrusted(entry) {
+			return entry
+		}
+		remote = entry
+	}
+	return remote
+}
+
+// IsHTTPS reports whether the client connected over HTTPS, directly or to a
+// trusted proxy that terminates TLS and sets X-Forwarded-Proto
+func IsHTTPS(r *http.Request) bool {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && FromTrusted(r) {
+		return proto == "https"
+	}
+	return r.TLS != nil
+}
+
+// FromTrusted reports whether the request was sent by a trusted proxy
+func FromTrusted(r *http.Request) bool {
+	return isTrusted(remoteHost(r))
+}
+
+// remoteHost returns the address of the peer of the connection
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isTrusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range Trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
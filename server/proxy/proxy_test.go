@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		trusted   bool
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", true, "203.0.113.5:1234", "", "203.0.113.5"},
+		{"direct client sends XFF", true, "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"no proxies configured", false, "10.0.0.2:1234", "198.51.100.1", "10.0.0.2"},
+		{"one proxy", true, "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"spoofed entries left of the proxy", true, "10.0.0.2:1234", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", true, "10.0.0.2:1234", "198.51.100.1, 192.168.1.1, 10.1.1.1", "198.51.100.1"},
+		{"proxy without XFF", true, "10.0.0.2:1234", "", "10.0.0.2"},
+		{"only proxies", true, "10.0.0.2:1234", "10.0.0.3", "10.0.0.3"},
+		{"IPv6 remote", true, "[2001:db8::1]:1234", "198.51.100.1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Trusted = nil
+			if tt.trusted {
+				Trusted = trusted
+			}
+			defer func() { Trusted = nil }()
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefixes(t *testing.T) {
+	if _, err := ParsePrefixes([]string{"10.0.0.0/8", "::1", "fd00::/8"}); err != nil {
+		t.Errorf("valid prefixes rejected: %v", err)
+	}
+	if _, err := ParsePrefixes([]string{"proxy.local"}); err == nil {
+		t.Error("host name accepted")
+	}
+}
+
+func TestIsHTTPS(t *testing.T) {
+	trusted, err := ParsePrefixes([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Trusted = trusted
+	defer func() { Trusted = nil }()
+
+	tests := []struct {
+		name   string
+		remote string
+		proto  string
+		want   bool
+	}{
+		{"trusted proxy terminates TLS", "10.0.0.2:1234", "https", true},
+		{"trusted proxy over HTTP", "10.0.0.2:1234", "http", false},
+		{"client claims HTTPS", "203.0.113.5:1234", "https", false},
+		{"no header", "10.0.0.2:1234", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if got := IsHTTPS(r); got != tt.want {
+				t.Errorf("IsHTTPS() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestLimiter(perMinute int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(perMinute)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestAllowBurstThenReject(t *testing.T) {
+	l, _ := newTestLimiter(3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	// 3 per minute refill one token every 20 seconds
+	if wait != 20*time.Second {
+		t.Errorf("wait = %v, want 20s", wait)
+	}
+}
+
+func TestAllowRefills(t *testing.T) {
+	l, clock := newTestLimiter(60)
+	for i := 0; i < 60; i++ {
+		l.Allow("a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("empty bucket allowed a request")
+	}
+
+	clock.advance(500 * time.Millisecond)
+	ok, wait := l.Allow("a")
+	if ok {
+		t.Fatal("half a token allowed a request")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms", wait)
+	}
+
+	clock.advance(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("refilled token rejected")
+	}
+
+	// The bucket never holds more than one minute's budget
+	clock.advance(time.Hour)
+	allowed := 0
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); ok {
+			allowed++
+		}
+	}
+	if allowed != 60 {
+		t.Errorf("allowed %d requests after a long pause, want 60", allowed)
+	}
+}
+
+func TestAllowSeparatesKeys(t *testing.T) {
+	l, _ := newTestLimiter(1)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("first request of a rejected")
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("b is limited by the budget of a")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("second request of a allowed")
+	}
+}
+
+func TestSweepForgetsFullBuckets(t *testing.T) {
+	l, clock := newTestLimiter(60)
+	l.Allow("a")
+	l.Allow("b")
+	clock.advance(2 * time.Minute)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after sweep, want 1", len(l.buckets))
+	}
+}
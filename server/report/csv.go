@@ -0,0 +1,78 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"baufi-optimierer/server/finance"
+)
+
+// WriteScheduleCSV writes the monthly schedule as CSV, followed by a subtotal
+// row after the last month of every calendar year
+func WriteScheduleCSV(w io.Writer, result *finance.Result, l Labels) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = l.CSVSeparator
+
+	if err := cw.Write(scheduleHeader(l)); err != nil {
+		return err
+	}
+
+	years := finance.YearlySummary(result.Schedule)
+	yearIdx := 0
+	for i, rec := range result.Schedule {
+		marker := ""
+		if rec.IsFixedPeriodEnd {
+			marker = l.Marker
+		}
+		if err := cw.Write([]string{
+			rec.Date.Format(l.DateLayout),
+			l.FormatNumber(rec.TotalPayment, false),
+			l.FormatNumber(rec.Interest, false),
+			l.FormatNumber(rec.Principal, false),
+			l.FormatNumber(rec.SpecialPayment, false),
+			l.FormatNumber(rec.RemainingBalance, false),
+			marker,
+		}); err != nil {
+			return err
+		}
+
+		// Close the year after its last month
+		lastOfYear := i == len(result.Schedule)-1 || result.Schedule[i+1].Date.Year() != rec.Date.Year()
+		if lastOfYear {
+			y := years[yearIdx]
+			yearIdx++
+			marker := ""
+			if y.FixedPeriodEnd {
+				marker = l.Marker
+			}
+			if err := cw.Write([]string{
+				fmt.Sprintf(l.YearTotal, y.Year),
+				l.FormatNumber(y.TotalPayment, false),
+				l.FormatNumber(y.Interest, false),
+				l.FormatNumber(y.Principal, false),
+				l.FormatNumber(y.SpecialPayment, false),
+				l.FormatNumber(y.RemainingBalance, false),
+				marker,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// scheduleHeader returns the column headers shared by all schedule formats
+func scheduleHeader(l Labels) []string {
+	return []string{
+		l.Date,
+		l.Payment,
+		l.Interest,
+		l.Principal,
+		l.SpecialPayment,
+		l.RemainingBalance,
+		l.FixedPeriodEnd,
+	}
+}
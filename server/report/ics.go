@@ -0,0 +1,194 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"baufi-optimierer/server/finance"
+	"baufi-optimierer/server/models"
+)
+
+// forwardLoanYears is how long before the end of the fixed interest period
+// a forward loan (Forward-Darlehen) can usually be arranged
+const forwardLoanYears = 3
+
+// calendarEvent is a single all-day VEVENT
+type calendarEvent struct {
+	uid         string
+	date        time.Time
+	summary     string
+	description string
+	rrule       string
+	alarm       string // VALARM trigger, e.g. "-P30D"
+	alarmText   string
+}
+
+// WriteCalendar writes an iCalendar feed with the installments, planned special
+// payments, special payment allowance resets, the end of the fixed interest
+// period and the forward loan window of the given loans
+func WriteCalendar(w io.Writer, loans []models.Loan, l Labels, now time.Time) error {
+	var events []calendarEvent
+	for i := range loans {
+		loanEvents, err := loanCalendarEvents(&loans[i], l)
+		if err != nil {
+			return err
+		}
+		events = append(events, loanEvents...)
+	}
+
+	name := l.CalendarName
+	if len(loans) == 1 {
+		name = fmt.Sprintf("%s – %s", l.CalendarName, loans[0].Name)
+	}
+
+	cw := &icsWriter{w: w}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//baufi-optimierer//Calendar//" + strings.ToUpper(l.Lang))
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.line("X-WR-CALNAME:" + icsEscape(name))
+	cw.line("REFRESH-INTERVAL;VALUE=DURATION:PT12H")
+	cw.line("X-PUBLISHED-TTL:PT12H")
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, ev := range events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + ev.uid + "@baufi-optimierer")
+		cw.line("DTSTAMP:" + stamp)
+		cw.line("DTSTART;VALUE=DATE:" + ev.date.Format("20060102"))
+		cw.line("DTEND;VALUE=DATE:" + ev.date.AddDate(0, 0, 1).Format("20060102"))
+		if ev.rrule != "" {
+			cw.line("RRULE:" + ev.rrule)
+		}
+		cw.line("SUMMARY:" + icsEscape(ev.summary))
+		if ev.description != "" {
+			cw.line("DESCRIPTION:" + icsEscape(ev.description))
+		}
+		cw.line("TRANSP:TRANSPARENT")
+		if ev.alarm != "" {
+			cw.line("BEGIN:VALARM")
+			cw.line("ACTION:DISPLAY")
+			cw.line("TRIGGER:" + ev.alarm)
+			cw.line("DESCRIPTION:" + icsEscape(ev.alarmText))
+			cw.line("END:VALARM")
+		}
+		cw.line("END:VEVENT")
+	}
+	cw.line("END:VCALENDAR")
+
+	return cw.err
+}
+
+// loanCalendarEvents builds the calendar events of one loan
+func loanCalendarEvents(loan *models.Loan, l Labels) ([]calendarEvent, error) {
+	result, err := finance.Calculate(loan)
+	if err != nil {
+		return nil, err
+	}
+	start, err := time.Parse("2006-01-02", loan.StartDate)
+	if err != nil {
+		return nil, err
+	}
+
+	withName := func(s string) string {
+		return fmt.Sprintf("%s – %s", s, loan.Name)
+	}
+
+	var events []calendarEvent
+
+	// Monthly installments until payoff
+	if len(result.Schedule) > 0 {
+		events = append(events, calendarEvent{
+			uid:     "installment-" + loan.ID,
+			date:    result.Schedule[0].Date,
+			summary: withName(fmt.Sprintf(l.EventInstallment, l.FormatCurrency(result.Schedule[0].TotalPayment))),
+			rrule:   fmt.Sprintf("FREQ=MONTHLY;COUNT=%d", len(result.Schedule)),
+		})
+	}
+
+	// Planned special payments
+	for _, sp := range loan.SpecialPayments {
+		date, err := time.Parse("2006-01-02", sp.Date)
+		if err != nil {
+			continue
+		}
+		events = append(events, calendarEvent{
+			uid:         "special-payment-" + sp.ID,
+			date:        date,
+			summary:     withName(fmt.Sprintf(l.EventSpecialPayment, l.FormatCurrency(sp.Amount))),
+			description: sp.Note,
+		})
+	}
+
+	// The special payment allowance renews on every anniversary within the
+	// fixed period. The alarm reminds of the deadline of the expiring year.
+	if loan.FixedInterestYears > 1 {
+		events = append(events, calendarEvent{
+			uid:       "allowance-reset-" + loan.ID,
+			date:      start.AddDate(1, 0, 0),
+			summary:   withName(l.EventAllowanceReset),
+			rrule:     fmt.Sprintf("FREQ=YEARLY;COUNT=%d", loan.FixedInterestYears-1),
+			alarm:     "-P30D",
+			alarmText: withName(l.AllowanceReminder),
+		})
+	}
+
+	// End of the fixed interest period
+	events = append(events, calendarEvent{
+		uid:         "fixed-period-end-" + loan.ID,
+		date:        result.FixedPeriodEndDate,
+		summary:     withName(l.EventFixedEnd),
+		description: fmt.Sprintf(l.FixedEndDescription, l.FormatCurrency(result.RemainingAtFixedEnd)),
+		alarm:       "-P30D",
+		alarmText:   withName(l.EventFixedEnd),
+	})
+
+	// Forward loan window before the fixed period ends
+	forward := result.FixedPeriodEndDate.AddDate(-forwardLoanYears, 0, 0)
+	if forward.After(start) {
+		events = append(events, calendarEvent{
+			uid:         "forward-window-" + loan.ID,
+			date:        forward,
+			summary:     withName(l.EventForwardWindow),
+			description: fmt.Sprintf(l.ForwardWindowDesc, result.FixedPeriodEndDate.Format(l.DateLayout)),
+			alarm:       "PT9H",
+			alarmText:   withName(l.EventForwardWindow),
+		})
+	}
+
+	return events, nil
+}
+
+// icsWriter writes content lines with CRLF endings, folded at 75 octets
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (c *icsWriter) line(s string) {
+	if c.err != nil {
+		return
+	}
+
+	var b strings.Builder
+	lineLen := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if lineLen+size > 75 {
+			b.WriteString("\r\n ")
+			lineLen = 1
+		}
+		b.WriteRune(r)
+		lineLen += size
+	}
+	b.WriteString("\r\n")
+
+	_, c.err = io.WriteString(c.w, b.String())
+}
+
+// icsEscape escapes a TEXT property value
+var icsEscape = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace
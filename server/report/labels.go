@@ -0,0 +1,242 @@
+package report
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Supported report languages
+const (
+	LangDE = "de"
+	LangEN = "en"
+)
+
+// Labels holds the translated texts used in generated reports
+type Labels struct {
+	Lang             string
+	Schedule         string
+	Date             string
+	Payment          string
+	Interest         string
+	Principal        string
+	SpecialPayment   string
+	RemainingBalance string
+	FixedPeriodEnd   string
+	YearTotal        string // Format string taking the year
+	Marker           string // Cell text marking the fixed period end
+
+	// Texts of the PDF report
+	ReportTitle        string
+	GeneratedOn        string
+	Parameters         string
+	LoanAmount         string
+	InterestRateLabel  string
+	StartDate          string
+	FixedInterestYears string
+	InitialRepayment   string
+	MonthlyPayment     string
+	KeyFigures         string
+	TotalInterest      string
+	PayoffDate         string
+	RemainingAtFixed   string
+	InterestSaved      string
+	MonthsSaved        string
+	BalanceChart       string
+	YearlyOverview     string
+	Year               string
+	SpecialPayments    string
+	Note               string
+	NoSpecialPayments  string
+	YearsUnit          string
+	MonthsUnit         string
+	PageOf             string // Format string taking page number and page count
+
+	// Texts of the iCalendar feed
+	CalendarName        string
+	EventInstallment    string // Format string taking the amount
+	EventSpecialPayment string // Format string taking the amount
+	EventAllowanceReset string
+	AllowanceReminder   string
+	EventFixedEnd       string
+	FixedEndDescription string // Format string taking the residual debt
+	EventForwardWindow  string
+	ForwardWindowDesc   string // Format string taking the end date of the fixed period
+
+	// Number and date formatting for text based formats
+	DateLayout   string
+	DecimalSep   string
+	ThousandsSep string
+	CSVSeparator rune
+
+	// Excel number format codes for spreadsheet formats
+	SheetDateFormat     string
+	SheetCurrencyFormat string
+}
+
+var labelsByLang = map[string]Labels{
+	LangDE: {
+		Lang:             LangDE,
+		Schedule:         "Tilgungsplan",
+		Date:             "Datum",
+		Payment:          "Rate",
+		Interest:         "Zinsen",
+		Principal:        "Tilgung",
+		SpecialPayment:   "Sondertilgung",
+		RemainingBalance: "Restschuld",
+		FixedPeriodEnd:   "Ende Zinsbindung",
+		YearTotal:        "Summe %d",
+		Marker:           "Zinsbindungsende",
+
+		ReportTitle:        "Finanzierungsbericht",
+		GeneratedOn:        "Erstellt am",
+		Parameters:         "Darlehensparameter",
+		LoanAmount:         "Darlehensbetrag",
+		InterestRateLabel:  "Sollzins",
+		StartDate:          "Auszahlung",
+		FixedInterestYears: "Sollzinsbindung",
+		InitialRepayment:   "Anfängliche Tilgung",
+		MonthlyPayment:     "Monatliche Rate",
+		KeyFigures:         "Kennzahlen",
+		TotalInterest:      "Zinsen gesamt",
+		PayoffDate:         "Schuldenfrei",
+		RemainingAtFixed:   "Restschuld Ende Zinsbindung",
+		InterestSaved:      "Zinsersparnis",
+		MonthsSaved:        "Laufzeitverkürzung",
+		BalanceChart:       "Verlauf der Restschuld",
+		YearlyOverview:     "Jahresübersicht",
+		Year:               "Jahr",
+		SpecialPayments:    "Sondertilgungen",
+		Note:               "Notiz",
+		NoSpecialPayments:  "Keine Sondertilgungen geplant.",
+		YearsUnit:          "Jahre",
+		MonthsUnit:         "Monate",
+		PageOf:             "Seite %d von %d",
+
+		CalendarName:        "Baufinanzierung",
+		EventInstallment:    "Rate %s",
+		EventSpecialPayment: "Sondertilgung %s",
+		EventAllowanceReset: "Neues Sondertilgungsjahr",
+		AllowanceReminder:   "Das Sondertilgungsrecht des laufenden Jahres verfällt in 30 Tagen.",
+		EventFixedEnd:       "Ende der Zinsbindung",
+		FixedEndDescription: "Voraussichtliche Restschuld: %s",
+		EventForwardWindow:  "Forward-Darlehen prüfen",
+		ForwardWindowDesc:   "Die Zinsbindung endet am %s. Ab jetzt kann die Anschlussfinanzierung mit einem Forward-Darlehen gesichert werden.",
+		DateLayout:          "02.01.2006",
+		DecimalSep:          ",",
+		ThousandsSep:        ".",
+		CSVSeparator:        ';',
+
+		SheetDateFormat:     "dd.mm.yyyy",
+		SheetCurrencyFormat: `#,##0.00 "€"`,
+	},
+	LangEN: {
+		Lang:             LangEN,
+		Schedule:         "Amortization schedule",
+		Date:             "Date",
+		Payment:          "Payment",
+		Interest:         "Interest",
+		Principal:        "Principal",
+		SpecialPayment:   "Special payment",
+		RemainingBalance: "Remaining balance",
+		FixedPeriodEnd:   "End of fixed period",
+		YearTotal:        "Total %d",
+		Marker:           "Fixed period end",
+
+		ReportTitle:        "Loan report",
+		GeneratedOn:        "Generated on",
+		Parameters:         "Loan parameters",
+		LoanAmount:         "Loan amount",
+		InterestRateLabel:  "Interest rate",
+		StartDate:          "Start date",
+		FixedInterestYears: "Fixed interest period",
+		InitialRepayment:   "Initial repayment",
+		MonthlyPayment:     "Monthly payment",
+		KeyFigures:         "Key figures",
+		TotalInterest:      "Total interest",
+		PayoffDate:         "Payoff date",
+		RemainingAtFixed:   "Residual debt at end of fixed period",
+		InterestSaved:      "Interest saved",
+		MonthsSaved:        "Term reduction",
+		BalanceChart:       "Remaining balance over time",
+		YearlyOverview:     "Yearly overview",
+		Year:               "Year",
+		SpecialPayments:    "Special payments",
+		Note:               "Note",
+		NoSpecialPayments:  "No special payments planned.",
+		YearsUnit:          "years",
+		MonthsUnit:         "months",
+		PageOf:             "Page %d of %d",
+
+		CalendarName:        "Mortgage",
+		EventInstallment:    "Installment %s",
+		EventSpecialPayment: "Special payment %s",
+		EventAllowanceReset: "New special payment year",
+		AllowanceReminder:   "This year's special payment allowance expires in 30 days.",
+		EventFixedEnd:       "End of fixed interest period",
+		FixedEndDescription: "Expected residual debt: %s",
+		EventForwardWindow:  "Consider a forward loan",
+		ForwardWindowDesc:   "The fixed interest period ends on %s. Follow-up financing can now be secured with a forward loan.",
+		DateLayout:          "2006-01-02",
+		DecimalSep:          ".",
+		ThousandsSep:        ",",
+		CSVSeparator:        ',',
+
+		SheetDateFormat:     "yyyy-mm-dd",
+		SheetCurrencyFormat: `"€"#,##0.00`,
+	},
+}
+
+// LabelsFor returns the labels for a language, falling back to German.
+// The second return value reports whether the language is supported.
+func LabelsFor(lang string) (Labels, bool) {
+	if lang == "" {
+		return labelsByLang[LangDE], true
+	}
+	l, ok := labelsByLang[strings.ToLower(lang)]
+	if !ok {
+		return labelsByLang[LangDE], false
+	}
+	return l, true
+}
+
+// FormatNumber formats a number with two decimals using the language's separators
+func (l Labels) FormatNumber(value float64, thousands bool) string {
+	neg := value < 0
+	if neg {
+		value = -value
+	}
+
+	cents := int64(value*100 + 0.5)
+	intPart := cents / 100
+	frac := cents % 100
+
+	digits := []byte(strconv.FormatInt(intPart, 10))
+	if thousands {
+		var grouped []byte
+		for i, d := range digits {
+			if i > 0 && (len(digits)-i)%3 == 0 {
+				grouped = append(grouped, l.ThousandsSep...)
+			}
+			grouped = append(grouped, d)
+		}
+		digits = grouped
+	}
+
+	s := string(digits) + l.DecimalSep
+	if frac < 10 {
+		s += "0"
+	}
+	s += strconv.FormatInt(frac, 10)
+	if neg && cents != 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// FormatCurrency formats an amount in euros with thousands separators
+func (l Labels) FormatCurrency(value float64) string {
+	if l.Lang == LangEN {
+		return "€" + l.FormatNumber(value, true)
+	}
+	return l.FormatNumber(value, true) + " €"
+}
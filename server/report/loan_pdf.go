@@ -0,0 +1,338 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"baufi-optimierer/server/finance"
+	"baufi-optimierer/server/models"
+)
+
+// Page layout of the loan report in points
+const (
+	marginLeft   = 50.0
+	marginRight  = pageWidth - 50.0
+	marginTop    = 60.0
+	marginBottom = pageHeight - 60.0
+	rowHeight    = 15.0
+)
+
+// WriteLoanPDF writes a printable report of a loan with its parameters, key
+// figures, a balance chart, the special payments with their individual impact
+// and a yearly overview
+func WriteLoanPDF(w io.Writer, loan *models.Loan, l Labels, now time.Time) error {
+	comparison, err := finance.Compare(loan)
+	if err != nil {
+		return err
+	}
+	result := comparison.Actual
+
+	impacts := make([]*finance.Impact, len(loan.SpecialPayments))
+	for i, sp := range loan.SpecialPayments {
+		if impacts[i], err = finance.PaymentImpact(loan, sp.ID); err != nil {
+			return err
+		}
+	}
+
+	doc := &pdfDocument{}
+	doc.newPage()
+	y := marginTop
+
+	doc.text(marginLeft, y, fontBold, 18, fmt.Sprintf("%s: %s", l.ReportTitle, loan.Name))
+	y += 18
+	doc.setColor(0.4, 0.4, 0.4)
+	doc.text(marginLeft, y, fontRegular, 9, fmt.Sprintf("%s %s", l.GeneratedOn, now.Format(l.DateLayout)))
+	doc.setColor(0, 0, 0)
+	y += 30
+
+	// Loan parameters
+	y = sectionHeader(doc, y, l.Parameters)
+	repayment := l.FormatNumber(loan.RepaymentValue, false) + " %"
+	repaymentLabel := l.InitialRepayment
+	if loan.RepaymentType == models.RepaymentTypeAbsolute {
+		repayment = l.FormatCurrency(loan.RepaymentValue)
+		repaymentLabel = l.MonthlyPayment
+	}
+	monthlyPayment := 0.0
+	if len(result.Schedule) > 0 {
+		monthlyPayment = result.Schedule[0].TotalPayment
+	}
+	params := [][2]string{
+		{l.LoanAmount, l.FormatCurrency(loan.Amount)},
+		{l.InterestRateLabel, l.FormatNumber(loan.InterestRate, false) + " %"},
+		{l.StartDate, formatISODate(loan.StartDate, l)},
+		{l.FixedInterestYears, fmt.Sprintf("%d %s", loan.FixedInterestYears, l.YearsUnit)},
+		{repaymentLabel, repayment},
+	}
+	if loan.RepaymentType != models.RepaymentTypeAbsolute {
+		params = append(params, [2]string{l.MonthlyPayment, l.FormatCurrency(monthlyPayment)})
+	}
+	y = keyValueRows(doc, y, params)
+	y += 15
+
+	// Key figures
+	y = sectionHeader(doc, y, l.KeyFigures)
+	kpis := [][2]string{
+		{l.TotalInterest, l.FormatCurrency(result.TotalInterest)},
+		{l.PayoffDate, result.PayoffDate.Format(l.DateLayout)},
+		{l.RemainingAtFixed, fmt.Sprintf("%s (%s)", l.FormatCurrency(result.RemainingAtFixedEnd), result.FixedPeriodEndDate.Format(l.DateLayout))},
+	}
+	if len(loan.SpecialPayments) > 0 {
+		kpis = append(kpis,
+			[2]string{l.InterestSaved, l.FormatCurrency(comparison.InterestSaved)},
+			[2]string{l.MonthsSaved, fmt.Sprintf("%d %s", comparison.MonthsSaved, l.MonthsUnit)},
+		)
+	}
+	y = keyValueRows(doc, y, kpis)
+	y += 15
+
+	// Balance chart
+	y = sectionHeader(doc, y, l.BalanceChart)
+	y = balanceChart(doc, y, loan, comparison, l)
+	y += 15
+
+	// Special payments with their individual impact
+	y = sectionHeader(doc, y, l.SpecialPayments)
+	if len(loan.SpecialPayments) == 0 {
+		doc.text(marginLeft, y+10, fontRegular, 10, l.NoSpecialPayments)
+		y += rowHeight
+	} else {
+		cols := []tableColumn{
+			{l.Date, 70, false},
+			{l.SpecialPayment, 90, true},
+			{l.InterestSaved, 90, true},
+			{l.MonthsSaved, 90, true},
+			{l.Note, 155, false},
+		}
+		y = tableHeader(doc, y, cols)
+		for i, sp := range loan.SpecialPayments {
+			if y+rowHeight > marginBottom {
+				doc.newPage()
+				y = tableHeader(doc, marginTop, cols)
+			}
+			tableRow(doc, y, cols, fontRegular, []string{
+				formatISODate(sp.Date, l),
+				l.FormatCurrency(sp.Amount),
+				l.FormatCurrency(impacts[i].InterestSaved),
+				fmt.Sprintf("%d %s", impacts[i].MonthsSaved, l.MonthsUnit),
+				sp.Note,
+			})
+			y += rowHeight
+		}
+	}
+
+	// Yearly overview, starting on a new page
+	doc.newPage()
+	y = sectionHeader(doc, marginTop, l.YearlyOverview)
+	cols := []tableColumn{
+		{l.Year, 45, false},
+		{l.Payment, 90, true},
+		{l.Interest, 90, true},
+		{l.Principal, 90, true},
+		{l.SpecialPayment, 90, true},
+		{l.RemainingBalance, 90, true},
+	}
+	y = tableHeader(doc, y, cols)
+	for _, year := range finance.YearlySummary(result.Schedule) {
+		if y+rowHeight > marginBottom {
+			doc.newPage()
+			y = tableHeader(doc, marginTop, cols)
+		}
+		// Highlight the year in which the fixed interest period ends
+		font := fontRegular
+		if year.FixedPeriodEnd {
+			font = fontBold
+		}
+		tableRow(doc, y, cols, font, []string{
+			fmt.Sprintf("%d", year.Year),
+			l.FormatCurrency(year.TotalPayment),
+			l.FormatCurrency(year.Interest),
+			l.FormatCurrency(year.Principal),
+			l.FormatCurrency(year.SpecialPayment),
+			l.FormatCurrency(year.RemainingBalance),
+		})
+		y += rowHeight
+	}
+	y += 10
+	doc.setColor(0.4, 0.4, 0.4)
+	doc.text(marginLeft, y, fontRegular, 8, fmt.Sprintf("%s: %s", l.Marker, result.FixedPeriodEndDate.Format(l.DateLayout)))
+	doc.setColor(0, 0, 0)
+
+	// Page numbers
+	for i, page := range doc.pages {
+		doc.current = page
+		doc.setColor(0.4, 0.4, 0.4)
+		doc.textRight(marginRight, pageHeight-30, fontRegular, 8, fmt.Sprintf(l.PageOf, i+1, len(doc.pages)))
+		doc.text(marginLeft, pageHeight-30, fontRegular, 8, loan.Name)
+	}
+
+	return doc.writeTo(w)
+}
+
+// tableColumn describes one column of a report table
+type tableColumn struct {
+	title      string
+	width      float64
+	alignRight bool
+}
+
+// sectionHeader draws a section title with an underline and returns the next y position
+func sectionHeader(doc *pdfDocument, y float64, title string) float64 {
+	doc.text(marginLeft, y, fontBold, 12, title)
+	doc.setColor(0.7, 0.7, 0.7)
+	doc.line(marginLeft, y+4, marginRight, y+4, 0.5)
+	doc.setColor(0, 0, 0)
+	return y + 18
+}
+
+// keyValueRows draws label/value pairs and returns the next y position
+func keyValueRows(doc *pdfDocument, y float64, rows [][2]string) float64 {
+	for _, row := range rows {
+		doc.text(marginLeft, y, fontRegular, 10, row[0])
+		doc.text(marginLeft+200, y, fontBold, 10, row[1])
+		y += rowHeight
+	}
+	return y
+}
+
+// tableHeader draws the header of a table and returns the y position of the first row
+func tableHeader(doc *pdfDocument, y float64, cols []tableColumn) float64 {
+	doc.setColor(0.93, 0.94, 0.96)
+	doc.fillRect(marginLeft, y-11, marginRight-marginLeft, rowHeight+1)
+	doc.setColor(0, 0, 0)
+	tableRow(doc, y, cols, fontBold, columnTitles(cols))
+	return y + rowHeight + 2
+}
+
+// tableRow draws one row of cells
+func tableRow(doc *pdfDocument, y float64, cols []tableColumn, font string, cells []string) {
+	x := marginLeft
+	for i, col := range cols {
+		text := truncateText(font, 9, cells[i], col.width-6)
+		if col.alignRight {
+			doc.textRight(x+col.width-4, y, font, 9, text)
+		} else {
+			doc.text(x+4, y, font, 9, text)
+		}
+		x += col.width
+	}
+}
+
+func columnTitles(cols []tableColumn) []string {
+	titles := make([]string, len(cols))
+	for i, col := range cols {
+		titles[i] = col.title
+	}
+	return titles
+}
+
+// truncateText shortens a string with an ellipsis so that it fits into maxWidth
+func truncateText(font string, size float64, s string, maxWidth float64) string {
+	if textWidth(font, size, s) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(font, size, string(runes)+"...") > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// balanceChart plots the remaining balance per month and returns the next y position.
+// If the loan has special payments the balance without them is drawn for comparison.
+func balanceChart(doc *pdfDocument, y float64, loan *models.Loan, comparison *finance.Comparison, l Labels) float64 {
+	const chartHeight = 170.0
+	left := marginLeft + 70
+	right := marginRight - 10
+	top := y + 5
+	bottom := top + chartHeight
+
+	months := len(comparison.Base.Schedule)
+	if len(comparison.Actual.Schedule) > months {
+		months = len(comparison.Actual.Schedule)
+	}
+	xFor := func(i int) float64 {
+		if months <= 1 {
+			return left
+		}
+		return left + (right-left)*float64(i)/float64(months-1)
+	}
+	yFor := func(balance float64) float64 {
+		return bottom - chartHeight*balance/loan.Amount
+	}
+
+	// Horizontal grid lines with balance labels
+	for i := 0; i <= 4; i++ {
+		value := loan.Amount * float64(i) / 4
+		gy := yFor(value)
+		doc.setColor(0.88, 0.88, 0.88)
+		doc.line(left, gy, right, gy, 0.5)
+		doc.setColor(0.4, 0.4, 0.4)
+		doc.textRight(left-6, gy+3, fontRegular, 7, l.FormatCurrency(float64(int64(value))))
+	}
+
+	// Year labels on the x axis, at most about ten of them
+	schedule := comparison.Actual.Schedule
+	if len(comparison.Base.Schedule) > len(schedule) {
+		schedule = comparison.Base.Schedule
+	}
+	years := months / 12
+	step := max(1, (years+9)/10)
+	for i, rec := range schedule {
+		if rec.Date.Month() != time.January || (rec.Date.Year()-schedule[0].Date.Year())%step != 0 {
+			continue
+		}
+		x := xFor(i)
+		doc.line(x, bottom, x, bottom+3, 0.5)
+		label := fmt.Sprintf("%d", rec.Date.Year())
+		doc.text(x-textWidth(fontRegular, 7, label)/2, bottom+12, fontRegular, 7, label)
+	}
+
+	// Balance without special payments
+	if len(loan.SpecialPayments) > 0 {
+		doc.setColor(0.7, 0.7, 0.7)
+		plotBalance(doc, comparison.Base.Schedule, xFor, yFor)
+	}
+
+	// Actual balance
+	doc.setColor(0.15, 0.39, 0.92)
+	plotBalance(doc, comparison.Actual.Schedule, xFor, yFor)
+
+	// Fixed period end marker
+	for i, rec := range comparison.Actual.Schedule {
+		if rec.IsFixedPeriodEnd {
+			x := xFor(i)
+			doc.setColor(0.86, 0.15, 0.15)
+			doc.dashedLine(x, top, x, bottom, 0.8)
+			doc.text(x+3, top+8, fontRegular, 7, l.Marker)
+			break
+		}
+	}
+
+	doc.setColor(0, 0, 0)
+	doc.line(left, bottom, right, bottom, 0.8)
+	doc.line(left, top, left, bottom, 0.8)
+
+	return bottom + 25
+}
+
+// plotBalance draws the remaining balance line of a schedule, starting at the loan amount
+func plotBalance(doc *pdfDocument, schedule []finance.MonthRecord, xFor func(int) float64, yFor func(float64) float64) {
+	xs := make([]float64, len(schedule))
+	ys := make([]float64, len(schedule))
+	for i, rec := range schedule {
+		xs[i] = xFor(i)
+		ys[i] = yFor(rec.RemainingBalance)
+	}
+	doc.polyline(xs, ys, 1.2)
+}
+
+// formatISODate reformats a YYYY-MM-DD date in the language's date layout
+func formatISODate(date string, l Labels) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format(l.DateLayout)
+}
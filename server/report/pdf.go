@@ -0,0 +1,234 @@
+package report
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in PDF points
+const (
+	pageWidth  = 595.28
+	pageHeight = 841.89
+)
+
+// Fonts available in a pdfDocument. Both are standard Type 1 fonts,
+// so nothing has to be embedded.
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// pdfDocument is a minimal PDF writer supporting text, lines and rectangles.
+// It only uses the standard Helvetica fonts with WinAnsi encoding, which
+// covers German umlauts and the euro sign.
+type pdfDocument struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+}
+
+// newPage starts a new page and makes it the current drawing target
+func (d *pdfDocument) newPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+}
+
+// text draws a string with its baseline starting at x, y (top-left origin)
+func (d *pdfDocument) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(d.current, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, pageHeight-y, pdfString(s))
+}
+
+// textRight draws a string whose right edge ends at x
+func (d *pdfDocument) textRight(x, y float64, font string, size float64, s string) {
+	d.text(x-textWidth(font, size, s), y, font, size, s)
+}
+
+// line draws a straight line
+func (d *pdfDocument) line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.current, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, pageHeight-y1, x2, pageHeight-y2)
+}
+
+// dashedLine draws a straight dashed line
+func (d *pdfDocument) dashedLine(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(d.current, "[3 3] 0 d ")
+	d.line(x1, y1, x2, y2, width)
+	fmt.Fprintf(d.current, "[] 0 d\n")
+}
+
+// polyline draws connected line segments through the given points
+func (d *pdfDocument) polyline(xs, ys []float64, width float64) {
+	if len(xs) < 2 {
+		return
+	}
+	fmt.Fprintf(d.current, "%.2f w %.2f %.2f m\n", width, xs[0], pageHeight-ys[0])
+	for i := 1; i < len(xs); i++ {
+		fmt.Fprintf(d.current, "%.2f %.2f l\n", xs[i], pageHeight-ys[i])
+	}
+	fmt.Fprintf(d.current, "S\n")
+}
+
+// fillRect draws a filled rectangle with its top-left corner at x, y
+func (d *pdfDocument) fillRect(x, y, w, h float64) {
+	fmt.Fprintf(d.current, "%.2f %.2f %.2f %.2f re f\n", x, pageHeight-y-h, w, h)
+}
+
+// setColor sets stroke and fill color (RGB components 0..1)
+func (d *pdfDocument) setColor(r, g, b float64) {
+	fmt.Fprintf(d.current, "%.3f %.3f %.3f RG %.3f %.3f %.3f rg\n", r, g, b, r, g, b)
+}
+
+// writeTo serializes the document
+func (d *pdfDocument) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	startObj := func() int {
+		offsets = append(offsets, out.Len())
+		n := len(offsets)
+		fmt.Fprintf(&out, "%d 0 obj\n", n)
+		return n
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed: catalog, page tree and the two fonts.
+	// Pages and their content streams follow in pairs.
+	pageObj := func(i int) int { return 5 + 2*i }
+
+	startObj()
+	out.WriteString("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	startObj()
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj(i))
+	}
+	fmt.Fprintf(&out, "<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(d.pages))
+
+	startObj()
+	out.WriteString("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\nendobj\n")
+	startObj()
+	out.WriteString("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	for i, page := range d.pages {
+		startObj()
+		fmt.Fprintf(&out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pageWidth, pageHeight, fontRegular, fontBold, pageObj(i)+1)
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		startObj()
+		fmt.Fprintf(&out, "<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+		out.Write(compressed.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfString converts UTF-8 to WinAnsi and escapes it for a PDF string literal
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, c := range winAnsi(s) {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// winAnsi converts UTF-8 to WinAnsi (CP1252) bytes, replacing unsupported runes
+func winAnsi(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '€':
+			out = append(out, 0x80)
+		case r == '–':
+			out = append(out, 0x96)
+		case r == '•':
+			out = append(out, 0x95)
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			out = append(out, byte(r))
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// textWidth returns the width of a string in points
+func textWidth(font string, size float64, s string) float64 {
+	widths := helveticaWidths
+	if font == fontBold {
+		widths = helveticaBoldWidths
+	}
+
+	var total int
+	for _, c := range winAnsi(s) {
+		// Map umlauts to their base letters, which have the same width
+		switch c {
+		case 0xC4:
+			c = 'A'
+		case 0xD6:
+			c = 'O'
+		case 0xDC:
+			c = 'U'
+		case 0xE4:
+			c = 'a'
+		case 0xF6:
+			c = 'o'
+		case 0xFC:
+			c = 'u'
+		}
+		switch {
+		case c >= 32 && c <= 126:
+			total += widths[c-32]
+		case c == 0xDF: // ß
+			total += 611
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Glyph widths of the printable ASCII range (32..126) from the Adobe font metrics
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,187 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"baufi-optimierer/server/finance"
+	"baufi-optimierer/server/models"
+)
+
+// testLoan runs over three calendar years, with special payments and a name
+// with characters that need escaping
+func testLoan() *models.Loan {
+	return &models.Loan{
+		ID:                 "loan-1",
+		Name:               `Haus (Süd) & "Garten" <1>`,
+		Amount:             30000,
+		InterestRate:       3.5,
+		StartDate:          "2024-07-01",
+		FixedInterestYears: 1,
+		RepaymentType:      models.RepaymentTypeAbsolute,
+		RepaymentValue:     1000,
+		SpecialPayments: []models.SpecialPayment{
+			{ID: "a", Date: "2025-01-15", Amount: 5000, Note: "Bonus; Weihnachten"},
+			{ID: "b", Date: "2025-06-01", Amount: 2500},
+		},
+	}
+}
+
+func testSchedule(t *testing.T) *finance.Result {
+	t.Helper()
+	result, err := finance.Calculate(testLoan())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWriteScheduleCSV(t *testing.T) {
+	result := testSchedule(t)
+	years := len(finance.YearlySummary(result.Schedule))
+
+	for _, lang := range []string{LangDE, LangEN} {
+		t.Run(lang, func(t *testing.T) {
+			l, _ := LabelsFor(lang)
+			var out bytes.Buffer
+			if err := WriteScheduleCSV(&out, result, l); err != nil {
+				t.Fatal(err)
+			}
+
+			r := csv.NewReader(&out)
+			r.Comma = l.CSVSeparator
+			records, err := r.ReadAll()
+			if err != nil {
+				t.Fatalf("output does not parse: %v", err)
+			}
+			if len(records) != 1+len(result.Schedule)+years {
+				t.Fatalf("%d rows, want header, %d months and %d year totals", len(records), len(result.Schedule), years)
+			}
+			if records[0][0] != l.Date {
+				t.Errorf("header = %q", records[0])
+			}
+
+			// The special payment column of January 2025 holds the first payment
+			for _, record := range records[1:] {
+				if record[0] == time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Format(l.DateLayout) {
+					if want := l.FormatNumber(5000, false); record[4] != want {
+						t.Errorf("special payment = %q, want %q", record[4], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteScheduleXLSX(t *testing.T) {
+	result := testSchedule(t)
+	years := len(finance.YearlySummary(result.Schedule))
+	l, _ := LabelsFor(LangDE)
+
+	var out bytes.Buffer
+	if err := WriteScheduleXLSX(&out, result, l); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("output is not a zip file: %v", err)
+	}
+
+	parts := make(map[string]bool)
+	for _, f := range zr.File {
+		parts[f.Name] = true
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every part must be well-formed XML
+		dec := xml.NewDecoder(rc)
+		rows := 0
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+			if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "row" {
+				rows++
+			}
+		}
+		rc.Close()
+		if f.Name == "xl/worksheets/sheet1.xml" && rows != 1+len(result.Schedule)+years {
+			t.Errorf("sheet has %d rows, want header, %d months and %d year totals", rows, len(result.Schedule), years)
+		}
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if !parts[name] {
+			t.Errorf("part %s is missing", name)
+		}
+	}
+}
+
+func TestWriteLoanPDF(t *testing.T) {
+	l, _ := LabelsFor(LangDE)
+	var out bytes.Buffer
+	if err := WriteLoanPDF(&out, testLoan(), l, time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	pdf := out.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+
+	// startxref points to the cross-reference table, whose entries point to
+	// the objects
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point to the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) < 6 {
+		t.Fatalf("%d xref entries, want catalog, pages, fonts and at least one page", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj\n"; !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points to %q", i+1, pdf[offset:min(offset+10, len(pdf))])
+		}
+	}
+
+	// The content streams inflate and contain the loan name, escaped
+	var text strings.Builder
+	streams := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindAllSubmatchIndex(pdf, -1)
+	if len(streams) == 0 {
+		t.Fatal("no content streams")
+	}
+	for _, s := range streams {
+		length, _ := strconv.Atoi(string(pdf[s[2]:s[3]]))
+		zr, err := zlib.NewReader(bytes.NewReader(pdf[s[1] : s[1]+length]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("content stream does not inflate: %v", err)
+		}
+		text.Write(content)
+	}
+	if !strings.Contains(text.String(), "Haus \\(S\xfcd\\) & \"Garten\" <1>") {
+		t.Error("loan name not found in the content streams")
+	}
+}
@@ -0,0 +1,205 @@
+package report
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/finance"
+)
+
+// Cell style indexes into the cellXfs of xlsxStyles
+const (
+	styleDefault      = 0
+	styleDate         = 1
+	styleCurrency     = 2
+	styleBold         = 3
+	styleBoldCurrency = 4
+)
+
+// excelEpoch is day zero of the spreadsheet date serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// WriteScheduleXLSX writes the monthly schedule as an Office Open XML workbook.
+// The workbook is generated by hand so that no third-party dependency is needed.
+func WriteScheduleXLSX(w io.Writer, result *finance.Result, l Labels) error {
+	var sheet strings.Builder
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	sheet.WriteString(`<cols><col min="1" max="1" width="16" customWidth="1"/><col min="2" max="6" width="16" customWidth="1"/><col min="7" max="7" width="20" customWidth="1"/></cols>`)
+	sheet.WriteString(`<sheetData>`)
+
+	row := 1
+	sw := sheetWriter{b: &sheet}
+
+	sw.startRow(row)
+	for col, h := range scheduleHeader(l) {
+		sw.stringCell(col, row, h, styleBold)
+	}
+	sw.endRow()
+
+	years := finance.YearlySummary(result.Schedule)
+	yearIdx := 0
+	for i, rec := range result.Schedule {
+		row++
+		sw.startRow(row)
+		sw.numberCell(0, row, excelDate(rec.Date), styleDate)
+		sw.numberCell(1, row, rec.TotalPayment, styleCurrency)
+		sw.numberCell(2, row, rec.Interest, styleCurrency)
+		sw.numberCell(3, row, rec.Principal, styleCurrency)
+		sw.numberCell(4, row, rec.SpecialPayment, styleCurrency)
+		sw.numberCell(5, row, rec.RemainingBalance, styleCurrency)
+		if rec.IsFixedPeriodEnd {
+			sw.stringCell(6, row, l.Marker, styleBold)
+		}
+		sw.endRow()
+
+		lastOfYear := i == len(result.Schedule)-1 || result.Schedule[i+1].Date.Year() != rec.Date.Year()
+		if lastOfYear {
+			y := years[yearIdx]
+			yearIdx++
+			row++
+			sw.startRow(row)
+			sw.stringCell(0, row, fmt.Sprintf(l.YearTotal, y.Year), styleBold)
+			sw.numberCell(1, row, y.TotalPayment, styleBoldCurrency)
+			sw.numberCell(2, row, y.Interest, styleBoldCurrency)
+			sw.numberCell(3, row, y.Principal, styleBoldCurrency)
+			sw.numberCell(4, row, y.SpecialPayment, styleBoldCurrency)
+			sw.numberCell(5, row, y.RemainingBalance, styleBoldCurrency)
+			if y.FixedPeriodEnd {
+				sw.stringCell(6, row, l.Marker, styleBold)
+			}
+			sw.endRow()
+		}
+	}
+
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, xmlEscape(sheetName(l.Schedule)))},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", fmt.Sprintf(xlsxStyles, xmlEscape(l.SheetDateFormat), xmlEscape(l.SheetCurrencyFormat))},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// sheetWriter appends cells of a worksheet in SpreadsheetML
+type sheetWriter struct {
+	b *strings.Builder
+}
+
+func (s sheetWriter) startRow(row int) {
+	fmt.Fprintf(s.b, `<row r="%d">`, row)
+}
+
+func (s sheetWriter) endRow() {
+	s.b.WriteString(`</row>`)
+}
+
+func (s sheetWriter) stringCell(col, row int, value string, style int) {
+	fmt.Fprintf(s.b, `<c r="%s" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, cellRef(col, row), style, xmlEscape(value))
+}
+
+func (s sheetWriter) numberCell(col, row int, value float64, style int) {
+	fmt.Fprintf(s.b, `<c r="%s" s="%d"><v>%s</v></c>`, cellRef(col, row), style, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// cellRef returns the A1 reference of a zero-based column and one-based row
+func cellRef(col, row int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name + strconv.Itoa(row)
+}
+
+// excelDate converts a date to a spreadsheet date serial number
+func excelDate(t time.Time) float64 {
+	return t.Sub(excelEpoch).Hours() / 24
+}
+
+// sheetName strips characters that are not allowed in worksheet names
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 31 {
+		name = name[:31]
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+// xlsxStyles takes the date and currency number format codes
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="%s"/><numFmt numFmtId="165" formatCode="%s"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="165" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>
+</cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>`
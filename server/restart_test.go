@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// restartWrite is the outcome of one write of TestRollingRestart
+type restartWrite struct {
+	port   int
+	err    error
+	status int
+	id     string
+}
+
+// TestRollingRestart writes loans continuously while the server is replaced
+// by a second instance on the same database, the way a rolling restart does,
+// and checks that every acknowledged write survives. Writes go on until the
+// old instance has exited.
+//
+// A load balancer is simulated by sending each write to the old instance
+// while its readiness endpoint succeeds and to the new one afterwards. The
+// test fails if a request is cut off, if an acknowledged loan is missing
+// after the restart, or if the WAL is not checkpointed when an instance exits.
+func TestRollingRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the server and runs two instances")
+	}
+
+	work := t.TempDir()
+	binary := filepath.Join(work, "baufi-opt")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		t.Fatalf("building the server failed: %v\n%s", err, out)
+	}
+	dbPath := filepath.Join(work, "data", "loans.db")
+	oldPort, newPort := freePort(t), freePort(t)
+
+	// The writer exceeds the rate limit and loan quota on purpose, so they are disabled
+	start := func(port int) (*exec.Cmd, string) {
+		logPath := filepath.Join(work, fmt.Sprintf("server-%d.log", port))
+		logFile, err := os.Create(logPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { logFile.Close() })
+
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("PORT=%d", port), "DB_PATH="+dbPath,
+			"SHUTDOWN_DELAY=1s", "SHUTDOWN_TIMEOUT=10s",
+			"RATE_LIMIT_WRITES=0", "MAX_LOANS_PER_USER=0")
+		cmd.Stdout, cmd.Stderr = logFile, logFile
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if cmd.ProcessState == nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+			}
+		})
+		waitReady(t, port)
+		return cmd, logPath
+	}
+
+	// Every request on a new connection, so none is sent on one that is closing
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar:       jar,
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+
+	old, oldLog := start(oldPort)
+	resp, err := client.Post(serverURL(oldPort, "/api/auth/register"), "application/json",
+		strings.NewReader(`{"email":"restart@example.com","password":"restart-test","name":"Restart"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		t.Fatalf("registration failed with %d", resp.StatusCode)
+	}
+
+	stop := make(chan struct{})
+	writes := make(chan []restartWrite)
+	go func() {
+		var results []restartWrite
+		for i := 1; ; i++ {
+			select {
+			case <-stop:
+				writes <- results
+				return
+			default:
+			}
+			port := newPort
+			if ready(client, oldPort) {
+				port = oldPort
+			}
+			results = append(results, writeLoan(client, port, i))
+		}
+	}()
+
+	// Replace the old instance while writes are in flight
+	time.Sleep(time.Second)
+	newServer, _ := start(newPort)
+	old.Process.Signal(syscall.SIGTERM)
+	if err := old.Wait(); err != nil {
+		t.Errorf("old instance exited with an error: %v", err)
+	}
+	close(stop)
+	results := <-writes
+
+	acknowledged, oldWrites := 0, 0
+	var missing []string
+	stored := storedLoans(t, client, newPort)
+	for i, w := range results {
+		if w.port == oldPort {
+			oldWrites++
+		}
+		switch {
+		case w.err != nil && !errors.Is(w.err, syscall.ECONNREFUSED):
+			t.Errorf("write %d to port %d was cut off: %v", i+1, w.port, w.err)
+		case w.status == http.StatusCreated:
+			acknowledged++
+			if !stored[w.id] {
+				missing = append(missing, w.id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("%d acknowledged loans are missing after the restart: %v", len(missing), missing)
+	}
+
+	oldOutput, err := os.ReadFile(oldLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(oldOutput), "Server stopped") {
+		t.Error("old instance did not shut down cleanly")
+	}
+	if strings.Contains(string(oldOutput), "Error closing database") {
+		t.Error("old instance could not checkpoint and close the database")
+	}
+
+	newServer.Process.Signal(syscall.SIGTERM)
+	newServer.Wait()
+	if info, err := os.Stat(dbPath + "-wal"); err == nil && info.Size() > 0 {
+		t.Error("WAL not checkpointed on exit")
+	}
+
+	t.Logf("Writes: %d attempted, %d acknowledged, %d to the old instance", len(results), acknowledged, oldWrites)
+	if t.Failed() {
+		t.Logf("Old instance log:\n%s", oldOutput)
+	}
+}
+
+// freePort returns a TCP port that is free at the moment
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func serverURL(port int, path string) string {
+	return fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+}
+
+// ready reports whether the readiness endpoint of the instance succeeds
+func ready(client *http.Client, port int) bool {
+	resp, err := client.Get(serverURL(port, "/readyz"))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func waitReady(t *testing.T, port int) {
+	t.Helper()
+	client := &http.Client{Timeout: time.Second}
+	for range 50 {
+		if ready(client, port) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("server on port %d did not become ready", port)
+}
+
+// writeLoan creates one loan and records the outcome
+func writeLoan(client *http.Client, port, i int) restartWrite {
+	body := fmt.Sprintf(`{"name":"Loan %d","amount":300000,"interestRate":3.5,"startDate":"2025-01-01",`+
+		`"fixedInterestYears":10,"repaymentType":"PERCENTAGE","repaymentValue":2}`, i)
+	resp, err := client.Post(serverURL(port, "/api/loans"), "application/json", strings.NewReader(body))
+	if err != nil {
+		return restartWrite{port: port, err: err}
+	}
+	defer resp.Body.Close()
+
+	var loan struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loan); err != nil && resp.StatusCode == http.StatusCreated {
+		return restartWrite{port: port, err: err}
+	}
+	return restartWrite{port: port, status: resp.StatusCode, id: loan.ID}
+}
+
+// storedLoans returns the IDs of the loans the instance returns
+func storedLoans(t *testing.T, client *http.Client, port int) map[string]bool {
+	t.Helper()
+	resp, err := client.Get(serverURL(port, "/api/loans"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var loans []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&loans); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, loan := range loans {
+		ids[loan.ID] = true
+	}
+	return ids
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"baufi-optimierer/server/problem"
+)
+
+// Cache-Control of the static files. Vite puts a hash of the content into
+// the names of the files in assets/, so they never change; everything else,
+// most importantly index.html, is revalidated with its ETag on every use.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+// hashedAsset matches the names Vite gives to built assets, e.g.
+// assets/index-BmW3gq5D.js
+var hashedAsset = regexp.MustCompile(`^assets/.+-[A-Za-z0-9_-]{8,}\.[A-Za-z0-9]+$`)
+
+// minCompressSize is the size below which compression is not worth it
+const minCompressSize = 1024
+
+// staticFile is an embedded file prepared for serving
+type staticFile struct {
+	contentType  string
+	cacheControl string
+	etag         string // Of the uncompressed content, without quotes
+	content      []byte
+	gzip         []byte // nil if not compressible
+	brotli       []byte // Only if precompressed at build time
+}
+
+// staticSite serves the embedded UI. The files are read and compressed once
+// at startup: brotli variants are taken from .br files created by the
+// build, gzip variants from .gz files or compressed here.
+type staticSite struct {
+	files   map[string]*staticFile // By path without leading slash
+	modTime time.Time
+}
+
+// serveStatic serves the embedded static files, with index.html for all
+// other paths outside /api so the UI can route on the client
+func serveStatic(mux *http.ServeMux) {
+	// Get the static directory from the embedded FS
+	staticDir, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		slog.Warn("Could not load static files", "error", err)
+		// If no static files exist, just continue without serving them
+		return
+	}
+
+	site, err := newStaticSite(staticDir)
+	if err != nil {
+		slog.Warn("Could not load static files", "error", err)
+		return
+	}
+	mux.Handle("/", site)
+}
+
+func newStaticSite(fsys fs.FS) (*staticSite, error) {
+	site := &staticSite{files: make(map[string]*staticFile), modTime: buildTime()}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".br") {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		f := &staticFile{
+			contentType:  mime.TypeByExtension(path.Ext(name)),
+			cacheControl: cacheRevalidate,
+			etag:         hex.EncodeToString(sum[:16]),
+			content:      content,
+		}
+		if f.contentType == "" {
+			f.contentType = http.DetectContentType(content)
+		}
+		if hashedAsset.MatchString(name) {
+			f.cacheControl = cacheImmutable
+		}
+
+		if compressible(f.contentType) && len(content) >= minCompressSize {
+			if f.gzip, err = fs.ReadFile(fsys, name+".gz"); err != nil {
+				f.gzip = gzipBytes(content)
+			}
+			f.brotli, _ = fs.ReadFile(fsys, name+".br")
+			if len(f.gzip) >= len(content) {
+				f.gzip = nil
+			}
+		}
+		site.files[name] = f
+		return nil
+	})
+	return site, err
+}
+
+// ServeHTTP serves a file, or index.html if there is none. Unknown /api
+// paths are answered with a 404 problem instead.
+func (s *staticSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+		problem.Error(w, r, http.StatusNotFound, "Unknown API endpoint")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		problem.Error(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+	f, ok := s.files[name]
+	if !ok {
+		// Client-side route
+		if f, ok = s.files["index.html"]; !ok {
+			problem.Error(w, r, http.StatusNotFound, "Not found")
+			return
+		}
+		name = "index.html"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", f.contentType)
+	h.Set("Cache-Control", f.cacheControl)
+
+	content, etag := f.content, f.etag
+	if f.gzip != nil {
+		h.Add("Vary", "Accept-Encoding")
+		switch {
+		case f.brotli != nil && acceptsEncoding(r, "br"):
+			content, etag = f.brotli, etag+"-br"
+			h.Set("Content-Encoding", "br")
+		case acceptsEncoding(r, "gzip"):
+			content, etag = f.gzip, etag+"-gz"
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("ETag", `"`+etag+`"`)
+
+	// ServeContent answers conditional and range requests
+	http.ServeContent(w, r, name, s.modTime, bytes.NewReader(content))
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the request
+// allows a content coding. An entry naming the coding takes precedence over
+// *, so "*;q=0, gzip" accepts gzip.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	exact, wildcard := -1.0, -1.0 // q of the entries, -1 if missing
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch {
+		case strings.EqualFold(name, coding):
+			exact = q
+		case name == "*":
+			wildcard = q
+		}
+	}
+	if exact >= 0 {
+		return exact > 0
+	}
+	return wildcard > 0
+}
+
+// compressible reports whether files of a content type shrink when compressed
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch mediaType {
+	case "application/javascript", "text/javascript", "application/json", "application/manifest+json",
+		"image/svg+xml", "application/wasm", "application/xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+func gzipBytes(content []byte) []byte {
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(content)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// buildTime approximates when the embedded files were built by the
+// modification time of the binary. It is their Last-Modified time.
+func buildTime() time.Time {
+	if exe, err := os.Executable(); err == nil {
+		if info, err := os.Stat(exe); err == nil {
+			return info.ModTime()
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		coding string
+		want   bool
+	}{
+		{"", "gzip", false},
+		{"gzip, deflate, br", "gzip", true},
+		{"gzip, deflate, br", "br", true},
+		{"GZIP", "gzip", true},
+		{"deflate", "gzip", false},
+		{"gzip;q=0", "gzip", false},
+		{"gzip; q=0.5", "gzip", true},
+		{"*", "br", true},
+		{"*;q=0", "gzip", false},
+		{"*;q=0, gzip", "gzip", true},
+		{"gzip, *;q=0", "gzip", true},
+		{"gzip;q=0, *", "gzip", false},
+		{"br;q=0, *", "gzip", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsEncoding(r, tt.coding); got != tt.want {
+			t.Errorf("acceptsEncoding(%q, %s) = %v, want %v", tt.header, tt.coding, got, tt.want)
+		}
+	}
+}
+
+func TestStaticSite(t *testing.T) {
+	index := "<!doctype html><html><body>" + strings.Repeat("<p>Baufinanzierung</p>", 100) + "</body></html>"
+	script := strings.Repeat("console.log('loan');\n", 100)
+	site, err := newStaticSite(fstest.MapFS{
+		"index.html":                  {Data: []byte(index)},
+		"assets/index-BmW3gq5D.js":    {Data: []byte(script)},
+		"assets/index-BmW3gq5D.js.br": {Data: []byte("brotli")},
+		"assets/logo.svg":             {Data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)},
+		"favicon.ico":                 {Data: []byte{0, 0, 1, 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(method, target, acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		site.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("cache control", func(t *testing.T) {
+		tests := map[string]string{
+			"/":                         cacheRevalidate,
+			"/index.html":               cacheRevalidate,
+			"/assets/index-BmW3gq5D.js": cacheImmutable,
+			"/assets/logo.svg":          cacheRevalidate,
+			"/loans/42":                 cacheRevalidate,
+		}
+		for target, want := range tests {
+			if got := get("GET", target, "", "").Header().Get("Cache-Control"); got != want {
+				t.Errorf("%s: Cache-Control = %q, want %q", target, got, want)
+			}
+		}
+	})
+
+	t.Run("encoding", func(t *testing.T) {
+		tests := []struct {
+			acceptEncoding string
+			want           string // Content-Encoding
+		}{
+			{"", ""},
+			{"gzip, deflate, br", "br"},
+			{"gzip", "gzip"},
+			{"*;q=0, gzip", "gzip"},
+			{"br;q=0, *", "gzip"},
+			{"gzip;q=0", ""},
+		}
+		etags := make(map[string]string)
+		for _, tt := range tests {
+			w := get("GET", "/assets/index-BmW3gq5D.js", tt.acceptEncoding, "")
+			h := w.Header()
+			if got := h.Get("Content-Encoding"); got != tt.want {
+				t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+			if h.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Accept-Encoding %q: Vary = %q", tt.acceptEncoding, h.Get("Vary"))
+			}
+			if got, ok := etags[h.Get("ETag")]; ok && got != tt.want {
+				t.Errorf("ETag %s is used for %q and %q", h.Get("ETag"), got, tt.want)
+			}
+			etags[h.Get("ETag")] = tt.want
+
+			body := w.Body.Bytes()
+			switch tt.want {
+			case "gzip":
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			case "br":
+				if string(body) != "brotli" {
+					t.Errorf("brotli body = %q, want the precompressed file", body)
+				}
+				continue
+			}
+			if string(body) != script {
+				t.Errorf("Accept-Encoding %q: body differs from the file", tt.acceptEncoding)
+			}
+		}
+
+		// Small files are not compressed and do not vary
+		w := get("GET", "/favicon.ico", "gzip, br", "")
+		if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+			t.Errorf("favicon: Content-Encoding = %q, Vary = %q, want neither",
+				w.Header().Get("Content-Encoding"), w.Header().Get("Vary"))
+		}
+	})
+
+	t.Run("conditional", func(t *testing.T) {
+		etag := get("GET", "/index.html", "gzip", "").Header().Get("ETag")
+		if w := get("GET", "/index.html", "gzip", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("matching If-None-Match: status = %d with %d bytes, want 304", w.Code, w.Body.Len())
+		}
+		if w := get("GET", "/index.html", "", etag); w.Code != http.StatusOK {
+			t.Errorf("If-None-Match of the gzip variant without gzip: status = %d, want 200", w.Code)
+		}
+		if w := get("GET", "/index.html", "gzip", `"other"`); w.Code != http.StatusOK {
+			t.Errorf("other If-None-Match: status = %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("client-side routes", func(t *testing.T) {
+		for _, target := range []string{"/", "/loans/42", "/households/7/members"} {
+			w := get("GET", target, "", "")
+			if w.Code != http.StatusOK || w.Body.String() != index || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("%s: status %d, Content-Type %q, want index.html", target, w.Code, w.Header().Get("Content-Type"))
+			}
+		}
+		if w := get("HEAD", "/loans/42", "", ""); w.Code != http.StatusOK {
+			t.Errorf("HEAD: status = %d, want 200", w.Code)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			method string
+			target string
+			status int
+		}{
+			{"GET", "/api/unknown", http.StatusNotFound},
+			{"GET", "/api", http.StatusNotFound},
+			{"POST", "/api/unknown", http.StatusNotFound},
+			{"POST", "/index.html", http.StatusMethodNotAllowed},
+		}
+		for _, tt := range tests {
+			w := get(tt.method, tt.target, "", "")
+			if w.Code != tt.status || w.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("%s %s: status %d, Content-Type %q, want %d problem+json",
+					tt.method, tt.target, w.Code, w.Header().Get("Content-Type"), tt.status)
+			}
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"baufi-optimierer/server/certs"
+	"baufi-optimierer/server/config"
+)
+
+// tlsConfig returns the TLS configuration of the server. The certificate is
+// taken from the reloader on every handshake, so renewals apply without a
+// restart.
+func tlsConfig(cfg *config.Config, reloader *certs.Reloader) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if cfg.TLS.ClientAuth == certs.ClientAuthNone {
+		return tlsCfg, nil
+	}
+
+	pool, err := certs.LoadClientCAs(cfg.TLS.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg.ClientCAs = pool
+	// Certificates are verified if sent, also when required: requiring them
+	// in the handshake would lock out health checks and browsers, so
+	// RequireClientCertificate enforces them per request instead
+	tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsCfg, nil
+}
+
+// redirectToHTTPS permanently redirects plain HTTP requests to the same URL
+// on the port of the HTTPS address
+func redirectToHTTPS(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" && port != "" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useMemo } from 'react';
-import { Plus, Wallet, Trash2, Edit2, Calculator, Save, TrendingDown, Clock, Sparkles } from 'lucide-react';
+import { Plus, Wallet, Trash2, Edit2, Calculator, Save, TrendingDown, Clock, Sparkles, LogOut } from 'lucide-react';
 import { Loan, SpecialPayment } from './types';
 import { calculateAmortization, calculateComparison, calculatePaymentImpact } from './utils/finance';
 import { LoanForm } from './components/LoanForm';
@@ -10,7 +10,7 @@ import { Modal } from './components/Modal';
 import { Button } from './components/Button';
 import { Input } from './components/Input';
 import { dateToInputString, isoToGerman, germanToIso } from './utils/formatters';
-import { loansAPI, paymentsAPI } from './utils/api';
+import { authAPI, loansAPI, paymentsAPI } from './utils/api';
 
 function App() {
   const [loans, setLoans] = useState<Loan[]>([]);
@@ -111,7 +111,7 @@ function App() {
   const handleDeleteLoan = async (id: string) => {
     if (confirm('Möchten Sie diesen Kredit wirklich löschen?')) {
       try {
-        await loansAPI.delete(id);
+        await loansAPI.delete(id, loans.find(l => l.id === id)?.version);
         const newLoans = loans.filter(l => l.id !== id);
         setLoans(newLoans);
         if (selectedLoanId === id) {
@@ -149,16 +149,14 @@ function App() {
     }
 
     try {
-      const newPayment = await paymentsAPI.create(selectedLoan.id, {
+      await paymentsAPI.create(selectedLoan.id, {
         date: isoDate,
         amount: parseFloat(paymentForm.amount),
         note: 'Sondertilgung',
       });
 
-      const updatedLoan = {
-        ...selectedLoan,
-        specialPayments: [...selectedLoan.specialPayments, newPayment]
-      };
+      // Reload the loan, its version changes with its payments
+      const updatedLoan = await loansAPI.getOne(selectedLoan.id);
 
       setLoans(prev => prev.map(l => l.id === updatedLoan.id ? updatedLoan : l));
       setIsPaymentModalOpen(false);
@@ -175,10 +173,7 @@ function App() {
     if (!selectedLoan) return;
     try {
       await paymentsAPI.delete(selectedLoan.id, paymentId);
-      const updatedLoan = {
-        ...selectedLoan,
-        specialPayments: selectedLoan.specialPayments.filter(p => p.id !== paymentId)
-      };
+      const updatedLoan = await loansAPI.getOne(selectedLoan.id);
       setLoans(prev => prev.map(l => l.id === updatedLoan.id ? updatedLoan : l));
     } catch (err) {
       const message = err instanceof Error ? err.message : 'Failed to remove payment';
@@ -210,6 +205,13 @@ function App() {
         <div className="p-4 border-b border-gray-200 flex items-center gap-2 text-brand-700">
           <Calculator size={24} />
           <h1 className="font-bold text-xl">FinanzPlaner</h1>
+          <button
+            onClick={async () => { await authAPI.logout(); window.location.reload(); }}
+            className="ml-auto p-1 text-gray-400 hover:text-gray-700"
+            title="Abmelden"
+          >
+            <LogOut size={18} />
+          </button>
         </div>
         
         <div className="p-4 flex-1 overflow-y-auto">
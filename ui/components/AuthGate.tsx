@@ -0,0 +1,128 @@
+import React, { useEffect, useState } from 'react';
+import { Calculator } from 'lucide-react';
+import { User } from '../types';
+import { authAPI, householdsAPI } from '../utils/api';
+import { Button } from './Button';
+import { Input } from './Input';
+
+interface AuthGateProps {
+  children: React.ReactNode;
+}
+
+export const AuthGate: React.FC<AuthGateProps> = ({ children }) => {
+  const [user, setUser] = useState<User | null>(null);
+  const [isChecking, setIsChecking] = useState(true);
+  const [mode, setMode] = useState<'login' | 'register'>('login');
+  const [form, setForm] = useState({ email: '', password: '', name: '' });
+  const [error, setError] = useState<string | null>(null);
+  const [isSubmitting, setIsSubmitting] = useState(false);
+  const [oidcEnabled, setOidcEnabled] = useState(false);
+
+  useEffect(() => {
+    authAPI.me()
+      .then(setUser)
+      .catch(err => console.error('Error checking session:', err))
+      .finally(() => setIsChecking(false));
+    authAPI.providers()
+      .then(providers => setOidcEnabled(providers.oidc))
+      .catch(err => console.error('Error fetching login methods:', err));
+  }, []);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+    setIsSubmitting(true);
+    try {
+      const loggedIn = mode === 'login'
+        ? await authAPI.login(form.email, form.password)
+        : await authAPI.register(form.email, form.password, form.name);
+      setUser(loggedIn);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Anmeldung fehlgeschlagen');
+    } finally {
+      setIsSubmitting(false);
+    }
+  };
+
+  // Invite links point to /?invite=<token>; join the household once logged in
+  useEffect(() => {
+    if (!user) return;
+    const params = new URLSearchParams(window.location.search);
+    const invite = params.get('invite');
+    if (!invite) return;
+    params.delete('invite');
+    const query = params.toString();
+    window.history.replaceState(null, '', window.location.pathname + (query ? `?${query}` : ''));
+    householdsAPI.acceptInvite(invite)
+      .then(household => alert(`Sie sind dem Haushalt "${household.name}" beigetreten.`))
+      .then(() => window.location.reload())
+      .catch(err => alert(err instanceof Error ? err.message : 'Einladung konnte nicht angenommen werden'));
+  }, [user]);
+
+  if (isChecking) {
+    return (
+      <div className="flex items-center justify-center min-h-screen bg-gray-50">
+        <p className="text-gray-500">Lade...</p>
+      </div>
+    );
+  }
+
+  if (user) {
+    return <>{children}</>;
+  }
+
+  return (
+    <div className="flex items-center justify-center min-h-screen bg-gray-50 p-4">
+      <form onSubmit={handleSubmit} className="w-full max-w-sm bg-white rounded-xl shadow-sm border border-gray-200 p-6 space-y-4">
+        <div className="flex items-center gap-2 text-brand-700 mb-2">
+          <Calculator size={24} />
+          <h1 className="font-bold text-xl">FinanzPlaner</h1>
+        </div>
+
+        {mode === 'register' && (
+          <Input
+            label="Name"
+            value={form.name}
+            onChange={e => setForm({ ...form, name: e.target.value })}
+          />
+        )}
+        <Input
+          label="E-Mail"
+          type="email"
+          required
+          value={form.email}
+          onChange={e => setForm({ ...form, email: e.target.value })}
+        />
+        <Input
+          label="Passwort"
+          type="password"
+          required
+          minLength={mode === 'register' ? 8 : undefined}
+          value={form.password}
+          onChange={e => setForm({ ...form, password: e.target.value })}
+        />
+
+        {error && <p className="text-sm text-red-600">{error}</p>}
+
+        <Button type="submit" className="w-full" disabled={isSubmitting}>
+          {mode === 'login' ? 'Anmelden' : 'Konto erstellen'}
+        </Button>
+        {oidcEnabled && mode === 'login' && (
+          <a
+            href={authAPI.oidcLoginURL()}
+            className="block w-full text-center text-sm border border-gray-300 rounded-lg py-2 text-gray-700 hover:bg-gray-50"
+          >
+            Mit SSO anmelden
+          </a>
+        )}
+        <button
+          type="button"
+          onClick={() => { setMode(mode === 'login' ? 'register' : 'login'); setError(null); }}
+          className="w-full text-sm text-brand-600 hover:underline"
+        >
+          {mode === 'login' ? 'Noch kein Konto? Registrieren' : 'Bereits registriert? Anmelden'}
+        </button>
+      </form>
+    </div>
+  );
+};
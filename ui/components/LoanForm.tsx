@@ -58,7 +58,8 @@ export const LoanForm: React.FC<LoanFormProps> = ({ initialData, onSave, onCance
       fixedInterestYears: Number(formData.fixedInterestYears),
       repaymentType: formData.repaymentType!,
       repaymentValue: Number(formData.repaymentValue),
-      specialPayments: formData.specialPayments || []
+      specialPayments: formData.specialPayments || [],
+      version: initialData?.version
     });
   };
 
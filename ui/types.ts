@@ -20,6 +20,17 @@ export interface Loan {
   repaymentType: RepaymentType;
   repaymentValue: number; // Value for % or € depending on type
   specialPayments: SpecialPayment[];
+  version?: number;       // Changes with every update, sent back as If-Match
+  householdId?: string;
+  role?: HouseholdRole;   // Role of the current user in the household
+}
+
+export type HouseholdRole = 'owner' | 'editor' | 'viewer';
+
+export interface Household {
+  id: string;
+  name: string;
+  role: HouseholdRole;
 }
 
 export interface MonthRecord {
@@ -39,4 +50,9 @@ export interface CalculationResult {
   payoffDate: Date;
   fixedPeriodEndDate: Date;
   remainingAtFixedEnd: number;
-}
\ No newline at end of file
+}
+export interface User {
+  id: string;
+  email: string;
+  name: string;
+}
@@ -1,15 +1,27 @@
-import { Loan, SpecialPayment } from '../types';
+import { Household, Loan, SpecialPayment, User } from '../types';
 
 const API_BASE = '/api';
 
 // Error types
+
+// FieldViolation is one invalid field of a problem+json error response
+export interface FieldViolation {
+  pointer: string;  // JSON pointer, e.g. /amount
+  code: string;
+  message: string;  // Localised via Accept-Language
+}
+
 export class APIError extends Error {
-  constructor(public statusCode: number, message: string) {
+  constructor(public statusCode: number, message: string, public violations: FieldViolation[] = []) {
     super(message);
     this.name = 'APIError';
   }
 }
 
+// ifMatch returns the If-Match header for a known loan version
+const ifMatch = (version?: number): Record<string, string> =>
+  version !== undefined ? { 'If-Match': `"${version}"` } : {};
+
 // Loans API
 export const loansAPI = {
   /**
@@ -50,8 +62,8 @@ export const loansAPI = {
       body: JSON.stringify(loan),
     });
     if (!res.ok) {
-      const error = await res.json().catch(() => ({ error: 'Failed to create loan' }));
-      throw new APIError(res.status, error.error || 'Failed to create loan');
+      const error = await res.json().catch(() => ({ detail: 'Failed to create loan' }));
+      throw new APIError(res.status, error.detail || 'Failed to create loan', error.errors);
     }
     return res.json();
   },
@@ -62,15 +74,18 @@ export const loansAPI = {
   update: async (id: string, loan: Partial<Loan>): Promise<Loan> => {
     const res = await fetch(`${API_BASE}/loans/${id}`, {
       method: 'PUT',
-      headers: { 'Content-Type': 'application/json' },
+      headers: { 'Content-Type': 'application/json', ...ifMatch(loan.version) },
       body: JSON.stringify(loan),
     });
     if (!res.ok) {
       if (res.status === 404) {
         throw new APIError(404, 'Loan not found');
       }
-      const error = await res.json().catch(() => ({ error: 'Failed to update loan' }));
-      throw new APIError(res.status, error.error || 'Failed to update loan');
+      if (res.status === 412) {
+        throw new APIError(412, 'Loan was changed in the meantime, please reload');
+      }
+      const error = await res.json().catch(() => ({ detail: 'Failed to update loan' }));
+      throw new APIError(res.status, error.detail || 'Failed to update loan', error.errors);
     }
     return res.json();
   },
@@ -78,14 +93,18 @@ export const loansAPI = {
   /**
    * Delete a loan
    */
-  delete: async (id: string): Promise<void> => {
+  delete: async (id: string, version?: number): Promise<void> => {
     const res = await fetch(`${API_BASE}/loans/${id}`, {
       method: 'DELETE',
+      headers: ifMatch(version),
     });
     if (!res.ok) {
       if (res.status === 404) {
         throw new APIError(404, 'Loan not found');
       }
+      if (res.status === 412) {
+        throw new APIError(412, 'Loan was changed in the meantime, please reload');
+      }
       throw new APIError(res.status, 'Failed to delete loan');
     }
   },
@@ -109,8 +128,8 @@ export const paymentsAPI = {
       if (res.status === 404) {
         throw new APIError(404, 'Loan not found');
       }
-      const error = await res.json().catch(() => ({ error: 'Failed to create payment' }));
-      throw new APIError(res.status, error.error || 'Failed to create payment');
+      const error = await res.json().catch(() => ({ detail: 'Failed to create payment' }));
+      throw new APIError(res.status, error.detail || 'Failed to create payment', error.errors);
     }
     return res.json();
   },
@@ -130,3 +149,106 @@ export const paymentsAPI = {
     }
   },
 };
+
+
+// Auth API
+export const authAPI = {
+  /**
+   * Get the logged in user, or null if there is no session
+   */
+  me: async (): Promise<User | null> => {
+    const res = await fetch(`${API_BASE}/auth/me`);
+    if (res.status === 401) {
+      return null;
+    }
+    if (!res.ok) {
+      throw new APIError(res.status, 'Failed to fetch user');
+    }
+    return res.json();
+  },
+
+  /**
+   * Get the available login methods
+   */
+  providers: async (): Promise<{ password: boolean; oidc: boolean }> => {
+    const res = await fetch(`${API_BASE}/auth/providers`);
+    if (!res.ok) {
+      throw new APIError(res.status, 'Failed to fetch login methods');
+    }
+    return res.json();
+  },
+
+  /**
+   * URL that starts the single sign-on login
+   */
+  oidcLoginURL: (): string => `${API_BASE}/auth/oidc/login`,
+
+  /**
+   * Log in with email and password
+   */
+  login: async (email: string, password: string): Promise<User> => {
+    const res = await fetch(`${API_BASE}/auth/login`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email, password }),
+    });
+    if (!res.ok) {
+      const error = await res.json().catch(() => ({ detail: 'Failed to log in' }));
+      throw new APIError(res.status, error.detail || 'Failed to log in', error.errors);
+    }
+    return res.json();
+  },
+
+  /**
+   * Create an account and log in
+   */
+  register: async (email: string, password: string, name?: string): Promise<User> => {
+    const res = await fetch(`${API_BASE}/auth/register`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email, password, name }),
+    });
+    if (!res.ok) {
+      const error = await res.json().catch(() => ({ detail: 'Failed to register' }));
+      throw new APIError(res.status, error.detail || 'Failed to register', error.errors);
+    }
+    return res.json();
+  },
+
+  /**
+   * End the current session
+   */
+  logout: async (): Promise<void> => {
+    await fetch(`${API_BASE}/auth/logout`, { method: 'POST' });
+  },
+};
+
+// Households API
+export const householdsAPI = {
+  /**
+   * Get the households of the current user
+   */
+  getAll: async (): Promise<Household[]> => {
+    const res = await fetch(`${API_BASE}/households`);
+    if (!res.ok) {
+      throw new APIError(res.status, 'Failed to fetch households');
+    }
+    return res.json();
+  },
+
+  /**
+   * Join a household with the token of an invite link
+   */
+  acceptInvite: async (token: string): Promise<Household> => {
+    const res = await fetch(`${API_BASE}/invites/accept`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token }),
+    });
+    if (!res.ok) {
+      const error = await res.json().catch(() => ({ detail: 'Failed to accept invite' }));
+      throw new APIError(res.status, error.detail || 'Failed to accept invite', error.errors);
+    }
+    return res.json();
+  },
+};